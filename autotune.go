@@ -0,0 +1,191 @@
+package consistent
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+const (
+	// DefaultAutoTuneMaxDeviation is the default target of the deviation of the loads.
+	DefaultAutoTuneMaxDeviation = 0.1
+
+	// DefaultAutoTuneMaxReplicationFactor is the default upper limit of the tuned replication factor.
+	DefaultAutoTuneMaxReplicationFactor = 1024
+
+	// DefaultAutoTuneThreshold is the default ratio of the change of the number of bins to tune again.
+	DefaultAutoTuneThreshold = 0.25
+)
+
+// AutoTune represents a configuration to choose the replication factor by the number of bins.
+// The replication factor is doubled from Config.ReplicationFactor until the loads of the bins are balanced
+// within MaxDeviation before the load bound is applied. If no replication factor up to MaxReplicationFactor
+// meets it, e.g. there are too few partitions per bin, the most balanced one is chosen. The ring is tuned
+// again when the number of bins has changed by more than Threshold since the last tuning, and all virtual
+// nodes are placed again then.
+type AutoTune struct {
+	// MaxDeviation is the target of the coefficient of variation of the loads, namely the standard deviation
+	// of the number of partitions per bin divided by the average. DefaultAutoTuneMaxDeviation is used if it's zero.
+	MaxDeviation float64
+
+	// MaxReplicationFactor is the upper limit of the replication factor.
+	// DefaultAutoTuneMaxReplicationFactor is used if it's zero.
+	MaxReplicationFactor int
+
+	// Threshold is the ratio of the change of the number of bins since the last tuning to tune again.
+	// DefaultAutoTuneThreshold is used if it's zero.
+	Threshold float64
+}
+
+// withDefaults returns a copy of the auto tune with the defaults of the unconfigured fields.
+func (a *AutoTune) withDefaults() *AutoTune {
+	res := *a
+	if res.MaxDeviation == 0 {
+		res.MaxDeviation = DefaultAutoTuneMaxDeviation
+	}
+	if res.MaxReplicationFactor == 0 {
+		res.MaxReplicationFactor = DefaultAutoTuneMaxReplicationFactor
+	}
+	if res.Threshold == 0 {
+		res.Threshold = DefaultAutoTuneThreshold
+	}
+	return &res
+}
+
+// validate validates the auto tune. minimum is the configured replication factor.
+func (a *AutoTune) validate(minimum int) error {
+	switch {
+	case !(a.MaxDeviation >= 0) || math.IsInf(a.MaxDeviation, 1):
+		return &ConfigError{Field: "AutoTune.MaxDeviation", Reason: "must be a non-negative finite number", Err: ErrInvalidConfig}
+	case a.MaxReplicationFactor < 0:
+		return &ConfigError{Field: "AutoTune.MaxReplicationFactor", Reason: "must not be negative", Err: ErrInvalidConfig}
+	case a.MaxReplicationFactor > 0 && a.MaxReplicationFactor < minimum:
+		return &ConfigError{Field: "AutoTune.MaxReplicationFactor", Reason: "must not be less than ReplicationFactor", Err: ErrInvalidConfig}
+	case !(a.Threshold >= 0) || math.IsInf(a.Threshold, 1):
+		return &ConfigError{Field: "AutoTune.Threshold", Reason: "must be a non-negative finite number", Err: ErrInvalidConfig}
+	}
+	return nil
+}
+
+// ReplicationFactor returns the current replication factor of the ring, which is tuned with AutoTune.
+func (c *Consistent) ReplicationFactor() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.table.replicationFactor
+}
+
+// ReplicationFactor returns the replication factor of the ring in the snapshot.
+func (s *Snapshot) ReplicationFactor() int {
+	return s.t.replicationFactor
+}
+
+// tune chooses the replication factor for the bins if the number of bins has changed by more than
+// the threshold since the last tuning. The virtual nodes are placed again if the replication factor changes.
+func (t *table) tune(ctx context.Context) error {
+	n := len(t.bins)
+	if t.autoTune == nil || n == 0 {
+		return nil
+	}
+	if t.tunedBins > 0 && math.Abs(float64(n-t.tunedBins)) <= t.autoTune.Threshold*float64(t.tunedBins) {
+		return nil
+	}
+
+	if t.keys == nil {
+		keys, err := t.hashPartitions(ctx)
+		if err != nil {
+			return err
+		}
+		t.keys = keys
+	}
+
+	names := make([]string, 0, n)
+	for name := range t.bins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rf int
+	best := math.Inf(1)
+	for candidate := t.minReplicationFactor; ; candidate *= 2 {
+		if candidate > t.autoTune.MaxReplicationFactor {
+			candidate = t.autoTune.MaxReplicationFactor
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if d := t.deviation(candidate, names); d < best {
+			rf, best = candidate, d
+		}
+		if best <= t.autoTune.MaxDeviation || candidate == t.autoTune.MaxReplicationFactor {
+			break
+		}
+	}
+
+	t.tunedBins = n
+	if rf != t.replicationFactor {
+		t.replace(rf)
+	}
+	return nil
+}
+
+// deviation returns the coefficient of variation of the loads of the bins when each partition is owned by
+// its successor on the ring of the replication factor. The names of the bins must be sorted.
+func (t *table) deviation(rf int, names []string) float64 {
+	type vnode struct {
+		hash uint64
+		bin  int
+	}
+
+	vnodes := make([]vnode, 0, rf*len(names))
+	for i, name := range names {
+		for j := 0; j < rf; j++ {
+			vnodes = append(vnodes, vnode{hash: t.hasher.Sum64(t.vnodeKey(j, name)), bin: i})
+		}
+	}
+	// the bin with the smallest name owns the collided hash as the ring does.
+	sort.Slice(vnodes, func(i, j int) bool {
+		if vnodes[i].hash != vnodes[j].hash {
+			return vnodes[i].hash < vnodes[j].hash
+		}
+		return vnodes[i].bin < vnodes[j].bin
+	})
+
+	loads := make([]float64, len(names))
+	for _, h := range t.keys.hashes {
+		idx := sort.Search(len(vnodes), func(i int) bool {
+			return vnodes[i].hash >= h
+		})
+		if idx >= len(vnodes) {
+			idx = 0
+		}
+		loads[vnodes[idx].bin]++
+	}
+
+	mean := float64(t.partition) / float64(len(names))
+	var variance float64
+	for _, load := range loads {
+		variance += (load - mean) * (load - mean)
+	}
+	return math.Sqrt(variance/float64(len(names))) / mean
+}
+
+// replace places the virtual nodes of the bins again by the replication factor.
+// All hashes of the new ring are recorded as changed, so every partition is reassigned.
+func (t *table) replace(rf int) {
+	t.replicationFactor = rf
+	t.ring = make(map[uint64]*Bin, rf*len(t.bins))
+	t.sortedSet = make([]uint64, 0, rf*len(t.bins))
+	t.shadowed = make(map[uint64][]string)
+	t.changed = nil
+
+	for _, bin := range t.bins {
+		for i := 0; i < rf; i++ {
+			t.place(t.hasher.Sum64(t.vnodeKey(i, bin.String())), bin)
+		}
+	}
+	sort.Slice(t.sortedSet, func(i, j int) bool {
+		return t.sortedSet[i] < t.sortedSet[j]
+	})
+}
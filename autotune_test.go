@@ -0,0 +1,181 @@
+package consistent
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newAutoTuneConfig() *Config {
+	cfg := newConfig()
+	cfg.Partition = 271
+	cfg.ReplicationFactor = 1
+	cfg.LoadBalancingParameter = 1.25
+	cfg.AutoTune = &AutoTune{}
+	return cfg
+}
+
+// assertPlacement checks that the ring has the same partition table as a new ring built with its replication factor.
+func assertPlacement(t *testing.T, c *Consistent) {
+	t.Helper()
+
+	cfg := newAutoTuneConfig()
+	cfg.ReplicationFactor = c.ReplicationFactor()
+	cfg.AutoTune = nil
+	want, err := New(cfg, c.GetBins())
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	if diff := cmp.Diff(c.State().Owners, want.State().Owners); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestConsistent_AutoTune(t *testing.T) {
+	c, err := New(newAutoTuneConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	if c.ReplicationFactor() <= 1 {
+		t.Fatalf("replication factor should be tuned: got:%d", c.ReplicationFactor())
+	}
+	assertPlacement(t, c)
+
+	extra := initialBins(6)[4:]
+	var tuned []int
+	c.Subscribe(func(e Event) {
+		if e.Type == EventReplicationFactorTuned {
+			tuned = append(tuned, e.ReplicationFactor)
+		}
+	})
+
+	steps := []struct {
+		name string
+		fn   func() error
+		tune bool
+	}{
+		{name: "add within threshold", fn: func() error { return c.Add(extra[0]) }},
+		{name: "add past threshold", fn: func() error { return c.Add(extra[1]) }, tune: true},
+		{name: "remove within threshold", fn: func() error { return c.Remove(extra[0]) }},
+		{name: "remove past threshold", fn: func() error { return c.Remove(extra[1]) }, tune: true},
+	}
+	for _, step := range steps {
+		prev := c.ReplicationFactor()
+		count := len(tuned)
+		if err := step.fn(); err != nil {
+			t.Fatalf("failed to %s: %v", step.name, err)
+		}
+
+		want := prev
+		if step.tune {
+			fresh, err := New(newAutoTuneConfig(), c.GetBins())
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+			want = fresh.ReplicationFactor()
+		}
+		if got := c.ReplicationFactor(); got != want {
+			t.Fatalf("unexpected replication factor after %s: got:%d want:%d", step.name, got, want)
+		}
+		if events := len(tuned) - count; (want != prev) != (events == 1) || events > 1 {
+			t.Fatalf("unexpected tuned events after %s: got:%d", step.name, events)
+		}
+		assertPlacement(t, c)
+	}
+
+	if len(tuned) == 0 {
+		t.Fatal("replication factor should be tuned by the membership changes")
+	}
+
+	// the restored ring keeps the tuned replication factor.
+	c2, err := Restore(newAutoTuneConfig(), c.State())
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if got, want := c2.ReplicationFactor(), c.ReplicationFactor(); got != want {
+		t.Fatalf("unexpected replication factor: got:%d want:%d", got, want)
+	}
+	if err := c2.Add(NewBin("extra")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	assertPlacement(t, c2)
+}
+
+func TestTable_Tune(t *testing.T) {
+	cfg := newAutoTuneConfig()
+	for _, n := range []int{2, 4, 8, 16} {
+		t.Run(fmt.Sprintf("%d bins", n), func(t *testing.T) {
+			c, err := New(cfg, initialBins(n))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+
+			names := make([]string, n)
+			for i, bin := range initialBins(n) {
+				names[i] = bin.Name
+			}
+			rf := c.ReplicationFactor()
+			d := c.table.deviation(rf, names)
+
+			// the chosen value is the first one meeting the target, or the most balanced one.
+			for candidate := cfg.ReplicationFactor; candidate < rf; candidate *= 2 {
+				if got := c.table.deviation(candidate, names); got <= DefaultAutoTuneMaxDeviation || got < d {
+					t.Fatalf("replication factor %d should be chosen over %d: got:%v want:%v", candidate, rf, got, d)
+				}
+			}
+			if d > DefaultAutoTuneMaxDeviation {
+				for candidate := rf * 2; candidate <= DefaultAutoTuneMaxReplicationFactor; candidate *= 2 {
+					if got := c.table.deviation(candidate, names); got < d {
+						t.Fatalf("replication factor %d should be chosen over %d: got:%v want:%v", candidate, rf, got, d)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAutoTune_Validate(t *testing.T) {
+	type testcase struct {
+		autoTune *AutoTune
+		want     string
+	}
+
+	tcs := map[string]testcase{
+		"defaults": {
+			autoTune: &AutoTune{},
+		},
+		"negative deviation": {
+			autoTune: &AutoTune{MaxDeviation: -1},
+			want:     "AutoTune.MaxDeviation",
+		},
+		"maximum below minimum": {
+			autoTune: &AutoTune{MaxReplicationFactor: 1},
+			want:     "AutoTune.MaxReplicationFactor",
+		},
+		"negative threshold": {
+			autoTune: &AutoTune{Threshold: -0.5},
+			want:     "AutoTune.Threshold",
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.AutoTune = tc.autoTune
+			_, err := New(cfg, initialBins(3))
+
+			var cerr *ConfigError
+			switch {
+			case tc.want == "" && err != nil:
+				t.Fatalf("error unexpected: got:%v want:%v", err, nil)
+			case tc.want != "" && (!errors.As(err, &cerr) || cerr.Field != tc.want):
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+		})
+	}
+}
@@ -7,3 +7,17 @@ type Ball interface {
 	// String returns the name of the ball.
 	String() string
 }
+
+// stringBall is a ball identified by its name.
+type stringBall string
+
+// NewBall generates a ball from the passed name.
+// It's useful when the balls are restored from a storage which only keeps their names.
+func NewBall(name string) Ball {
+	return stringBall(name)
+}
+
+// String returns the ball's name.
+func (b stringBall) String() string {
+	return string(b)
+}
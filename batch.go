@@ -0,0 +1,75 @@
+package consistent
+
+import "time"
+
+// LocateMany finds the homes of the keys at once without registering them.
+// The i-th bin is the home of the i-th key, and it's the zero Bin if the ring has no bin.
+// All keys are located in the same snapshot, so the result is consistent even if the ring changes meanwhile.
+func (c *Consistent) LocateMany(keys [][]byte) []Bin {
+	return c.Snapshot().LocateMany(keys)
+}
+
+// GroupByBin groups the keys by the names of their homes without registering them.
+// The keys keep their order in each group. All keys are located in the same snapshot.
+func (c *Consistent) GroupByBin(keys [][]byte) map[string][][]byte {
+	return c.Snapshot().GroupByBin(keys)
+}
+
+// LocateMany finds the homes of the keys in the snapshot.
+// The i-th bin is the home of the i-th key, and it's the zero Bin if the ring has no bin.
+// Each key is hashed once, and each bin is a copy which can be modified without affecting the others.
+func (s *Snapshot) LocateMany(keys [][]byte) []Bin {
+	res := make([]Bin, len(keys))
+	s.route(keys, func(i int, bin *Bin) {
+		if bin != nil {
+			res[i] = bin.clone()
+		}
+	})
+	return res
+}
+
+// GroupByBin groups the keys by the names of their homes in the snapshot.
+// The keys keep their order in each group. It returns an empty map if the ring has no bin.
+// The groups share a backing array, but each of them has its own capacity so appending to a group is safe.
+func (s *Snapshot) GroupByBin(keys [][]byte) map[string][][]byte {
+	// the homes are kept to count the keys of each bin before the groups are allocated.
+	homes := make([]*Bin, len(keys))
+	counts := make(map[*Bin]int, len(s.t.bins))
+	s.route(keys, func(i int, bin *Bin) {
+		if bin != nil {
+			homes[i] = bin
+			counts[bin]++
+		}
+	})
+
+	backing := make([][]byte, 0, len(keys))
+	groups := make(map[*Bin][][]byte, len(counts))
+	for bin, n := range counts {
+		groups[bin] = backing[len(backing) : len(backing) : len(backing)+n]
+		backing = backing[:len(backing)+n]
+	}
+	for i, bin := range homes {
+		if bin != nil {
+			groups[bin] = append(groups[bin], keys[i])
+		}
+	}
+
+	res := make(map[string][][]byte, len(groups))
+	for bin, group := range groups {
+		res[bin.Name] = group
+	}
+	return res
+}
+
+// route calls fn with the index of each key and the bin serving it, which must not be modified.
+// The bin is nil if the ring has no bin.
+func (s *Snapshot) route(keys [][]byte, fn func(i int, bin *Bin)) {
+	var now time.Time
+	if !s.t.overrides.empty() {
+		now = s.t.now()
+	}
+	for i, key := range keys {
+		bin, _ := s.t.route(key, now)
+		fn(i, bin)
+	}
+}
@@ -0,0 +1,177 @@
+package consistent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConsistent_LocateMany(t *testing.T) {
+	type testcase struct {
+		setup func(c *Consistent) error
+	}
+
+	tcs := map[string]testcase{
+		"plain": {
+			setup: func(c *Consistent) error { return nil },
+		},
+		"override": {
+			setup: func(c *Consistent) error {
+				return c.SetOverride(Override{Key: ballPrefix + "1", Prefix: true, Bin: "node3"}, 0)
+			},
+		},
+		"ejected": {
+			setup: func(c *Consistent) error { return c.Eject("node2") },
+		},
+	}
+
+	keys := make([][]byte, 0, 200)
+	for i := 0; i < 200; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("%s%d", ballPrefix, i)))
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			c, err := New(newConfig(), initialBins(5))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+			if err := tc.setup(c); err != nil {
+				t.Fatalf("failed to set up: %v", err)
+			}
+
+			want := make([]Bin, 0, len(keys))
+			wantGroups := make(map[string][][]byte)
+			for _, key := range keys {
+				bin, _ := c.Lookup(key)
+				want = append(want, *bin)
+				wantGroups[bin.Name] = append(wantGroups[bin.Name], key)
+			}
+
+			if diff := cmp.Diff(c.LocateMany(keys), want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+			if diff := cmp.Diff(c.GroupByBin(keys), wantGroups); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestConsistent_LocateManyNoBins(t *testing.T) {
+	c, err := New(newConfig(), nil)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	keys := [][]byte{[]byte("a"), []byte("b")}
+	if diff := cmp.Diff(c.LocateMany(keys), []Bin{{}, {}}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	if diff := cmp.Diff(c.GroupByBin(keys), map[string][][]byte{}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestConsistent_LocateManyLabels(t *testing.T) {
+	c, err := New(newConfig(), []Bin{NewBinWithLabels("node0", map[string]string{"zone": "a"})})
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	// modifying the labels of a bin must not affect the others nor the ring.
+	bins := c.LocateMany([][]byte{[]byte("a"), []byte("b")})
+	bins[0].Labels["zone"] = "b"
+	if got := bins[1].Labels["zone"]; got != "a" {
+		t.Fatalf("labels of the other bin mismatch, got:%s, want:a", got)
+	}
+	if bin, _ := c.Lookup([]byte("a")); bin.Labels["zone"] != "a" {
+		t.Fatalf("labels of the ring mismatch, got:%s, want:a", bin.Labels["zone"])
+	}
+}
+
+func TestSnapshot_GroupByBinAppend(t *testing.T) {
+	c, err := New(newConfig(), initialBins(5))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	keys := make([][]byte, 0, 100)
+	for i := 0; i < 100; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("%s%d", ballPrefix, i)))
+	}
+
+	// appending to a group must not overwrite the keys of the other groups.
+	groups := c.Snapshot().GroupByBin(keys)
+	want := make(map[string][][]byte, len(groups))
+	for name, group := range groups {
+		want[name] = append([][]byte(nil), group...)
+	}
+	for name := range groups {
+		groups[name] = append(groups[name], []byte("extra"))
+	}
+	for name, group := range groups {
+		if diff := cmp.Diff(group[:len(group)-1], want[name]); diff != "" {
+			t.Fatalf("mismatch (-got,+want):%s", diff)
+		}
+	}
+}
+
+func benchmarkKeys(n int) [][]byte {
+	keys := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		keys = append(keys, []byte(fmt.Sprintf("%s%d", ballPrefix, i)))
+	}
+	return keys
+}
+
+func BenchmarkConsistent_LookupLoop(b *testing.B) {
+	cfg := newConfig()
+	c, err := New(cfg, initialBins(100))
+	if err != nil {
+		b.Errorf("failed: %v", err)
+	}
+	keys := benchmarkKeys(1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			c.Lookup(key)
+		}
+	}
+}
+
+func BenchmarkConsistent_LocateMany(b *testing.B) {
+	cfg := newConfig()
+	c, err := New(cfg, initialBins(100))
+	if err != nil {
+		b.Errorf("failed: %v", err)
+	}
+	keys := benchmarkKeys(1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.LocateMany(keys)
+	}
+}
+
+func BenchmarkConsistent_GroupByBin(b *testing.B) {
+	cfg := newConfig()
+	c, err := New(cfg, initialBins(100))
+	if err != nil {
+		b.Errorf("failed: %v", err)
+	}
+	keys := benchmarkKeys(1000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.GroupByBin(keys)
+	}
+}
@@ -3,8 +3,15 @@ package consistent
 // Bin represents an entity that serves the balls.
 // Usually it's a server but it can be anything.
 type Bin struct {
-	Name         string
+	Name string
+
+	// PartitionIDs holds the partitions owned by the bin in ascending order.
+	// It's shared by the copies returned from the ring, so it must not be modified in place.
 	PartitionIDs []PartitionID
+
+	// Labels are arbitrary key-value pairs which describe the bin, e.g. address, zone or version.
+	// They are carried through the ring and can be queried by SelectBins.
+	Labels map[string]string
 }
 
 // NewBin generates a bin from the passed name.
@@ -16,7 +23,44 @@ func NewBin(name string) Bin {
 	}
 }
 
+// NewBinWithLabels generates a bin from the passed name and labels.
+// The labels are copied, so modifying the passed map doesn't affect the bin.
+func NewBinWithLabels(name string, labels map[string]string) Bin {
+	return Bin{
+		Name:   name,
+		Labels: copyLabels(labels),
+	}
+}
+
 // String returns the bin's name.
 func (b Bin) String() string {
 	return b.Name
 }
+
+// clone returns a copy of the bin which doesn't share the labels.
+// The partition IDs are shared because they are never modified by the ring.
+func (b Bin) clone() Bin {
+	b.Labels = copyLabels(b.Labels)
+	return b
+}
+
+// binName returns the name of the bin or an empty string if the bin is nil.
+func binName(bin *Bin) string {
+	if bin == nil {
+		return ""
+	}
+	return bin.Name
+}
+
+// copyLabels returns a copy of the labels.
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+
+	res := make(map[string]string, len(labels))
+	for k, v := range labels {
+		res[k] = v
+	}
+	return res
+}
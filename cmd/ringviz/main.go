@@ -0,0 +1,137 @@
+// Command ringviz renders a consistent hash ring as a Graphviz DOT graph, an SVG image or an HTML page.
+//
+// The ring is restored from a state saved by Consistent.State, or built from the bin names:
+//
+//	ringviz -state ring.json -format html -o ring.html
+//	ringviz -bins node1,node2,node3 -partition 271 -replication 20 -format dot | dot -Tpng -o ring.png
+//
+// The hasher, the replication factor and the load balancing parameter must be the same as the ring which
+// saved the state.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/KeisukeYamashita/consistent/visualize"
+)
+
+// hashers holds the hashers selectable by the flag.
+var hashers = map[string]func() consistent.Hasher{
+	"fnv64":  func() consistent.Hasher { return fnvHasher{a: false} },
+	"fnv64a": func() consistent.Hasher { return fnvHasher{a: true} },
+}
+
+// fnvHasher hashes the keys by FNV-1 or FNV-1a.
+type fnvHasher struct {
+	a bool
+}
+
+// Sum64 returns the 64 bit FNV hash of the data.
+func (h fnvHasher) Sum64(data []byte) uint64 {
+	if h.a {
+		hs := fnv.New64a()
+		hs.Write(data)
+		return hs.Sum64()
+	}
+	hs := fnv.New64()
+	hs.Write(data)
+	return hs.Sum64()
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "ringviz: %v\n", err)
+		}
+		os.Exit(2)
+	}
+}
+
+// run renders the ring configured by the arguments.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("ringviz", flag.ContinueOnError)
+	statePath := fs.String("state", "", "path of the JSON state saved by Consistent.State, or - for the standard input")
+	bins := fs.String("bins", "", "comma separated names of the bins, used when -state is not set")
+	partition := fs.Uint64("partition", 271, "number of the partitions, taken from the state when -state is set")
+	replication := fs.Int("replication", 20, "replication factor")
+	load := fs.Float64("load", 1.25, "load balancing parameter")
+	hash := fs.String("hash", "fnv64a", "hasher: fnv64 or fnv64a")
+	format := fs.String("format", "svg", "output format: dot, svg or html")
+	out := fs.String("o", "", "output path (default the standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	newHasher, ok := hashers[*hash]
+	if !ok {
+		return fmt.Errorf("unknown hasher: %q", *hash)
+	}
+	cfg := &consistent.Config{
+		Hasher:                 newHasher(),
+		Partition:              *partition,
+		ReplicationFactor:      *replication,
+		LoadBalancingParameter: *load,
+		BallStore:              consistent.NewNopBallStore(),
+	}
+
+	var c *consistent.Consistent
+	var err error
+	if *statePath != "" {
+		c, err = restore(cfg, *statePath, stdin)
+	} else {
+		var bs []consistent.Bin
+		for _, name := range strings.Split(*bins, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				bs = append(bs, consistent.NewBin(name))
+			}
+		}
+		c, err = consistent.New(cfg, bs)
+	}
+	if err != nil {
+		return err
+	}
+
+	d := visualize.New(c.Snapshot())
+	if *out == "" {
+		return d.Write(stdout, visualize.Format(*format))
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := d.Write(f, visualize.Format(*format)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// restore restores the ring from the state in the file.
+func restore(cfg *consistent.Config, path string, stdin io.Reader) (*consistent.Consistent, error) {
+	r := stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var st consistent.State
+	if err := json.NewDecoder(r).Decode(&st); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	cfg.Partition = st.Partition
+	cfg.PlacementVersion = st.PlacementVersion
+	return consistent.Restore(cfg, &st)
+}
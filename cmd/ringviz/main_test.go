@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/KeisukeYamashita/consistent/visualize"
+)
+
+func TestRun(t *testing.T) {
+	type testcase struct {
+		args []string
+		want string
+		err  error
+	}
+
+	c, err := consistent.New(&consistent.Config{
+		Hasher:                 fnvHasher{a: true},
+		Partition:              23,
+		ReplicationFactor:      20,
+		LoadBalancingParameter: 1.25,
+	}, []consistent.Bin{consistent.NewBin("node1"), consistent.NewBin("node2")})
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	state, err := json.Marshal(c.State())
+	if err != nil {
+		t.Fatalf("failed to marshal state: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, state, 0o600); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+
+	tcs := map[string]testcase{
+		"bins": {
+			args: []string{"-bins", "node1, node2", "-format", "dot"},
+			want: "digraph ring {",
+		},
+		"state file": {
+			args: []string{"-state", path},
+			want: "<svg xmlns=",
+		},
+		"state from stdin": {
+			args: []string{"-state", "-", "-format", "html"},
+			want: "<!DOCTYPE html>",
+		},
+		"unknown hasher": {
+			args: []string{"-bins", "node1", "-hash", "md5"},
+			err:  errors.New("unknown hasher"),
+		},
+		"unsupported format": {
+			args: []string{"-bins", "node1", "-format", "png"},
+			err:  visualize.ErrUnsupportedFormat,
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			var stdout bytes.Buffer
+			err := run(tc.args, bytes.NewReader(state), &stdout)
+			if tc.err != nil {
+				if err == nil || (!errors.Is(err, tc.err) && !strings.Contains(err.Error(), tc.err.Error())) {
+					t.Fatalf("error unexpected: got:%v want:%v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error unexpected: got:%v want:%v", err, nil)
+			}
+			if !strings.Contains(stdout.String(), tc.want) {
+				t.Fatalf("output should contain %q", tc.want)
+			}
+		})
+	}
+}
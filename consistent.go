@@ -3,18 +3,36 @@
 package consistent
 
 import (
-	"encoding/binary"
+	"context"
 	"fmt"
 	"math"
-	"sort"
 	"sync"
-
-	"github.com/go-playground/validator/v10"
+	"time"
 )
 
 // PartitionID represents the ID of the partition.
 type PartitionID int
 
+// PlacementVersion represents the version of the algorithm placing the bins and the partitions on the ring.
+// The same config, bins and placement version always give the same partition table across processes,
+// Go versions and releases of this package. A new placement version is added instead of changing an existing one.
+type PlacementVersion int
+
+const (
+	// PlacementV1 places the i-th replica of a bin at the hash of the decimal i followed by the bin name,
+	// and a partition at the hash of its ID encoded in 8 bytes little endian. Each partition is assigned
+	// to the first bin clockwise from it which doesn't exceed the maximum load, in ascending order of the
+	// partition ID. When the replicas of different bins collide, the bin with the smallest name owns the hash.
+	PlacementV1 PlacementVersion = 1
+
+	// LatestPlacementVersion is the placement version used when it's not configured.
+	LatestPlacementVersion = PlacementV1
+)
+
+// MaxPartition is the maximum number of partitions. The hash and the owner of every partition are held
+// in memory, so the ring of more partitions can't be allocated.
+const MaxPartition uint64 = math.MaxInt32
+
 // Config represents a configuration of the consistent hashing.
 type Config struct {
 	// Hasher is responsible for generating unsigned, 64 bit hash of provided byte slice.
@@ -24,208 +42,323 @@ type Config struct {
 	// Partitions are used to divide the ring and assign bin and ball.
 	// Balls are distributed among partitions. Prime numbers are good to
 	// distribute keys uniformly. Select a big number if you have too many keys.
-	Partition uint64 `validate:"required,min=1,max=18446744073709551614"`
+	// It must not exceed MaxPartition.
+	Partition uint64
 
 	// Bins are replicated on consistent hash ring.
 	// It's known as virtual nodes to uniform the distribution.
-	ReplicationFactor int `validate:"required,min=1"`
+	// It's the minimum replication factor with AutoTune.
+	ReplicationFactor int
 
 	// LoadBalancingParameter is used to calculate average load.
 	// According to the Google paper, one or more bins will be adjusted so that they do not exceed a specific load.
 	// The maximum number of partitions are calculated by LoadBalancingParameter * (number of balls/number of bins).
-	LoadBalancingParameter float64 `validate:"required,gt=0"`
+	LoadBalancingParameter float64
+
+	// PlacementVersion is the version of the placement algorithm.
+	// LatestPlacementVersion is used if it's zero. Set it explicitly to keep the placement
+	// stable when upgrading to a release which changes the latest version.
+	PlacementVersion PlacementVersion
+
+	// BallStore stores the located balls.
+	// The balls are kept in memory if it's nil. Use NewNopBallStore if the balls don't have to be tracked.
+	BallStore BallStore
+
+	// Workers is the number of goroutines hashing the partitions when the ring is rebuilt.
+	// The ring is rebuilt by one goroutine if it's zero. Set it to runtime.GOMAXPROCS(0) to use all CPUs,
+	// in which case the Hasher must be safe for concurrent use. The placement doesn't depend on the number
+	// of the workers.
+	Workers int
+
+	// KeyExtractor extracts the part of the keys which decides their partitions.
+	// The whole key is used if it's nil. The overrides are matched against the whole key.
+	KeyExtractor KeyExtractor
+
+	// AutoTune chooses the replication factor by the number of bins if it's set.
+	// The chosen value is reported by ReplicationFactor and EventReplicationFactorTuned.
+	AutoTune *AutoTune
+
+	// MinimizeMovement keeps the owners of the partitions on membership changes as long as they don't
+	// exceed the maximum load, so only the partitions of the removed bins and the partitions exceeding
+	// the maximum load move. New bins receive only such partitions, so a LoadBalancingParameter close to 1
+	// is recommended. The placement depends on the history of the membership changes in this mode.
+	MinimizeMovement bool
+
+	// Progress is called periodically while the partitions are distributed.
+	// It's called from the goroutine rebuilding the ring, so it should return quickly.
+	Progress ProgressFunc
+}
+
+// ProgressFunc receives the number of the distributed partitions and the total number of partitions.
+type ProgressFunc func(done, total uint64)
+
+// placementVersion returns the configured placement version or the latest one if it's not configured.
+func (cfg *Config) placementVersion() PlacementVersion {
+	if cfg.PlacementVersion == 0 {
+		return LatestPlacementVersion
+	}
+	return cfg.PlacementVersion
+}
+
+// workers returns the configured number of the workers or one if it's not configured.
+func (cfg *Config) workers() int {
+	if cfg.Workers == 0 {
+		return 1
+	}
+	return cfg.Workers
 }
 
 // Consistent represents the consistent hashing ring.
 type Consistent struct {
 	mu sync.RWMutex
 
-	hasher                 Hasher
-	partition              uint64
-	replicationFactor      int
-	loadBalancingParameter float64
+	// wmu serializes the membership changes. The ring is rebuilt holding only wmu,
+	// so the readers are blocked just while the new table is swapped.
+	wmu sync.Mutex
 
-	// load is a mapping of a bin and it's load (partitions).
-	loads map[string][]PartitionID
+	hasher    Hasher
+	partition uint64
+	extractor KeyExtractor
 
-	// bins is a mapping of raw bin string and a bin.
-	bins map[string]*Bin
+	// table is the current state of the ring. It's replaced on every membership change.
+	table *table
 
-	// balls maps the partition and the ball
-	balls map[PartitionID][]Ball
+	// balls stores the balls by the partition.
+	balls BallStore
 
-	// partitions is a mapping partition ID to a bin.
-	partitions map[PartitionID]*Bin
+	// listeners holds the subscribers of the ring events.
+	listeners listeners
 
-	// ring is a mapping hash to a bin.
-	ring map[uint64]*Bin
+	// progress receives the progress of the rebuilds.
+	progress ProgressFunc
 
-	// sortedSet holds the sorted bins in the ring
-	sortedSet []uint64
+	// managed reports whether the membership of the ring is managed by a RingSet.
+	// It's guarded by wmu.
+	managed bool
 }
 
 // New generates a new Consistent by passed config.
 func New(cfg *Config, bins []Bin) (*Consistent, error) {
-	v := validator.New()
+	return NewContext(context.Background(), cfg, bins)
+}
 
-	if err := v.Struct(cfg); err != nil {
+// NewContext generates a new Consistent by passed config.
+// It returns the error of the context if the context is done before the partitions are distributed.
+func NewContext(ctx context.Context, cfg *Config, bins []Bin) (*Consistent, error) {
+	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
 
-	c := &Consistent{
-		hasher:                 cfg.Hasher,
-		balls:                  map[PartitionID][]Ball{},
-		bins:                   make(map[string]*Bin),
-		loadBalancingParameter: cfg.LoadBalancingParameter,
-		partition:              uint64(cfg.Partition),
-		replicationFactor:      cfg.ReplicationFactor,
-		ring:                   make(map[uint64]*Bin),
-	}
+	t := newTable(cfg)
 	for _, bin := range bins {
-		c.add(bin)
+		if _, ok := t.bins[bin.String()]; ok {
+			continue
+		}
+		t.add(bin)
 	}
-	if bins != nil {
-		if err := c.distributePartitions(); err != nil {
+	if err := t.tune(ctx); err != nil {
+		return nil, err
+	}
+	if len(bins) > 0 {
+		if _, err := t.distributePartitions(ctx, cfg.Progress); err != nil {
 			return nil, err
 		}
 	}
-	return c, nil
-}
 
-// Add adds a new bin to the consistent hash ring.
-// After adding the bin, it will recalculate the partitions.
-func (c *Consistent) Add(bin Bin) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	return newConsistent(cfg, t), nil
+}
 
-	if _, ok := c.bins[bin.String()]; ok {
-		return ErrBinAlreadyExist
+// validate validates the config. It returns a ConfigError of the first invalid field.
+func (cfg *Config) validate() error {
+	switch {
+	case cfg.Partition == 0:
+		return &ConfigError{Field: "Partition", Reason: "must be positive", Err: ErrInvalidConfig}
+	case cfg.Partition > MaxPartition:
+		return &ConfigError{Field: "Partition", Reason: fmt.Sprintf("must not exceed MaxPartition (%d)", MaxPartition), Err: ErrInvalidConfig}
+	case cfg.ReplicationFactor <= 0:
+		return &ConfigError{Field: "ReplicationFactor", Reason: "must be positive", Err: ErrInvalidConfig}
+	case !(cfg.LoadBalancingParameter > 0) || math.IsInf(cfg.LoadBalancingParameter, 1):
+		return &ConfigError{Field: "LoadBalancingParameter", Reason: "must be a positive finite number", Err: ErrInvalidConfig}
+	case cfg.PlacementVersion < 0:
+		return &ConfigError{Field: "PlacementVersion", Reason: "must not be negative", Err: ErrInvalidConfig}
+	case cfg.Workers < 0:
+		return &ConfigError{Field: "Workers", Reason: "must not be negative", Err: ErrInvalidConfig}
 	}
-
-	c.add(bin)
-	if err := c.distributePartitions(); err != nil {
-		return err
+	if cfg.AutoTune != nil {
+		if err := cfg.AutoTune.validate(cfg.ReplicationFactor); err != nil {
+			return err
+		}
+	}
+	if v := cfg.placementVersion(); v != PlacementV1 {
+		return &ConfigError{Field: "PlacementVersion", Reason: fmt.Sprintf("%d is not supported", v), Err: ErrUnsupportedPlacementVersion}
 	}
-	c.relocate()
 	return nil
 }
 
-// add replicates the bin by replication factor and stores to the ring.
-func (c *Consistent) add(bin Bin) {
-	for i := 0; i < c.replicationFactor; i++ {
-		key := []byte(fmt.Sprintf("%d%s", i, bin.String()))
-		h := c.hasher.Sum64(key)
-		c.ring[h] = &bin
-		c.sortedSet = append(c.sortedSet, h)
+// newConsistent generates a new Consistent which starts from the table.
+func newConsistent(cfg *Config, t *table) *Consistent {
+	balls := cfg.BallStore
+	if balls == nil {
+		balls = NewMemoryBallStore()
 	}
-	// sort hashes ascending
-	sort.Slice(c.sortedSet, func(i int, j int) bool {
-		return c.sortedSet[i] < c.sortedSet[j]
-	})
-	// storing bin at this map is useful to find backup bins of a partition.
-	c.bins[bin.String()] = &bin
-}
 
-func (c *Consistent) delSlice(val uint64) {
-	for i := 0; i < len(c.sortedSet); i++ {
-		if c.sortedSet[i] == val {
-			c.sortedSet = append(c.sortedSet[:i], c.sortedSet[i+1:]...)
-			break
-		}
+	return &Consistent{
+		hasher:    cfg.Hasher,
+		partition: cfg.Partition,
+		extractor: cfg.KeyExtractor,
+		table:     t,
+		balls:     balls,
+		progress:  cfg.Progress,
 	}
 }
 
-// Delete removes a ball from the ring.
-func (c *Consistent) Delete(ball Ball) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Add adds a new bin to the consistent hash ring.
+// After adding the bin, it will recalculate the partitions.
+func (c *Consistent) Add(bin Bin) error {
+	return c.AddContext(context.Background(), bin)
+}
 
-	partID := c.FindPartitionID([]byte(ball.String()))
-	filteredBalls := []Ball{}
-	var exist bool
-	for _, b := range c.balls[partID] {
-		if b.String() == ball.String() {
-			exist = true
-			continue
-		}
+// AddContext adds a new bin to the consistent hash ring.
+// The partitions are recalculated without blocking the readers. If the context is done
+// before the recalculation finishes, the ring is left unchanged and the error of the context is returned.
+func (c *Consistent) AddContext(ctx context.Context, bin Bin) error {
+	return c.add(ctx, bin, nil)
+}
+
+// add adds the bin if the ring is at the version. The version is not checked if it's nil.
+func (c *Consistent) add(ctx context.Context, bin Bin, version *uint64) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
 
-		filteredBalls = append(filteredBalls, b)
+	if c.managed {
+		return ErrManagedRing
 	}
-	if !exist {
-		return ErrBallNotFound
+	if err := c.checkVersion(version); err != nil {
+		return err
+	}
+	ch, err := c.prepareAdd(ctx, bin)
+	if err != nil {
+		return err
 	}
 
-	c.balls[partID] = filteredBalls
+	c.mu.Lock()
+	c.swap(ch)
+	c.mu.Unlock()
+
+	c.emitChange(ch)
 	return nil
 }
 
-// distributePartitions calculates the partitions and each loads of the bin.
-func (c *Consistent) distributePartitions() error {
-	loads := make(map[string][]PartitionID)
-	for _, bin := range c.bins {
-		loads[bin.String()] = []PartitionID{}
+// change is a membership change of the ring prepared without blocking the readers.
+type change struct {
+	typ   EventType
+	bin   Bin
+	prev  *table
+	t     *table
+	moved []PartitionID
+
+	// unpinned holds the partitions which were pinned to the removed bin.
+	unpinned []PartitionID
+}
+
+// prepareAdd rebuilds the table with the bin. The caller must hold wmu.
+func (c *Consistent) prepareAdd(ctx context.Context, bin Bin) (*change, error) {
+	// the table is replaced only by the writers holding wmu.
+	if _, ok := c.table.bins[bin.String()]; ok {
+		return nil, &BinError{Name: bin.String(), Err: ErrBinAlreadyExist}
 	}
-	partitions := make(map[PartitionID]*Bin)
 
-	bs := make([]byte, 8)
-	for partID := uint64(0); partID < c.partition; partID++ {
-		binary.LittleEndian.PutUint64(bs, partID)
-		key := c.hasher.Sum64(bs)
-		idx := sort.Search(len(c.sortedSet), func(i int) bool {
-			return c.sortedSet[i] >= key
-		})
-		if idx >= len(c.sortedSet) {
-			idx = 0
+	prev := c.table
+	t := prev.clone()
+	t.add(bin)
+	if err := t.tune(ctx); err != nil {
+		return nil, err
+	}
+	moved, err := t.rebalance(ctx, c.progress)
+	if err != nil {
+		return nil, err
+	}
+	return &change{typ: EventBinAdded, bin: bin.clone(), prev: prev, t: t, moved: moved}, nil
+}
+
+// prepareRemove rebuilds the table without the bin. The caller must hold wmu.
+// It returns nil if the bin doesn't exist.
+func (c *Consistent) prepareRemove(ctx context.Context, bin Bin) (*change, error) {
+	// the table is replaced only by the writers holding wmu.
+	removed, ok := c.table.bins[bin.String()]
+	if !ok {
+		return nil, nil
+	}
+
+	prev := c.table
+	t := prev.clone()
+	t.remove(bin)
+	delete(t.ejected, bin.String())
+	unpinned := t.unpinBin(bin.String())
+	t.overrides = t.overrides.dropBin(bin.String(), t.now())
+	var moved []PartitionID
+	if len(t.bins) == 0 {
+		// consistent hash ring is empty now. Reset the partition table.
+		moved = t.reset()
+	} else {
+		if err := t.tune(ctx); err != nil {
+			return nil, err
 		}
-		if err := c.distributeWithLoad(PartitionID(partID), idx, partitions, loads); err != nil {
-			return err
+		var err error
+		if moved, err = t.rebalance(ctx, c.progress); err != nil {
+			return nil, err
 		}
 	}
+	return &change{typ: EventBinRemoved, bin: removed.clone(), prev: prev, t: t, moved: moved, unpinned: unpinned}, nil
+}
 
-	c.partitions = partitions
-	c.loads = loads
-	return nil
+// swap replaces the table by the prepared one. The caller must hold wmu and mu.
+// The balls are stored by their partition, which never changes with the bins, so they are left untouched.
+func (c *Consistent) swap(ch *change) {
+	c.table = ch.t
 }
 
-// distributeWithLoad calculates the average load and assign the partition to a bin.
-func (c *Consistent) distributeWithLoad(partID PartitionID, idx int, partitions map[PartitionID]*Bin, loads map[string][]PartitionID) error {
-	maxLoad := c.MaximumLoad()
-	var count int
-	for {
-		count++
-		if count >= len(c.sortedSet) {
-			return ErrInsufficientPartitionCapacity
-		}
-		i := c.sortedSet[idx]
-		bin := *c.ring[i]
-		load := float64(len(loads[bin.String()]))
-		if load+1 <= maxLoad {
-			partitions[partID] = &bin
-			loads[bin.String()] = append(loads[bin.String()], partID)
-			return nil
-		}
-		idx++
-		if idx >= len(c.sortedSet) {
-			idx = 0
-		}
+// emitChange emits the events of the change. The caller must hold wmu.
+func (c *Consistent) emitChange(ch *change) {
+	c.emit(c.newEvent(ch.typ, ch.bin, ch.prev, ch.t, ch.moved))
+	if len(ch.unpinned) > 0 {
+		c.emit(Event{Type: EventPinFailedOver, Bin: ch.bin, Partitions: ch.unpinned, Version: ch.t.version, ReplicationFactor: ch.t.replicationFactor})
+	}
+	if ch.t.replicationFactor != ch.prev.replicationFactor {
+		c.emit(Event{Type: EventReplicationFactorTuned, Bin: ch.bin, Version: ch.t.version, ReplicationFactor: ch.t.replicationFactor})
 	}
 }
 
+// Delete removes a ball from the ring.
+func (c *Consistent) Delete(ball Ball) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	partID := c.FindPartitionID([]byte(ball.String()))
+	return c.balls.Delete(partID, ball)
+}
+
 // FindPartitionID returns partition id for given key.
+// The part of the key extracted by the KeyExtractor is hashed if it's configured.
 func (c *Consistent) FindPartitionID(key []byte) PartitionID {
+	if c.extractor != nil {
+		key = c.extractor(key)
+	}
 	hkey := c.hasher.Sum64(key)
 	return PartitionID(hkey % c.partition)
 }
 
 // GetBalls returns all balls in the bin
+// The balls which the ball store failed to read are not included.
 func (c *Consistent) GetBalls() []Ball {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	balls := []Ball{}
-	for _, bs := range c.balls {
-		balls = append(balls, bs...)
-	}
+	_ = c.balls.Range(func(_ PartitionID, ball Ball) bool {
+		balls = append(balls, ball)
+		return true
+	})
 
 	return balls
 }
@@ -235,16 +368,30 @@ func (c *Consistent) GetBallsByBin(bin Bin) ([]Ball, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	partitionIDs, exist := c.loads[bin.String()]
+	partitionIDs, exist := c.table.loads[bin.String()]
 	if !exist {
-		return nil, ErrBinNotFound
+		return nil, &BinError{Name: bin.String(), Err: ErrBinNotFound}
 	}
 
 	res := []Ball{}
+	if !c.table.overrides.empty() {
+		// the overridden balls can be in any partition.
+		err := c.balls.Range(func(_ PartitionID, ball Ball) bool {
+			if home, _ := c.table.locate([]byte(ball.String())); binName(home) == bin.String() {
+				res = append(res, ball)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
 	for _, id := range partitionIDs {
-		balls, exist := c.balls[id]
-		if !exist {
-			continue
+		balls, err := c.balls.List(id)
+		if err != nil {
+			return nil, err
 		}
 
 		res = append(res, balls...)
@@ -258,14 +405,14 @@ func (c *Consistent) GetBin(name string) (*Bin, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	bin, exist := c.bins[name]
+	bin, exist := c.table.bins[name]
 	if exist {
 		// create a thread-safe copy of bin list.
-		bin2 := *bin
+		bin2 := bin.clone()
 		return &bin2, nil
 	}
 
-	return nil, ErrBinNotFound
+	return nil, &BinError{Name: name, Err: ErrBinNotFound}
 }
 
 // GetBins returns a thread-safe copy of bins.
@@ -274,26 +421,21 @@ func (c *Consistent) GetBins() []Bin {
 	defer c.mu.RUnlock()
 
 	// Create a thread-safe copy of bin list.
-	bins := make([]Bin, 0, len(c.bins))
-	for _, bin := range c.bins {
-		bins = append(bins, *bin)
+	bins := make([]Bin, 0, len(c.table.bins))
+	for _, bin := range c.table.bins {
+		bins = append(bins, bin.clone())
 	}
 	return bins
 }
 
 // GetPartitionOwner returns the owner of the given partition.
+// The bin serving the partition instead is returned if the owner is ejected.
 func (c *Consistent) GetPartitionOwner(partID PartitionID) *Bin {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	bin, ok := c.partitions[partID]
-	if !ok {
-		return nil
-	}
 	// Create a thread-safe copy of bin and return it.
-
-	bin2 := *bin
-	return &bin2
+	return c.table.owner(partID)
 }
 
 // LoadDistribution exposes load distribution of bins.
@@ -303,65 +445,161 @@ func (c *Consistent) LoadDistribution() map[string]float64 {
 
 	// Create a thread-safe copy
 	res := make(map[string]float64)
-	for bin, partitions := range c.loads {
+	for bin, partitions := range c.table.loads {
 		res[bin] = float64(len(partitions))
 	}
 	return res
 }
 
+// BallDistribution returns the number of the balls located to each bin.
+// It walks the ball store once without copying the balls, so it's cheaper than GetBallsByBin for every bin.
+func (c *Consistent) BallDistribution() (map[string]int, error) {
+	c.mu.RLock()
+	t := c.table
+	c.mu.RUnlock()
+
+	res := make(map[string]int, len(t.loads))
+	for bin := range t.loads {
+		res[bin] = 0
+	}
+
+	var now time.Time
+	if !t.overrides.empty() {
+		now = t.now()
+	}
+	err := c.balls.Range(func(partID PartitionID, ball Ball) bool {
+		var home *Bin
+		if t.overrides.empty() {
+			if int(partID) < len(t.partitions) {
+				home = t.partitions[partID]
+			}
+		} else {
+			// the overridden balls can be in any partition.
+			home, _ = t.route([]byte(ball.String()), now)
+		}
+		if home != nil {
+			res[home.Name]++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 // Locate finds a home for given ball
+// The ball is registered to the ball store. Use Register to handle the error of the ball store,
+// or Lookup if the ball doesn't have to be registered.
 func (c *Consistent) Locate(ball Ball) *Bin {
-	c.mu.Lock()
-	partID := c.FindPartitionID([]byte(ball.String()))
-	c.balls[partID] = append(c.balls[partID], ball)
-	c.mu.Unlock()
-	return c.GetPartitionOwner(partID)
+	bin, _ := c.Register(ball)
+	return bin
+}
+
+// Lookup finds a home for given key without registering it.
+// It has no side effect, so it's suitable for routing only callers.
+func (c *Consistent) Lookup(key []byte) (*Bin, PartitionID) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.table.locate(key)
+}
+
+// Register finds a home for given ball and stores the ball to the ball store.
+// Balls are identified by their names, so registering the same ball again doesn't duplicate it.
+func (c *Consistent) Register(ball Ball) (*Bin, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bin, partID := c.table.locate([]byte(ball.String()))
+	if err := c.balls.Put(partID, ball); err != nil {
+		return nil, err
+	}
+	return bin, nil
 }
 
 // MaximumLoad exposes the current average load.
 func (c *Consistent) MaximumLoad() float64 {
-	load := float64(float64(c.partition)/float64(len(c.bins))) * c.loadBalancingParameter
-	return math.Ceil(load)
-}
-
-// relocate redistributes the balls to the current existing bins
-func (c *Consistent) relocate() {
-	newBalls := map[PartitionID][]Ball{}
-	for _, balls := range c.balls {
-		for _, ball := range balls {
-			partID := c.FindPartitionID([]byte(ball.String()))
-			if len(newBalls[partID]) == 0 {
-				newBalls[partID] = []Ball{ball}
-				continue
-			}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-			newBalls[partID] = append(newBalls[partID], ball)
-		}
-	}
-	c.balls = newBalls
+	return c.table.maximumLoad()
 }
 
 // Remove removes a bin from the consistent hash ring.
 func (c *Consistent) Remove(bin Bin) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	return c.RemoveContext(context.Background(), bin)
+}
+
+// RemoveContext removes a bin from the consistent hash ring.
+// The partitions are recalculated without blocking the readers. If the context is done
+// before the recalculation finishes, the ring is left unchanged and the error of the context is returned.
+func (c *Consistent) RemoveContext(ctx context.Context, bin Bin) error {
+	return c.remove(ctx, bin, nil)
+}
+
+// remove removes the bin if the ring is at the version. The version is not checked if it's nil.
+func (c *Consistent) remove(ctx context.Context, bin Bin, version *uint64) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
 
-	if _, ok := c.bins[bin.String()]; !ok {
+	if c.managed {
+		return ErrManagedRing
+	}
+	if err := c.checkVersion(version); err != nil {
+		return err
+	}
+	ch, err := c.prepareRemove(ctx, bin)
+	if err != nil || ch == nil {
 		// skip if the bin does not exist
-		return nil
+		return err
+	}
+
+	c.mu.Lock()
+	c.swap(ch)
+	c.mu.Unlock()
+
+	c.emitChange(ch)
+	return nil
+}
+
+// newEvent generates the event of the membership change from prev to t.
+// The balls in the moved partitions are counted as moved. The balls which the ball store failed to read are not counted.
+func (c *Consistent) newEvent(typ EventType, bin Bin, prev, t *table, moved []PartitionID) Event {
+	var balls int
+	count := func(_ PartitionID, ball Ball) bool {
+		key := []byte(ball.String())
+		from, _ := prev.locate(key)
+		to, _ := t.locate(key)
+		if binName(from) != binName(to) {
+			balls++
+		}
+		return true
 	}
 
-	for i := 0; i < c.replicationFactor; i++ {
-		key := []byte(fmt.Sprintf("%s%d", bin.String(), i))
-		h := c.hasher.Sum64(key)
-		delete(c.ring, h)
-		c.delSlice(h)
+	if prev.overrides != t.overrides {
+		// the overridden balls can be in any partition.
+		_ = c.balls.Range(count)
+	} else {
+		for _, partID := range moved {
+			bs, err := c.balls.List(partID)
+			if err != nil {
+				continue
+			}
+			for _, ball := range bs {
+				count(partID, ball)
+			}
+		}
 	}
-	delete(c.bins, bin.String())
-	if len(c.bins) == 0 {
-		// consistent hash ring is empty now. Reset the partition table.
-		c.partitions = make(map[PartitionID]*Bin)
-		return nil
+
+	return Event{
+		Type:         typ,
+		Bin:          bin,
+		Moved:        len(moved),
+		MinimumMoved: t.minimumMoved(prev),
+		BallsMoved:   balls,
+		Version:      t.version,
+
+		ReplicationFactor: t.replicationFactor,
 	}
-	return c.distributePartitions()
 }
@@ -1,6 +1,7 @@
 package consistent
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"hash/fnv"
@@ -65,6 +66,20 @@ func initialBins(cnt int) []Bin {
 	return bins
 }
 
+func partitionBalls(t *testing.T, c *Consistent) map[PartitionID][]Ball {
+	t.Helper()
+
+	balls := map[PartitionID][]Ball{}
+	if err := c.balls.Range(func(partID PartitionID, ball Ball) bool {
+		balls[partID] = append(balls[partID], ball)
+		return true
+	}); err != nil {
+		t.Fatalf("failed to range balls: %v", err)
+	}
+
+	return balls
+}
+
 func TestNew(t *testing.T) {
 	type testcase struct {
 		cfg  *Config
@@ -247,11 +262,6 @@ func TestConsistent_Delete(t *testing.T) {
 				c.Locate(ball)
 			}
 
-			oldBalls := map[PartitionID][]Ball{}
-			for partID, balls := range c.balls {
-				oldBalls[partID] = append(oldBalls[partID], balls...)
-			}
-
 			if err := c.Delete(tc.ball); err != nil {
 				if !errors.Is(err, tc.want) {
 					t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
@@ -352,6 +362,56 @@ func TestConsistent_GetBallsByBin(t *testing.T) {
 	}
 }
 
+func TestConsistent_BallDistribution(t *testing.T) {
+	type testcase struct {
+		override *Override
+	}
+
+	tcs := map[string]testcase{
+		"partition owners": {},
+		"overridden balls": {
+			override: &Override{Key: ballPrefix + "1", Prefix: true, Bin: "node0"},
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := New(newConfig(), initialBins(4))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+			for _, ball := range initialBalls(100) {
+				c.Locate(ball)
+			}
+			if tc.override != nil {
+				if err := c.SetOverride(*tc.override, 0); err != nil {
+					t.Fatalf("failed to set the override: %v", err)
+				}
+			}
+
+			want := make(map[string]int)
+			for _, bin := range c.GetBins() {
+				balls, err := c.GetBallsByBin(bin)
+				if err != nil {
+					t.Fatalf("failed to get the balls: %v", err)
+				}
+				want[bin.Name] = len(balls)
+			}
+
+			got, err := c.BallDistribution()
+			if err != nil {
+				t.Fatalf("failed to get the ball distribution: %v", err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
 func TestConsistent_GetBin(t *testing.T) {
 	type testcase struct {
 		bins []Bin
@@ -431,6 +491,7 @@ func TestConsistent_GetBins(t *testing.T) {
 				cmpopts.SortSlices(func(i, j Bin) bool {
 					return i.String() > j.String()
 				}),
+				cmpopts.IgnoreFields(Bin{}, "PartitionIDs"),
 			}
 			if diff := cmp.Diff(got, tc.bins, opts...); diff != "" {
 				t.Fatalf("mismatch request(-got,+want):%s\n", diff)
@@ -466,6 +527,7 @@ func TestConsistent_MaximumLoad(t *testing.T) {
 
 	for n, tc := range tcs {
 		t.Run(n, func(t *testing.T) {
+			tc := tc
 			t.Parallel()
 
 			c := new(t, &Config{
@@ -497,16 +559,18 @@ func TestConsistent_Relocate(t *testing.T) {
 	}
 
 	tcs := map[string]testcase{
-		"simple relocate": {
+		"add ball": {
 			balls: initialBalls(100),
 			bins:  initialBins(4),
 			f: func(c *Consistent) error {
-				c.relocate()
+				for i := 0; i < 3; i++ {
+					c.Locate(ball([]byte(fmt.Sprintf("new%d", i))))
+				}
 				return nil
 			},
-			hasDiff: false,
+			hasDiff: true,
 		},
-		"add ball": {
+		"locate existing ball": {
 			balls: initialBalls(100),
 			bins:  initialBins(4),
 			f: func(c *Consistent) error {
@@ -516,7 +580,7 @@ func TestConsistent_Relocate(t *testing.T) {
 				}
 				return nil
 			},
-			hasDiff: true,
+			hasDiff: false,
 		},
 		"delete ball": {
 			balls: initialBalls(100),
@@ -524,7 +588,9 @@ func TestConsistent_Relocate(t *testing.T) {
 			f: func(c *Consistent) error {
 				balls := initialBalls(3)
 				for _, ball := range balls {
-					c.Locate(ball)
+					if err := c.Delete(ball); err != nil {
+						return err
+					}
 				}
 				return nil
 			},
@@ -549,16 +615,13 @@ func TestConsistent_Relocate(t *testing.T) {
 				c.Locate(ball)
 			}
 
-			oldBalls := map[PartitionID][]Ball{}
-			for partID, balls := range c.balls {
-				oldBalls[partID] = append(oldBalls[partID], balls...)
-			}
+			oldBalls := partitionBalls(t, c)
 
 			if err := tc.f(c); err != nil {
 				t.Fatalf("failed to run setup: %v", err)
 			}
 
-			newBalls := c.balls
+			newBalls := partitionBalls(t, c)
 			if diff := cmp.Diff(oldBalls, newBalls); diff != "" {
 				if !tc.hasDiff {
 					t.Fatalf("should not have diff, got(-got,+want): %s", diff)
@@ -598,6 +661,7 @@ func TestConsistent_Remove(t *testing.T) {
 
 	cfg := newConfig()
 	for n, tc := range tcs {
+		tc := tc
 		t.Run(n, func(t *testing.T) {
 			t.Parallel()
 
@@ -618,6 +682,444 @@ func TestConsistent_Remove(t *testing.T) {
 	}
 }
 
+func TestConsistent_RemoveAfterAdd(t *testing.T) {
+	c := new(t, newConfig())
+	for _, bin := range initialBins(4) {
+		c.Add(bin)
+	}
+	removed := NewBin("removed")
+	c.Add(removed)
+	c.Remove(removed)
+
+	// the virtual nodes of the removed bin must not own any partition.
+	for partID := uint64(0); partID < newConfig().Partition; partID++ {
+		if owner := c.GetPartitionOwner(PartitionID(partID)); owner.String() == removed.String() {
+			t.Fatalf("partition %d is owned by the removed bin", partID)
+		}
+	}
+}
+
+func TestConsistent_BallStore(t *testing.T) {
+	type testcase struct {
+		store    BallStore
+		expected int
+		want     error
+	}
+
+	tcs := map[string]testcase{
+		"memory store keeps balls": {
+			store:    NewMemoryBallStore(),
+			expected: 10,
+		},
+		"nop store keeps no ball": {
+			store:    NewNopBallStore(),
+			expected: 0,
+			want:     ErrBallNotFound,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.BallStore = tc.store
+			c, err := New(cfg, initialBins(4))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+
+			balls := initialBalls(10)
+			for _, ball := range balls {
+				bin, err := c.Register(ball)
+				if err != nil {
+					t.Fatalf("failed to register: %v", err)
+				}
+				if bin == nil {
+					t.Fatalf("ball should be located")
+				}
+			}
+
+			if cnt := len(c.GetBalls()); cnt != tc.expected {
+				t.Fatalf("ball count mismatch, got:%d want:%d", cnt, tc.expected)
+			}
+			if cnt, _ := tc.store.Count(); cnt != tc.expected {
+				t.Fatalf("store count mismatch, got:%d want:%d", cnt, tc.expected)
+			}
+
+			if err := c.Delete(balls[0]); !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestConsistent_Lookup(t *testing.T) {
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	for _, b := range initialBalls(10) {
+		bin, partID := c.Lookup([]byte(b.String()))
+		if bin == nil {
+			t.Fatalf("ball should be located")
+		}
+
+		located := c.Locate(b)
+		if bin.String() != located.String() || partID != c.FindPartitionID([]byte(b.String())) {
+			t.Fatalf("mismatch, got:%s, want:%s", bin.String(), located.String())
+		}
+	}
+
+	if cnt := len(c.GetBalls()); cnt != 10 {
+		t.Fatalf("lookup should not register balls, got:%d want:%d", cnt, 10)
+	}
+
+	empty := new(t, newConfig())
+	if bin, _ := empty.Lookup([]byte("key")); bin != nil {
+		t.Fatalf("empty ring should not locate, got:%s", bin.String())
+	}
+}
+
+func TestConsistent_Register(t *testing.T) {
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, b := range initialBalls(10) {
+			if _, err := c.Register(b); err != nil {
+				t.Fatalf("failed to register: %v", err)
+			}
+		}
+	}
+
+	if cnt := len(c.GetBalls()); cnt != 10 {
+		t.Fatalf("balls should not be duplicated, got:%d want:%d", cnt, 10)
+	}
+
+	for _, b := range initialBalls(10) {
+		if err := c.Delete(b); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+	}
+	if cnt := len(c.GetBalls()); cnt != 0 {
+		t.Fatalf("all balls should be deleted, got:%d", cnt)
+	}
+}
+
+func TestConsistent_Labels(t *testing.T) {
+	labels := map[string]string{"addr": "10.0.0.1:80", "zone": "us-east-1a"}
+	bin := NewBinWithLabels("node0", labels)
+
+	// modifying the passed labels should not affect the bin.
+	labels["zone"] = "modified"
+
+	c := new(t, newConfig())
+	var events []Event
+	c.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+	if err := c.Add(bin); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+
+	want := map[string]string{"addr": "10.0.0.1:80", "zone": "us-east-1a"}
+	got, err := c.GetBin("node0")
+	if err != nil {
+		t.Fatalf("failed to get bin: %v", err)
+	}
+	if diff := cmp.Diff(got.Labels, want); diff != "" {
+		t.Fatalf("labels mismatch (-got,+want):%s", diff)
+	}
+
+	// modifying the returned labels should not affect the ring.
+	got.Labels["zone"] = "modified"
+
+	owner := c.GetPartitionOwner(0)
+	if diff := cmp.Diff(owner.Labels, want); diff != "" {
+		t.Fatalf("labels mismatch (-got,+want):%s", diff)
+	}
+	if diff := cmp.Diff(c.GetBins()[0].Labels, want); diff != "" {
+		t.Fatalf("labels mismatch (-got,+want):%s", diff)
+	}
+	if diff := cmp.Diff(c.Snapshot().GetBins()[0].Labels, want); diff != "" {
+		t.Fatalf("labels mismatch (-got,+want):%s", diff)
+	}
+
+	if err := c.Remove(NewBin("node0")); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	for _, e := range events {
+		if diff := cmp.Diff(e.Bin.Labels, want); diff != "" {
+			t.Fatalf("labels of %s event mismatch (-got,+want):%s", e.Type, diff)
+		}
+	}
+}
+
+func TestConsistent_PartitionIDs(t *testing.T) {
+	cfg := newConfig()
+	c := new(t, cfg)
+
+	check := func(t *testing.T) {
+		t.Helper()
+
+		owned := map[PartitionID]string{}
+		for _, bin := range c.GetBins() {
+			got, err := c.GetBin(bin.String())
+			if err != nil {
+				t.Fatalf("failed to get bin: %v", err)
+			}
+			if len(got.PartitionIDs) != int(c.LoadDistribution()[bin.String()]) {
+				t.Fatalf("partitions of %s mismatch, got:%v", bin.String(), got.PartitionIDs)
+			}
+			for _, partID := range got.PartitionIDs {
+				owned[partID] = bin.String()
+			}
+		}
+
+		if len(owned) != int(cfg.Partition) {
+			t.Fatalf("all partitions should be owned, got:%d want:%d", len(owned), cfg.Partition)
+		}
+		for partID, name := range owned {
+			owner := c.GetPartitionOwner(partID)
+			if owner.String() != name {
+				t.Fatalf("owner of partition %d mismatch, got:%s, want:%s", partID, owner.String(), name)
+			}
+		}
+	}
+
+	bins := initialBins(5)
+	for _, bin := range bins {
+		if err := c.Add(bin); err != nil {
+			t.Fatalf("failed to add bin: %v", err)
+		}
+		check(t)
+	}
+
+	before, err := c.GetBin(bins[1].String())
+	if err != nil {
+		t.Fatalf("failed to get bin: %v", err)
+	}
+	want := append([]PartitionID{}, before.PartitionIDs...)
+
+	if err := c.Remove(bins[0]); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	check(t)
+
+	// the copies returned before the change should keep their partitions.
+	if diff := cmp.Diff(before.PartitionIDs, want); diff != "" {
+		t.Fatalf("returned copy changed (-got,+want):%s", diff)
+	}
+}
+
+func TestConsistent_Subscribe(t *testing.T) {
+	c := new(t, newConfig())
+
+	var events []Event
+	unsubscribe := c.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+
+	bins := initialBins(2)
+	for _, bin := range bins {
+		if err := c.Add(bin); err != nil {
+			t.Fatalf("failed to add bin: %v", err)
+		}
+	}
+	if err := c.Remove(bins[0]); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	if err := c.Remove(NewBin("not exist")); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+
+	unsubscribe()
+	if err := c.Add(NewBin("unsubscribed")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+
+	want := []EventType{EventBinAdded, EventBinAdded, EventBinRemoved}
+	if len(events) != len(want) {
+		t.Fatalf("number of events mismatch, got:%d, want:%d", len(events), len(want))
+	}
+	for i, e := range events {
+		if e.Type != want[i] {
+			t.Fatalf("event type mismatch, got:%s, want:%s", e.Type, want[i])
+		}
+	}
+
+	if events[0].Moved != int(newConfig().Partition) {
+		t.Fatalf("all partitions should move to the first bin, got:%d", events[0].Moved)
+	}
+
+	if _, exist := c.LoadDistribution()[bins[0].String()]; exist {
+		t.Fatalf("removed bin should not own partitions")
+	}
+}
+
+func TestConsistent_Context(t *testing.T) {
+	type testcase struct {
+		change func(ctx context.Context, c *Consistent) error
+	}
+
+	tcs := map[string]testcase{
+		"add": {
+			change: func(ctx context.Context, c *Consistent) error {
+				return c.AddContext(ctx, NewBin("new"))
+			},
+		},
+		"remove": {
+			change: func(ctx context.Context, c *Consistent) error {
+				return c.RemoveContext(ctx, initialBins(1)[0])
+			},
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.Partition = 3 * progressInterval
+			var c *Consistent
+			var reports []uint64
+			cfg.Progress = func(done, total uint64) {
+				if total != cfg.Partition {
+					t.Errorf("total mismatch, got:%d, want:%d", total, cfg.Partition)
+				}
+				reports = append(reports, done)
+				if c != nil {
+					// the readers should not be blocked during the rebuild.
+					c.GetBins()
+				}
+			}
+
+			var err error
+			if c, err = New(cfg, initialBins(4)); err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+			if diff := cmp.Diff(reports, []uint64{progressInterval, 2 * progressInterval, cfg.Partition}); diff != "" {
+				t.Fatalf("progress mismatch (-got,+want):%s", diff)
+			}
+			want := owners(c)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if err := tc.change(ctx, c); !errors.Is(err, context.Canceled) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, context.Canceled)
+			}
+			if diff := cmp.Diff(owners(c), want); diff != "" {
+				t.Fatalf("ring should be unchanged (-got,+want):%s", diff)
+			}
+
+			reports = nil
+			if err := tc.change(context.Background(), c); err != nil {
+				t.Fatalf("failed to change the ring: %v", err)
+			}
+			// the partitions are redistributed incrementally, so only the end is reported.
+			if diff := cmp.Diff(reports, []uint64{cfg.Partition}); diff != "" {
+				t.Fatalf("progress mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewContext(ctx, newConfig(), initialBins(2)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, context.Canceled)
+	}
+}
+
+func TestConsistent_MinimizeMovement(t *testing.T) {
+	type testcase struct {
+		minimize bool
+	}
+
+	tcs := map[string]testcase{
+		"default": {},
+		"minimize movement": {
+			minimize: true,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.Partition = 271
+			cfg.MinimizeMovement = tc.minimize
+			c, err := New(cfg, initialBins(4))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+			balls := initialBalls(200)
+			for _, b := range balls {
+				c.Locate(b)
+			}
+
+			var events []Event
+			c.Subscribe(func(e Event) {
+				events = append(events, e)
+			})
+
+			ops := []func() error{
+				func() error { return c.Add(NewBin("added0")) },
+				func() error { return c.Add(NewBin("added1")) },
+				func() error { return c.Remove(initialBins(1)[0]) },
+				func() error { return c.Add(NewBin("added2")) },
+				func() error { return c.Remove(NewBin("added1")) },
+			}
+			for i, op := range ops {
+				before := map[string]string{}
+				for _, b := range balls {
+					bin, _ := c.Lookup([]byte(b.String()))
+					before[b.String()] = bin.String()
+				}
+				if err := op(); err != nil {
+					t.Fatalf("failed to change the ring: %v", err)
+				}
+
+				var ballsMoved int
+				for _, b := range balls {
+					if bin, _ := c.Lookup([]byte(b.String())); bin.String() != before[b.String()] {
+						ballsMoved++
+					}
+				}
+
+				e := events[i]
+				if e.BallsMoved != ballsMoved {
+					t.Fatalf("balls moved mismatch, got:%d, want:%d", e.BallsMoved, ballsMoved)
+				}
+				if tc.minimize && e.Moved != e.MinimumMoved {
+					t.Fatalf("moved should be the minimum, got:%d, want:%d", e.Moved, e.MinimumMoved)
+				}
+				if e.Moved < e.MinimumMoved {
+					t.Fatalf("moved should not be less than the minimum, got:%d, minimum:%d", e.Moved, e.MinimumMoved)
+				}
+
+				var total float64
+				for name, load := range c.LoadDistribution() {
+					if load > c.MaximumLoad() {
+						t.Fatalf("load of %s exceeds the maximum, got:%f, want:%f", name, load, c.MaximumLoad())
+					}
+					total += load
+				}
+				if total != float64(cfg.Partition) {
+					t.Fatalf("all partitions should be owned, got:%f", total)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkConsistent_FindPartitionID(b *testing.B) {
 	cfg := newConfig()
 	c, err := New(cfg, nil)
@@ -635,6 +1137,23 @@ func BenchmarkConsistent_FindPartitionID(b *testing.B) {
 	}
 }
 
+func BenchmarkConsistent_Lookup(b *testing.B) {
+	cfg := newConfig()
+	c, err := New(cfg, nil)
+	if err != nil {
+		b.Errorf("failed: %v", err)
+	}
+
+	for _, bin := range initialBins(100) {
+		c.Add(bin)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Lookup([]byte(fmt.Sprintf("%s%d", ballPrefix, i)))
+	}
+}
+
 func BenchmarkConsistent_LoadDistribution(b *testing.B) {
 	cfg := newConfig()
 	c, err := New(cfg, nil)
@@ -789,24 +1308,3 @@ func BenchmarkConsistent_MaximumLoad(b *testing.B) {
 		_ = c.MaximumLoad()
 	}
 }
-
-func BenchmarkConsistent_Relocate(b *testing.B) {
-	cfg := newConfig()
-	c, err := New(cfg, nil)
-	if err != nil {
-		b.Errorf("failed: %v", err)
-	}
-
-	for _, bin := range initialBins(100) {
-		c.Add(bin)
-	}
-
-	for i := 0; i < 100; i++ {
-		c.Locate(ball([]byte(fmt.Sprintf("%s%d", ballPrefix, i))))
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		c.relocate()
-	}
-}
@@ -0,0 +1,247 @@
+// Package coordinator shares a single partition table between many processes.
+//
+// A Leader owns the consistent hash ring and publishes every membership change with the version of the
+// ring after the change. Followers fetch the changes from a Source, which is the Leader itself in process
+// or an HTTPSource over the network, and apply them to their own ring. A follower which has no state or
+// is too far behind receives a snapshot of the ring, and the others receive only the changes since their
+// version, so every follower ends up with the same partition table as the leader.
+//
+// The version of the ring is attached to the lookups, so the requests routed by a ring can be checked
+// against the ring of the receiver by Follower.Accept.
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/KeisukeYamashita/consistent"
+)
+
+const (
+	// DefaultHistory is the default number of the changes kept by the leader to send them as deltas.
+	DefaultHistory = 1024
+)
+
+var (
+	// ErrNoRing represents an error which means the ring is not configured.
+	ErrNoRing = errors.New("ring is required")
+
+	// ErrNoSource represents an error which means the source of the updates is not configured.
+	ErrNoSource = errors.New("source is required")
+
+	// ErrNoConfig represents an error which means the config of the ring is not configured.
+	ErrNoConfig = errors.New("config is required")
+
+	// ErrNotSynced represents an error which means the follower has not received the ring yet.
+	ErrNotSynced = errors.New("follower is not synced")
+
+	// ErrStaleRequest represents an error which means the request was routed by an older version of the ring.
+	ErrStaleRequest = errors.New("request is routed by a stale ring")
+
+	// ErrStaleFollower represents an error which means the request was routed by a newer version of the ring
+	// than the follower has.
+	ErrStaleFollower = errors.New("follower is stale")
+
+	// ErrVersionGap represents an error which means the update doesn't follow the version of the follower.
+	ErrVersionGap = errors.New("update doesn't follow the version")
+)
+
+// Op represents the kind of a membership change.
+type Op string
+
+const (
+	// OpAdd adds the bin to the ring.
+	OpAdd Op = "add"
+
+	// OpRemove removes the bin from the ring.
+	OpRemove Op = "remove"
+)
+
+// Change represents a membership change of the ring.
+type Change struct {
+	// Version is the version of the ring after the change.
+	Version uint64 `json:"version"`
+
+	// Op is the kind of the change.
+	Op Op `json:"op"`
+
+	// Bin is the added or removed bin.
+	Bin consistent.BinState `json:"bin"`
+}
+
+// Update represents the changes of the ring sent to a follower.
+// It has either the snapshot or the changes following the version of the follower.
+// It has neither of them if the ring has not changed while the follower was waiting.
+type Update struct {
+	// Version is the version of the ring of the leader.
+	Version uint64 `json:"version"`
+
+	// Snapshot is the whole state of the ring at the version.
+	Snapshot *consistent.State `json:"snapshot,omitempty"`
+
+	// Changes are the changes since the version of the follower in ascending order of the version.
+	Changes []Change `json:"changes,omitempty"`
+}
+
+// Source provides the updates of the ring to the followers.
+type Source interface {
+	// Fetch returns the update after the version. The version is zero if the follower has no state.
+	// It waits for a change until the context is done if the version is the latest one, and then
+	// returns an update without the snapshot and the changes.
+	Fetch(ctx context.Context, since uint64) (*Update, error)
+}
+
+// LeaderConfig represents a configuration of the leader.
+type LeaderConfig struct {
+	// History is the number of the changes kept to send them as deltas.
+	// The followers behind the history receive the snapshot.
+	History int
+}
+
+// Leader owns the ring and publishes its versions to the followers.
+// The leader subscribes to the events of the ring, so the followers are woken by every change of the ring,
+// including the changes made on the ring directly, e.g. by a health monitor. The changes other than the
+// membership, e.g. the pins, are not published as deltas, so the followers receive the snapshot after them.
+type Leader struct {
+	ring        *consistent.Consistent
+	history     int
+	unsubscribe func()
+
+	// mu guards the recorded changes and the version they lead to.
+	mu      sync.Mutex
+	version uint64
+	changes []Change
+
+	// changed is closed and replaced when the ring changes.
+	changed chan struct{}
+}
+
+// NewLeader generates a leader which owns the ring. The versions are the versions of the ring.
+func NewLeader(ring *consistent.Consistent, cfg LeaderConfig) (*Leader, error) {
+	if ring == nil {
+		return nil, ErrNoRing
+	}
+	if cfg.History <= 0 {
+		cfg.History = DefaultHistory
+	}
+
+	l := &Leader{
+		ring:    ring,
+		history: cfg.History,
+		changed: make(chan struct{}),
+	}
+
+	// the version is taken after subscribing, so no change is missed between them.
+	l.mu.Lock()
+	l.unsubscribe = ring.Subscribe(l.record)
+	if v := ring.Version(); v > l.version {
+		l.version = v
+	}
+	l.mu.Unlock()
+	return l, nil
+}
+
+// Close unsubscribes the leader from the ring. The followers are not woken by the changes after it.
+func (l *Leader) Close() {
+	l.unsubscribe()
+}
+
+// Add adds the bin to the ring and publishes the new version.
+func (l *Leader) Add(bin consistent.Bin) error {
+	return l.ring.Add(bin)
+}
+
+// Remove removes the bin from the ring and publishes the new version.
+// It does nothing if the bin doesn't exist.
+func (l *Leader) Remove(bin consistent.Bin) error {
+	return l.ring.Remove(bin)
+}
+
+// record records the membership change of the event and wakes the followers.
+// It's called by the ring synchronously in the order of the changes.
+func (l *Leader) record(e consistent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var op Op
+	switch e.Type {
+	case consistent.EventBinAdded:
+		op = OpAdd
+	case consistent.EventBinRemoved:
+		op = OpRemove
+	}
+	if op != "" {
+		l.changes = append(l.changes, Change{
+			Version: e.Version,
+			Op:      op,
+			Bin:     consistent.BinState{Name: e.Bin.Name, Labels: e.Bin.Labels},
+		})
+		if len(l.changes) > l.history {
+			l.changes = append([]Change(nil), l.changes[len(l.changes)-l.history:]...)
+		}
+	}
+
+	// the events following a change, e.g. the pins failed over, have the same version.
+	if e.Version > l.version {
+		l.version = e.Version
+		close(l.changed)
+		l.changed = make(chan struct{})
+	}
+}
+
+// Version returns the current version of the ring.
+func (l *Leader) Version() uint64 {
+	return l.ring.Version()
+}
+
+// Lookup finds a home for given key and returns the version of the ring used to find it.
+func (l *Leader) Lookup(key []byte) (*consistent.Bin, consistent.PartitionID, uint64) {
+	return l.ring.LookupWithVersion(key)
+}
+
+// Fetch returns the update after the version. It implements Source, so the followers in the same
+// process can fetch the updates from the leader directly.
+func (l *Leader) Fetch(ctx context.Context, since uint64) (*Update, error) {
+	l.mu.Lock()
+	for since == l.version {
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return &Update{Version: since}, nil
+		case <-changed:
+		}
+		l.mu.Lock()
+	}
+	defer l.mu.Unlock()
+
+	if changes, ok := l.deltas(since); ok {
+		return &Update{Version: l.version, Changes: changes}, nil
+	}
+	st := l.ring.State()
+	return &Update{Version: st.Version, Snapshot: st}, nil
+}
+
+// deltas returns the changes from the version to the version of the last event. It returns false unless
+// the recorded changes cover all versions between them, because the changes other than the membership,
+// e.g. the pins, bump the version without being recorded. The caller must hold mu.
+func (l *Leader) deltas(since uint64) ([]Change, bool) {
+	version := l.version
+	n := len(l.changes)
+	if since == 0 || since >= version || n == 0 || l.changes[n-1].Version != version {
+		return nil, false
+	}
+	if version-since > uint64(n) {
+		return nil, false
+	}
+
+	changes := l.changes[n-int(version-since):]
+	for i, ch := range changes {
+		if ch.Version != since+uint64(i)+1 {
+			return nil, false
+		}
+	}
+	return append([]Change(nil), changes...), true
+}
@@ -0,0 +1,498 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/google/go-cmp/cmp"
+)
+
+type hasher struct{}
+
+func (hs hasher) Sum64(data []byte) uint64 {
+	h := fnv.New64()
+	h.Write(data)
+	return h.Sum64()
+}
+
+func newConfig() *consistent.Config {
+	return &consistent.Config{
+		Partition:              23,
+		ReplicationFactor:      21,
+		LoadBalancingParameter: 1.25,
+		Hasher:                 hasher{},
+	}
+}
+
+func newLeader(t *testing.T, cfg LeaderConfig, cnt int) *Leader {
+	t.Helper()
+
+	bins := make([]consistent.Bin, cnt)
+	for i := range bins {
+		bins[i] = consistent.NewBin(fmt.Sprintf("node%d", i))
+	}
+	c, err := consistent.New(newConfig(), bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	l, err := NewLeader(c, cfg)
+	if err != nil {
+		t.Fatalf("failed to create leader: %v", err)
+	}
+	return l
+}
+
+func newFollower(t *testing.T, src Source) *Follower {
+	t.Helper()
+
+	f, err := NewFollower(FollowerConfig{Source: src, Config: newConfig(), PollTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create follower: %v", err)
+	}
+	return f
+}
+
+// recordSource records the updates fetched from the source.
+type recordSource struct {
+	Source
+
+	mu      sync.Mutex
+	updates []*Update
+}
+
+func (s *recordSource) Fetch(ctx context.Context, since uint64) (*Update, error) {
+	u, err := s.Source.Fetch(ctx, since)
+	if err == nil {
+		s.mu.Lock()
+		s.updates = append(s.updates, u)
+		s.mu.Unlock()
+	}
+	return u, err
+}
+
+// kinds returns the kinds of the recorded updates.
+func (s *recordSource) kinds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]string, len(s.updates))
+	for i, u := range s.updates {
+		switch {
+		case u.Snapshot != nil:
+			res[i] = "snapshot"
+		case len(u.Changes) > 0:
+			res[i] = fmt.Sprintf("delta%d", len(u.Changes))
+		default:
+			res[i] = "none"
+		}
+	}
+	return res
+}
+
+// assertSynced checks that the follower has the same partition table as the leader.
+func assertSynced(t *testing.T, l *Leader, f *Follower) {
+	t.Helper()
+
+	if got, want := f.Version(), l.Version(); got != want {
+		t.Fatalf("unexpected version: got:%d want:%d", got, want)
+	}
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		want, _, _ := l.Lookup(key)
+		got, _, _, err := f.Lookup(key)
+		if err != nil {
+			t.Fatalf("failed to lookup: %v", err)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Fatalf("mismatch (-got,+want):%s", diff)
+		}
+	}
+}
+
+func TestFollower_Sync(t *testing.T) {
+	l := newLeader(t, LeaderConfig{History: 2}, 3)
+	src := &recordSource{Source: l}
+	f := newFollower(t, src)
+	ctx := context.Background()
+
+	if _, _, _, err := f.Lookup([]byte("key")); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrNotSynced)
+	}
+	if err := f.Sync(ctx); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	assertSynced(t, l, f)
+
+	// the changes within the history are sent as a delta.
+	if err := l.Add(consistent.NewBinWithLabels("extra", map[string]string{"zone": "a"})); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if err := l.Remove(consistent.NewBin("node0")); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	if err := l.Remove(consistent.NewBin("unknown")); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	if err := f.Sync(ctx); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	assertSynced(t, l, f)
+	bin, err := f.ring.GetBin("extra")
+	if err != nil {
+		t.Fatalf("failed to get bin: %v", err)
+	}
+	if diff := cmp.Diff(bin.Labels, map[string]string{"zone": "a"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	// the follower behind the history receives the snapshot.
+	for _, name := range []string{"a", "b", "c"} {
+		if err := l.Add(consistent.NewBin(name)); err != nil {
+			t.Fatalf("failed to add bin: %v", err)
+		}
+	}
+	if err := f.Sync(ctx); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	assertSynced(t, l, f)
+
+	// the follower waits for a change until the context is done.
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := f.Sync(ctx2); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+
+	if diff := cmp.Diff(src.kinds(), []string{"snapshot", "delta2", "snapshot", "none"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestFollower_SyncEjected(t *testing.T) {
+	l := newLeader(t, LeaderConfig{}, 3)
+	f := newFollower(t, l)
+	ctx := context.Background()
+
+	if err := l.ring.Eject("node1"); err != nil {
+		t.Fatalf("failed to eject: %v", err)
+	}
+	if err := f.Sync(ctx); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	assertSynced(t, l, f)
+	if diff := cmp.Diff(f.ring.Ejected(), []string{"node1"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	// the ejected bin is kept by the deltas.
+	if err := l.Add(consistent.NewBin("extra")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if err := f.Sync(ctx); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	assertSynced(t, l, f)
+}
+
+// fixedSource returns the updates in order.
+type fixedSource struct {
+	mu      sync.Mutex
+	updates []*Update
+	since   []uint64
+}
+
+func (s *fixedSource) Fetch(_ context.Context, since uint64) (*Update, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.since = append(s.since, since)
+	u := s.updates[0]
+	s.updates = s.updates[1:]
+	return u, nil
+}
+
+func TestFollower_VersionGap(t *testing.T) {
+	l := newLeader(t, LeaderConfig{}, 3)
+	snapshot, err := l.Fetch(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+
+	src := &fixedSource{updates: []*Update{
+		snapshot,
+		{Version: 3, Changes: []Change{{Version: 3, Op: OpAdd, Bin: consistent.BinState{Name: "extra"}}}},
+		snapshot,
+	}}
+	f := newFollower(t, src)
+	ctx := context.Background()
+	for i, want := range []error{nil, ErrVersionGap, nil} {
+		if err := f.Sync(ctx); !errors.Is(err, want) {
+			t.Fatalf("error unexpected at %d: got:%v want:%v", i, err, want)
+		}
+	}
+
+	// the follower fetches the snapshot again after the gap.
+	if diff := cmp.Diff(src.since, []uint64{0, 1, 0}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestFollower_Accept(t *testing.T) {
+	l := newLeader(t, LeaderConfig{}, 3)
+	f := newFollower(t, l)
+	now := time.Unix(0, 0)
+	f.now = func() time.Time { return now }
+
+	if err := f.Accept(1); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrNotSynced)
+	}
+	if !f.Stale() {
+		t.Fatal("follower should be stale before synced")
+	}
+	if err := l.Add(consistent.NewBin("extra")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if err := f.Sync(context.Background()); err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+	if f.Stale() {
+		t.Fatal("follower should not be stale after synced")
+	}
+
+	type testcase struct {
+		version uint64
+		want    error
+	}
+	tcs := map[string]testcase{
+		"same version": {
+			version: 2,
+		},
+		"older version": {
+			version: 1,
+			want:    ErrStaleRequest,
+		},
+		"newer version": {
+			version: 3,
+			want:    ErrStaleFollower,
+		},
+	}
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			if err := f.Accept(tc.version); !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+		})
+	}
+
+	now = now.Add(time.Second)
+	if !f.Stale() {
+		t.Fatal("follower should be stale after the fetches fail")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	l := newLeader(t, LeaderConfig{}, 3)
+	srv := httptest.NewServer(l)
+	defer srv.Close()
+
+	f := newFollower(t, &HTTPSource{URL: srv.URL})
+	f.Start()
+	defer f.Stop()
+
+	eventually := func() {
+		t.Helper()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for f.Version() != l.Version() {
+			if time.Now().After(deadline) {
+				t.Fatalf("follower should be synced: got:%d want:%d", f.Version(), l.Version())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		assertSynced(t, l, f)
+	}
+
+	eventually()
+	for i := 0; i < 3; i++ {
+		if err := l.Add(consistent.NewBin(fmt.Sprintf("extra%d", i))); err != nil {
+			t.Fatalf("failed to add bin: %v", err)
+		}
+		eventually()
+	}
+	if err := l.Remove(consistent.NewBin("node1")); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	eventually()
+}
+
+func TestLeader_FetchUnrecordedVersion(t *testing.T) {
+	l := newLeader(t, LeaderConfig{}, 0)
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b"} {
+		if err := l.Add(consistent.NewBin(name)); err != nil {
+			t.Fatalf("failed to add bin: %v", err)
+		}
+	}
+	// the pin bumps the version without being recorded.
+	if err := l.ring.Pin(0, "a"); err != nil {
+		t.Fatalf("failed to pin: %v", err)
+	}
+	if err := l.Add(consistent.NewBin("c")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+
+	type testcase struct {
+		since uint64
+		want  string
+	}
+	tcs := map[string]testcase{
+		"behind the pin": {
+			since: 1,
+			want:  "snapshot",
+		},
+		"just before the pin": {
+			since: 3,
+			want:  "snapshot",
+		},
+		"after the pin": {
+			since: 4,
+			want:  "delta1",
+		},
+	}
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			src := &recordSource{Source: l}
+			if _, err := src.Fetch(ctx, tc.since); err != nil {
+				t.Fatalf("failed to fetch: %v", err)
+			}
+			if diff := cmp.Diff(src.kinds(), []string{tc.want}); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestLeader_FetchWoken(t *testing.T) {
+	type testcase struct {
+		prepare func(ring *consistent.Consistent) error
+		change  func(ring *consistent.Consistent) error
+		want    string
+	}
+
+	// the changes are made on the ring directly, not through the leader.
+	tcs := map[string]testcase{
+		"add": {
+			change: func(ring *consistent.Consistent) error {
+				return ring.Add(consistent.NewBin("extra"))
+			},
+			want: "delta1",
+		},
+		"remove": {
+			change: func(ring *consistent.Consistent) error {
+				return ring.Remove(consistent.NewBin("node1"))
+			},
+			want: "delta1",
+		},
+		"pin": {
+			change: func(ring *consistent.Consistent) error {
+				return ring.Pin(0, "node1")
+			},
+			want: "snapshot",
+		},
+		"unpin": {
+			prepare: func(ring *consistent.Consistent) error {
+				return ring.Pin(0, "node1")
+			},
+			change: func(ring *consistent.Consistent) error {
+				return ring.Unpin(0)
+			},
+			want: "snapshot",
+		},
+		"eject": {
+			change: func(ring *consistent.Consistent) error {
+				return ring.Eject("node1")
+			},
+			want: "snapshot",
+		},
+		"reinstate": {
+			prepare: func(ring *consistent.Consistent) error {
+				return ring.Eject("node1")
+			},
+			change: func(ring *consistent.Consistent) error {
+				return ring.Reinstate("node1")
+			},
+			want: "snapshot",
+		},
+		"set override": {
+			change: func(ring *consistent.Consistent) error {
+				return ring.SetOverride(consistent.Override{Key: "key", Bin: "node1"}, 0)
+			},
+			want: "snapshot",
+		},
+		"delete override": {
+			prepare: func(ring *consistent.Consistent) error {
+				return ring.SetOverride(consistent.Override{Key: "key", Bin: "node1"}, 0)
+			},
+			change: func(ring *consistent.Consistent) error {
+				ring.DeleteOverride("key", false)
+				return nil
+			},
+			want: "snapshot",
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			l := newLeader(t, LeaderConfig{}, 3)
+			if tc.prepare != nil {
+				if err := tc.prepare(l.ring); err != nil {
+					t.Fatalf("failed to prepare: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			since := l.Version()
+			src := &recordSource{Source: l}
+			res := make(chan *Update, 1)
+			go func() {
+				u, err := src.Fetch(ctx, since)
+				if err != nil {
+					t.Errorf("failed to fetch: %v", err)
+				}
+				res <- u
+			}()
+
+			if err := tc.change(l.ring); err != nil {
+				t.Fatalf("failed to change: %v", err)
+			}
+			u := <-res
+			if ctx.Err() != nil {
+				t.Fatal("fetch should be woken by the change")
+			}
+			if u.Version != since+1 {
+				t.Fatalf("unexpected version: got:%d want:%d", u.Version, since+1)
+			}
+			if diff := cmp.Diff(src.kinds(), []string{tc.want}); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
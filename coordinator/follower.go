@@ -0,0 +1,236 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+)
+
+const (
+	// DefaultPollTimeout is the default time a follower waits for a change in a fetch.
+	DefaultPollTimeout = 30 * time.Second
+
+	// DefaultRetryInterval is the default time a follower waits after a failed fetch.
+	DefaultRetryInterval = time.Second
+)
+
+// FollowerConfig represents a configuration of the follower.
+type FollowerConfig struct {
+	// Source provides the updates of the ring.
+	Source Source
+
+	// Config is the config of the ring of the follower. It must be the same as the ring of the leader
+	// except for the number of partitions and the placement version, which are taken from the snapshot.
+	Config *consistent.Config
+
+	// PollTimeout is the time to wait for a change in a fetch.
+	PollTimeout time.Duration
+
+	// RetryInterval is the time to wait after a failed fetch.
+	RetryInterval time.Duration
+
+	// StaleAfter is the time after the last successful fetch the follower considers itself stale.
+	// It's twice PollTimeout if it's zero.
+	StaleAfter time.Duration
+
+	// OnError is called when a fetch or an update fails.
+	OnError func(err error)
+}
+
+// Follower keeps a copy of the ring of the leader.
+type Follower struct {
+	cfg FollowerConfig
+
+	mu      sync.RWMutex
+	ring    *consistent.Consistent
+	version uint64
+	latest  uint64
+	synced  time.Time
+
+	now func() time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewFollower generates a new follower by passed config.
+// The follower doesn't have the ring until it's synced by Sync or Start.
+func NewFollower(cfg FollowerConfig) (*Follower, error) {
+	if cfg.Source == nil {
+		return nil, ErrNoSource
+	}
+	if cfg.Config == nil {
+		return nil, ErrNoConfig
+	}
+
+	if cfg.PollTimeout <= 0 {
+		cfg.PollTimeout = DefaultPollTimeout
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	if cfg.StaleAfter <= 0 {
+		cfg.StaleAfter = 2 * cfg.PollTimeout
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Follower{
+		cfg:    cfg,
+		now:    time.Now,
+		ctx:    ctx,
+		cancel: cancel,
+	}, nil
+}
+
+// Start keeps fetching the updates until Stop is called.
+func (f *Follower) Start() {
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+
+		for f.ctx.Err() == nil {
+			ctx, cancel := context.WithTimeout(f.ctx, f.cfg.PollTimeout)
+			err := f.Sync(ctx)
+			cancel()
+			if err == nil || f.ctx.Err() != nil {
+				continue
+			}
+
+			f.cfg.OnError(err)
+			select {
+			case <-f.ctx.Done():
+			case <-time.After(f.cfg.RetryInterval):
+			}
+		}
+	}()
+}
+
+// Stop stops fetching the updates. The follower keeps the ring.
+func (f *Follower) Stop() {
+	f.cancel()
+	f.wg.Wait()
+}
+
+// Sync fetches an update and applies it. It waits for a change until the context is done if the follower
+// has the latest version. The follower fetches the snapshot next time if the update can't be applied.
+func (f *Follower) Sync(ctx context.Context) error {
+	f.mu.RLock()
+	since := f.version
+	f.mu.RUnlock()
+
+	u, err := f.cfg.Source.Fetch(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	// the ring is replaced only by Sync, and Start calls it sequentially.
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.apply(u); err != nil {
+		f.version = 0
+		return err
+	}
+	f.synced = f.now()
+	if u.Version > f.latest {
+		f.latest = u.Version
+	}
+	return nil
+}
+
+// apply applies the update to the ring. The caller must hold mu.
+func (f *Follower) apply(u *Update) error {
+	if u.Snapshot != nil {
+		cfg := *f.cfg.Config
+		cfg.Partition = u.Snapshot.Partition
+		cfg.PlacementVersion = u.Snapshot.PlacementVersion
+		ring, err := consistent.Restore(&cfg, u.Snapshot)
+		if err != nil {
+			return err
+		}
+		f.ring = ring
+		f.version = ring.Version()
+		return nil
+	}
+
+	for _, ch := range u.Changes {
+		if f.ring == nil || ch.Version != f.version+1 {
+			return fmt.Errorf("%w: got:%d want:%d", ErrVersionGap, ch.Version, f.version+1)
+		}
+
+		// the ring of the follower is changed only by the updates, so it's at the version of the follower.
+		bin := consistent.NewBinWithLabels(ch.Bin.Name, ch.Bin.Labels)
+		var err error
+		switch ch.Op {
+		case OpAdd:
+			err = f.ring.AddIfVersion(bin, f.version)
+		case OpRemove:
+			err = f.ring.RemoveIfVersion(bin, f.version)
+		default:
+			err = fmt.Errorf("unknown op: %q", ch.Op)
+		}
+		if err != nil {
+			return err
+		}
+		if v := f.ring.Version(); v != ch.Version {
+			return fmt.Errorf("%w: got:%d want:%d", ErrVersionGap, v, ch.Version)
+		}
+		f.version = ch.Version
+	}
+	return nil
+}
+
+// Version returns the version of the ring of the follower. It's zero if the follower is not synced.
+func (f *Follower) Version() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.version
+}
+
+// Stale reports whether the follower may be behind the leader, namely it has not fetched an update
+// successfully for StaleAfter or it knows a newer version than it has.
+func (f *Follower) Stale() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.version == 0 || f.version < f.latest || f.now().Sub(f.synced) > f.cfg.StaleAfter
+}
+
+// Lookup finds a home for given key and returns the version of the ring used to find it.
+func (f *Follower) Lookup(key []byte) (*consistent.Bin, consistent.PartitionID, uint64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.ring == nil {
+		return nil, 0, 0, ErrNotSynced
+	}
+	bin, partID, version := f.ring.LookupWithVersion(key)
+	return bin, partID, version, nil
+}
+
+// Accept checks that the request routed by the version of the ring can be served by the follower.
+// It returns ErrStaleRequest if the request was routed by an older version, and ErrStaleFollower if the
+// follower is behind the version. The follower is synced by itself, so the latter is usually transient.
+func (f *Follower) Accept(version uint64) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	switch {
+	case f.ring == nil:
+		return ErrNotSynced
+	case version < f.version:
+		return fmt.Errorf("%w: got:%d want:%d", ErrStaleRequest, version, f.version)
+	case version > f.version:
+		return fmt.Errorf("%w: got:%d want:%d", ErrStaleFollower, f.version, version)
+	default:
+		return nil
+	}
+}
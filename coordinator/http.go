@@ -0,0 +1,109 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// MaxWait is the maximum time the leader waits for a change in an HTTP request.
+const MaxWait = 5 * time.Minute
+
+// ServeHTTP serves the updates to the HTTPSource of the followers.
+// The request has the version of the follower in the since parameter and the time to wait for a change
+// in the wait parameter, e.g. GET /?since=3&wait=30s. The update is written in JSON.
+func (l *Leader) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	var since uint64
+	if s := q.Get("since"); s != "" {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since = v
+	}
+	var wait time.Duration
+	if s := q.Get("wait"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			http.Error(w, "invalid wait: "+s, http.StatusBadRequest)
+			return
+		}
+		wait = d
+	}
+	if wait > MaxWait {
+		wait = MaxWait
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+	u, err := l.Fetch(ctx, since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(u)
+}
+
+// HTTPSource fetches the updates from the leader served over HTTP.
+type HTTPSource struct {
+	// URL is the URL which the leader is served at.
+	URL string
+
+	// Client sends the requests. http.DefaultClient is used if it's nil.
+	Client *http.Client
+}
+
+// Fetch fetches the update after the version from the leader.
+// The leader waits for a change until the deadline of the context.
+func (s *HTTPSource) Fetch(ctx context.Context, since uint64) (*Update, error) {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("since", strconv.FormatUint(since, 10))
+	if deadline, ok := ctx.Deadline(); ok {
+		// leave the time for the response to come back before the deadline.
+		if wait := time.Until(deadline) * 9 / 10; wait > 0 {
+			q.Set("wait", wait.String())
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	var res Update
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
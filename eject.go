@@ -0,0 +1,120 @@
+package consistent
+
+import "sort"
+
+// Eject skips the bin in the lookups without rebuilding the ring.
+// The partitions of the bin are served by the next bin clockwise which is not ejected, regardless of
+// the maximum load, until the bin is reinstated. The bin keeps owning the partitions, so reinstating
+// it moves nothing back but the lookups. It does nothing if the bin is already ejected.
+// It returns ErrInsufficientBins if the bin is the last one which is not ejected.
+func (c *Consistent) Eject(name string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	bin, ok := c.table.bins[name]
+	if !ok {
+		return &BinError{Name: name, Err: ErrBinNotFound}
+	}
+	if c.table.ejected[name] {
+		return nil
+	}
+	if len(c.table.ejected)+1 >= len(c.table.bins) {
+		return &BinError{Name: name, Err: ErrInsufficientBins}
+	}
+
+	t := c.table.withEjected(name, true)
+	c.mu.Lock()
+	c.table = t
+	c.mu.Unlock()
+
+	c.emit(Event{Type: EventBinEjected, Bin: bin.clone(), Partitions: bin.PartitionIDs, Version: t.version})
+	return nil
+}
+
+// Reinstate brings the ejected bin back to the lookups.
+// It does nothing if the bin is not ejected.
+func (c *Consistent) Reinstate(name string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	bin, ok := c.table.bins[name]
+	if !ok {
+		return &BinError{Name: name, Err: ErrBinNotFound}
+	}
+	if !c.table.ejected[name] {
+		return nil
+	}
+
+	t := c.table.withEjected(name, false)
+	c.mu.Lock()
+	c.table = t
+	c.mu.Unlock()
+
+	c.emit(Event{Type: EventBinReinstated, Bin: bin.clone(), Partitions: bin.PartitionIDs, Version: t.version})
+	return nil
+}
+
+// Ejected returns the names of the ejected bins in ascending order.
+func (c *Consistent) Ejected() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.table.ejected))
+	for name := range c.table.ejected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withEjected returns a copy of the table which has the bin ejected or reinstated.
+// The table is immutable, so the copy shares everything but the ejected bins and the failover.
+func (t *table) withEjected(name string, ejected bool) *table {
+	t2 := *t
+	t2.version++
+	t2.ejected = make(map[string]bool, len(t.ejected)+1)
+	for n := range t.ejected {
+		t2.ejected[n] = true
+	}
+	if ejected {
+		t2.ejected[name] = true
+	} else {
+		delete(t2.ejected, name)
+	}
+	t2.updateFailover()
+	return &t2
+}
+
+// updateFailover finds the bins serving the partitions of the ejected bins.
+// Each partition is served by the first bin clockwise from the partition which is not ejected.
+// The owner keeps serving the partition if every bin is ejected.
+func (t *table) updateFailover() {
+	t.failover = nil
+	if len(t.ejected) == 0 || len(t.partitions) == 0 {
+		return
+	}
+
+	failover := make([]*Bin, len(t.partitions))
+	bs := make([]byte, 8)
+	for partID, bin := range t.partitions {
+		if !t.ejected[bin.String()] {
+			continue
+		}
+
+		var h uint64
+		if t.keys != nil {
+			h = t.keys.hashes[partID]
+		} else {
+			h = t.hasher.Sum64(t.partitionKey(bs, uint64(partID)))
+		}
+		idx := t.successor(h)
+		for i := 0; i < len(t.sortedSet); i++ {
+			b := t.ring[t.sortedSet[(idx+i)%len(t.sortedSet)]]
+			if !t.ejected[b.String()] {
+				failover[partID] = b
+				break
+			}
+		}
+	}
+	t.failover = failover
+}
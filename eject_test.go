@@ -0,0 +1,110 @@
+package consistent
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConsistent_Eject(t *testing.T) {
+	cfg := newConfig()
+	cfg.Partition = 271
+	bins := initialBins(4)
+	c, err := New(cfg, bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	prev := c.LoadDistribution()
+
+	var events []Event
+	c.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+
+	ejected := bins[0].String()
+	if err := c.Eject(ejected); err != nil {
+		t.Fatalf("failed to eject bin: %v", err)
+	}
+	if diff := cmp.Diff(c.Ejected(), []string{ejected}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	// the partitions are not distributed again.
+	if diff := cmp.Diff(c.LoadDistribution(), prev); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	served := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		bin, _ := c.Lookup([]byte(fmt.Sprintf("key%d", i)))
+		served[bin.String()]++
+	}
+	if served[ejected] != 0 {
+		t.Fatalf("ejected bin should not serve keys: got:%d", served[ejected])
+	}
+	if len(served) != len(bins)-1 {
+		t.Fatalf("unexpected bins: got:%v", served)
+	}
+	bin, _ := c.GetBin(ejected)
+	for _, partID := range bin.PartitionIDs {
+		if owner := c.GetPartitionOwner(partID); owner.String() == ejected {
+			t.Fatalf("ejected bin should not serve partition %d", partID)
+		}
+	}
+
+	if err := c.Reinstate(ejected); err != nil {
+		t.Fatalf("failed to reinstate bin: %v", err)
+	}
+	if len(c.Ejected()) != 0 {
+		t.Fatalf("unexpected ejected bins: got:%v", c.Ejected())
+	}
+	for _, partID := range bin.PartitionIDs {
+		if owner := c.GetPartitionOwner(partID); owner.String() != ejected {
+			t.Fatalf("partition %d should be served by the owner: got:%s", partID, owner)
+		}
+	}
+
+	types := make([]EventType, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	if diff := cmp.Diff(types, []EventType{EventBinEjected, EventBinReinstated}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestConsistent_EjectErrors(t *testing.T) {
+	bins := initialBins(2)
+	c, err := New(newConfig(), bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	if err := c.Eject("unknown"); !errors.Is(err, ErrBinNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrBinNotFound)
+	}
+	if err := c.Reinstate("unknown"); !errors.Is(err, ErrBinNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrBinNotFound)
+	}
+	if err := c.Eject(bins[0].String()); err != nil {
+		t.Fatalf("failed to eject bin: %v", err)
+	}
+	if err := c.Eject(bins[1].String()); !errors.Is(err, ErrInsufficientBins) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrInsufficientBins)
+	}
+
+	// the ejection is dropped with the bin and kept across the rebuilds.
+	if err := c.Add(NewBin("extra")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if diff := cmp.Diff(c.Ejected(), []string{bins[0].String()}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	if err := c.Remove(bins[0]); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	if len(c.Ejected()) != 0 {
+		t.Fatalf("unexpected ejected bins: got:%v", c.Ejected())
+	}
+}
@@ -1,6 +1,9 @@
 package consistent
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	//ErrInsufficientBins represents an error which means there are not enough bins to complete the task.
@@ -15,6 +18,101 @@ var (
 	// ErrBinAlreadyExist represents an error which means requested bin already exists in the ring
 	ErrBinAlreadyExist = errors.New("bin already exist")
 
+	// ErrUnsupportedPlacementVersion represents an error which means the placement version is not supported by this package.
+	ErrUnsupportedPlacementVersion = errors.New("unsupported placement version")
+
+	// ErrInvalidPartition represents an error which means the partition ID is out of the range of the ring.
+	ErrInvalidPartition = errors.New("invalid partition")
+
+	// ErrInvalidState represents an error which means the state can't be restored by the config.
+	ErrInvalidState = errors.New("invalid state")
+
+	// ErrRingNotFound represents an error which means requested ring could not be found in the ring set.
+	ErrRingNotFound = errors.New("ring not found")
+
+	// ErrRingAlreadyExist represents an error which means requested ring already exists in the ring set.
+	ErrRingAlreadyExist = errors.New("ring already exist")
+
+	// ErrManagedRing represents an error which means the membership of the ring is managed by a ring set.
+	ErrManagedRing = errors.New("ring is managed by a ring set")
+
+	// ErrVersionConflict represents an error which means the ring has changed since the expected version.
+	ErrVersionConflict = errors.New("version conflict")
+
+	// ErrInvalidSelector represents an error which means the label selector could not be parsed.
+	ErrInvalidSelector = errors.New("invalid label selector")
+
 	// ErrInsufficientPartitionCapacity represents an error which user needs to decrease partition count, increase bin count or increase load factor.
 	ErrInsufficientPartitionCapacity = errors.New("not enough room to distribute partitions")
+
+	// ErrInvalidConfig represents an error which means a field of the config has an invalid value.
+	ErrInvalidConfig = errors.New("invalid config")
 )
+
+// CapacityError represents an error which means the partitions could not be distributed within the maximum load.
+// It matches ErrInsufficientPartitionCapacity with errors.Is.
+type CapacityError struct {
+	// Partitions is the number of partitions of the ring.
+	Partitions uint64
+
+	// Bins is the number of bins of the ring.
+	Bins int
+
+	// MaxLoad is the maximum number of partitions per bin.
+	MaxLoad float64
+
+	// LoadParam is the load balancing parameter of the ring.
+	LoadParam float64
+}
+
+// Error returns the message of the error.
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("%s: %d partitions over %d bins with maximum load %v (load balancing parameter %v)",
+		ErrInsufficientPartitionCapacity, e.Partitions, e.Bins, e.MaxLoad, e.LoadParam)
+}
+
+// Unwrap returns ErrInsufficientPartitionCapacity.
+func (e *CapacityError) Unwrap() error {
+	return ErrInsufficientPartitionCapacity
+}
+
+// ConfigError represents an error which means a field of the config is invalid.
+type ConfigError struct {
+	// Field is the name of the invalid field.
+	Field string
+
+	// Reason describes why the field is invalid.
+	Reason string
+
+	// Err is the sentinel error of the failure, ErrInvalidConfig or ErrUnsupportedPlacementVersion.
+	Err error
+}
+
+// Error returns the message of the error.
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s %s", e.Err, e.Field, e.Reason)
+}
+
+// Unwrap returns the sentinel error of the failure.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// BinError represents an error of the operation on a bin.
+type BinError struct {
+	// Name is the name of the bin.
+	Name string
+
+	// Err is the sentinel error of the failure, e.g. ErrBinNotFound or ErrBinAlreadyExist.
+	Err error
+}
+
+// Error returns the message of the error.
+func (e *BinError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.Name)
+}
+
+// Unwrap returns the sentinel error of the failure.
+func (e *BinError) Unwrap() error {
+	return e.Err
+}
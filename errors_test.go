@@ -0,0 +1,123 @@
+package consistent
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfigError(t *testing.T) {
+	type testcase struct {
+		cfg  *Config
+		want *ConfigError
+	}
+
+	tcs := map[string]testcase{
+		"no partition": {
+			cfg:  &Config{Hasher: hasher{}, ReplicationFactor: 10, LoadBalancingParameter: 1.2},
+			want: &ConfigError{Field: "Partition", Reason: "must be positive", Err: ErrInvalidConfig},
+		},
+		"too many partitions": {
+			cfg:  &Config{Hasher: hasher{}, Partition: 1 << 60, ReplicationFactor: 10, LoadBalancingParameter: 1.2},
+			want: &ConfigError{Field: "Partition", Reason: "must not exceed MaxPartition (2147483647)", Err: ErrInvalidConfig},
+		},
+		"negative replication factor": {
+			cfg:  &Config{Hasher: hasher{}, Partition: 23, ReplicationFactor: -1, LoadBalancingParameter: 1.2},
+			want: &ConfigError{Field: "ReplicationFactor", Reason: "must be positive", Err: ErrInvalidConfig},
+		},
+		"NaN load balancing parameter": {
+			cfg:  &Config{Hasher: hasher{}, Partition: 23, ReplicationFactor: 10, LoadBalancingParameter: math.NaN()},
+			want: &ConfigError{Field: "LoadBalancingParameter", Reason: "must be a positive finite number", Err: ErrInvalidConfig},
+		},
+		"negative workers": {
+			cfg:  &Config{Hasher: hasher{}, Partition: 23, ReplicationFactor: 10, LoadBalancingParameter: 1.2, Workers: -1},
+			want: &ConfigError{Field: "Workers", Reason: "must not be negative", Err: ErrInvalidConfig},
+		},
+		"unsupported placement version": {
+			cfg:  &Config{Hasher: hasher{}, Partition: 23, ReplicationFactor: 10, LoadBalancingParameter: 1.2, PlacementVersion: 2},
+			want: &ConfigError{Field: "PlacementVersion", Reason: "2 is not supported", Err: ErrUnsupportedPlacementVersion},
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			_, err := New(tc.cfg, nil)
+			var got *ConfigError
+			if !errors.As(err, &got) || !errors.Is(err, tc.want.Err) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+			if diff := cmp.Diff(*got, *tc.want, cmp.Comparer(func(x, y error) bool { return x == y })); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestBinError(t *testing.T) {
+	c, err := New(newConfig(), initialBins(2))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	type testcase struct {
+		fn   func() error
+		want *BinError
+	}
+
+	tcs := map[string]testcase{
+		"add existing bin": {
+			fn:   func() error { return c.Add(initialBins(1)[0]) },
+			want: &BinError{Name: "node0", Err: ErrBinAlreadyExist},
+		},
+		"get unknown bin": {
+			fn: func() error {
+				_, err := c.GetBin("unknown")
+				return err
+			},
+			want: &BinError{Name: "unknown", Err: ErrBinNotFound},
+		},
+		"pin to unknown bin": {
+			fn:   func() error { return c.Pin(0, "unknown") },
+			want: &BinError{Name: "unknown", Err: ErrBinNotFound},
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			err := tc.fn()
+			var got *BinError
+			if !errors.As(err, &got) || !errors.Is(err, tc.want.Err) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+			if diff := cmp.Diff(*got, *tc.want, cmp.Comparer(func(x, y error) bool { return x == y })); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestCapacityError(t *testing.T) {
+	cfg := newConfig()
+	cfg.Partition = 23
+	cfg.ReplicationFactor = 1
+	cfg.LoadBalancingParameter = 1
+
+	// every bin is filled up to the average load, so the last partitions have no room.
+	_, err := New(cfg, initialBins(3))
+	var got *CapacityError
+	if !errors.As(err, &got) || !errors.Is(err, ErrInsufficientPartitionCapacity) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrInsufficientPartitionCapacity)
+	}
+	want := &CapacityError{Partitions: 23, Bins: 3, MaxLoad: 8, LoadParam: 1}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
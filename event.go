@@ -0,0 +1,146 @@
+package consistent
+
+import "sync"
+
+// EventType represents the kind of change that happened on the ring.
+type EventType int
+
+const (
+	// EventBinAdded is emitted after a bin is added to the ring.
+	EventBinAdded EventType = iota + 1
+
+	// EventBinRemoved is emitted after a bin is removed from the ring.
+	EventBinRemoved
+
+	// EventPartitionPinned is emitted after a partition is pinned to a bin.
+	EventPartitionPinned
+
+	// EventPartitionUnpinned is emitted after a partition is released from a bin.
+	EventPartitionUnpinned
+
+	// EventPinFailedOver is emitted after the pins of a removed bin are dropped.
+	// It follows the EventBinRemoved of the bin.
+	EventPinFailedOver
+
+	// EventBinEjected is emitted after a bin is ejected from the lookups.
+	EventBinEjected
+
+	// EventBinReinstated is emitted after an ejected bin is reinstated.
+	EventBinReinstated
+
+	// EventReplicationFactorTuned is emitted after the replication factor is tuned by AutoTune.
+	// It follows the EventBinAdded or EventBinRemoved of the bin which triggered the tuning.
+	EventReplicationFactorTuned
+
+	// EventOverrideSet is emitted after an override is set.
+	EventOverrideSet
+
+	// EventOverrideDeleted is emitted after an override is deleted.
+	EventOverrideDeleted
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventBinAdded:
+		return "bin_added"
+	case EventBinRemoved:
+		return "bin_removed"
+	case EventPartitionPinned:
+		return "partition_pinned"
+	case EventPartitionUnpinned:
+		return "partition_unpinned"
+	case EventPinFailedOver:
+		return "pin_failed_over"
+	case EventBinEjected:
+		return "bin_ejected"
+	case EventBinReinstated:
+		return "bin_reinstated"
+	case EventReplicationFactorTuned:
+		return "replication_factor_tuned"
+	case EventOverrideSet:
+		return "override_set"
+	case EventOverrideDeleted:
+		return "override_deleted"
+	default:
+		return "unknown"
+	}
+}
+
+// Event represents a change of the consistent hash ring.
+type Event struct {
+	// Type is the kind of the change.
+	Type EventType
+
+	// Bin is the bin which caused the change.
+	Bin Bin
+
+	// Partitions are the pinned or unpinned partitions, or the partitions of the ejected or reinstated bin.
+	Partitions []PartitionID
+
+	// Override is the set or deleted override.
+	Override Override
+
+	// Moved is the number of partitions whose owner has changed by the change.
+	Moved int
+
+	// MinimumMoved is the number of partitions which had to move by the change, namely the partitions of
+	// the removed bin and the partitions exceeding the maximum load. Moved equals it with MinimizeMovement.
+	MinimumMoved int
+
+	// BallsMoved is the number of balls in the moved partitions.
+	BallsMoved int
+
+	// Version is the version of the ring after the change.
+	Version uint64
+
+	// ReplicationFactor is the replication factor of the ring after the change.
+	ReplicationFactor int
+}
+
+// Listener receives the events of the ring.
+// Listeners are called synchronously after the ring is updated, so they should return quickly.
+// The events are delivered in the order of the changes. Listeners must not add or remove bins
+// because the next change waits for the listeners of the previous one.
+type Listener func(Event)
+
+// listeners holds the registered listeners.
+type listeners struct {
+	mu   sync.RWMutex
+	next int
+	fns  map[int]Listener
+}
+
+// Subscribe registers the listener which receives the events of the ring.
+// It returns a function to unsubscribe the listener.
+func (c *Consistent) Subscribe(l Listener) func() {
+	c.listeners.mu.Lock()
+	defer c.listeners.mu.Unlock()
+
+	if c.listeners.fns == nil {
+		c.listeners.fns = make(map[int]Listener)
+	}
+	id := c.listeners.next
+	c.listeners.next++
+	c.listeners.fns[id] = l
+
+	return func() {
+		c.listeners.mu.Lock()
+		defer c.listeners.mu.Unlock()
+		delete(c.listeners.fns, id)
+	}
+}
+
+// emit sends the event to all registered listeners.
+func (c *Consistent) emit(e Event) {
+	c.listeners.mu.RLock()
+	fns := make([]Listener, 0, len(c.listeners.fns))
+	for _, fn := range c.listeners.fns {
+		fns = append(fns, fn)
+	}
+	c.listeners.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(e)
+	}
+}
@@ -0,0 +1,353 @@
+// Package filestore provides a consistent.BallStore which persists the balls to a log-structured file.
+//
+// Every Put and Delete is appended to the file as a checksummed record and the balls are
+// restored by replaying the records when the file is opened again. Records which were torn
+// by a crash are discarded. The file is compacted when the deleted records outnumber the live ones.
+package filestore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/KeisukeYamashita/consistent/internal/logfile"
+)
+
+const (
+	opPut byte = iota + 1
+	opDelete
+)
+
+const (
+	// maxRecordSize is the maximum size of a record body. Larger lengths are treated as corruption.
+	maxRecordSize = 1 << 26
+
+	// compactThreshold is the minimum number of garbage records to compact the file automatically.
+	compactThreshold = 1024
+)
+
+// ErrClosed represents an error which means the store has already been closed.
+var ErrClosed = errors.New("store closed")
+
+// Store is a consistent.BallStore backed by a log-structured file.
+// The names of the balls are indexed in memory, so the balls are restored by consistent.NewBall.
+type Store struct {
+	mu      sync.RWMutex
+	path    string
+	f       *os.File
+	offset  int64
+	index   map[consistent.PartitionID]map[string]struct{}
+	count   int
+	garbage int
+}
+
+// Open opens the store of the passed file path, creating it if it doesn't exist.
+// The balls written before are restored from the file.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:  path,
+		index: make(map[consistent.PartitionID]map[string]struct{}),
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := s.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// discard the torn records at the tail.
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.f = f
+	s.offset = offset
+	return s, nil
+}
+
+// replay applies the records of the file to the index.
+// It returns the offset of the end of the last valid record.
+func (s *Store) replay(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		op, partID, name, n, err := readRecord(r)
+		if err != nil {
+			if logfile.Torn(err) {
+				return offset, nil
+			}
+			return 0, err
+		}
+		offset += int64(n)
+
+		switch op {
+		case opPut:
+			if !s.insert(partID, name) {
+				s.garbage++
+			}
+		case opDelete:
+			s.garbage += s.remove(partID, name) + 1
+		}
+	}
+}
+
+// Put stores the ball in the partition.
+func (s *Store) Put(partID consistent.PartitionID, ball consistent.Ball) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	name := ball.String()
+	if _, ok := s.index[partID][name]; ok {
+		return nil
+	}
+
+	if err := s.write(opPut, partID, name); err != nil {
+		return err
+	}
+	s.insert(partID, name)
+	return nil
+}
+
+// Delete removes the ball from the partition.
+func (s *Store) Delete(partID consistent.PartitionID, ball consistent.Ball) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+
+	name := ball.String()
+	if _, ok := s.index[partID][name]; !ok {
+		return consistent.ErrBallNotFound
+	}
+
+	if err := s.write(opDelete, partID, name); err != nil {
+		return err
+	}
+	s.garbage += s.remove(partID, name) + 1
+
+	if s.garbage >= compactThreshold && s.garbage > s.count {
+		return s.compact()
+	}
+	return nil
+}
+
+// List returns the balls stored in the partition.
+func (s *Store) List(partID consistent.PartitionID) ([]consistent.Ball, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balls := make([]consistent.Ball, 0, len(s.index[partID]))
+	for name := range s.index[partID] {
+		balls = append(balls, consistent.NewBall(name))
+	}
+	return balls, nil
+}
+
+// Count returns the number of the stored balls.
+func (s *Store) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.count, nil
+}
+
+// Range calls fn for each stored ball until fn returns false.
+// The lock is held only while a partition is copied, so fn may modify the store.
+func (s *Store) Range(fn func(partID consistent.PartitionID, ball consistent.Ball) bool) error {
+	s.mu.RLock()
+	partIDs := make([]consistent.PartitionID, 0, len(s.index))
+	for partID := range s.index {
+		partIDs = append(partIDs, partID)
+	}
+	s.mu.RUnlock()
+
+	for _, partID := range partIDs {
+		balls, err := s.List(partID)
+		if err != nil {
+			return err
+		}
+
+		for _, ball := range balls {
+			if !fn(partID, ball) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the file only with the live balls.
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+	return s.compact()
+}
+
+// compact rewrites the file only with the live balls.
+// The caller must hold the lock.
+func (s *Store) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	var offset int64
+	for partID, names := range s.index {
+		for name := range names {
+			n, err := w.Write(encodeRecord(opPut, partID, name))
+			if err != nil {
+				f.Close()
+				return err
+			}
+			offset += int64(n)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f.Close()
+	s.f = f
+	s.offset = offset
+	s.garbage = 0
+	return nil
+}
+
+// Sync commits the written records to the stable storage.
+func (s *Store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return ErrClosed
+	}
+	return s.f.Sync()
+}
+
+// Close syncs and closes the file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	return err
+}
+
+// write appends the record to the file.
+// The file is truncated to the last record if it's torn, so the following records are not lost on replay.
+// The caller must hold the lock.
+func (s *Store) write(op byte, partID consistent.PartitionID, name string) error {
+	offset, err := logfile.Append(s.f, s.offset, encodeRecord(op, partID, name))
+	if err != nil {
+		return err
+	}
+	s.offset = offset
+	return nil
+}
+
+// insert adds the ball name to the partition of the index.
+// It returns false if the name has already been indexed.
+// The caller must hold the lock.
+func (s *Store) insert(partID consistent.PartitionID, name string) bool {
+	names, ok := s.index[partID]
+	if !ok {
+		names = make(map[string]struct{})
+		s.index[partID] = names
+	}
+	if _, ok := names[name]; ok {
+		return false
+	}
+
+	names[name] = struct{}{}
+	s.count++
+	return true
+}
+
+// remove removes the ball name from the partition of the index.
+// It returns the number of the removed balls.
+// The caller must hold the lock.
+func (s *Store) remove(partID consistent.PartitionID, name string) int {
+	names := s.index[partID]
+	if _, ok := names[name]; !ok {
+		return 0
+	}
+
+	delete(names, name)
+	s.count--
+	if len(names) == 0 {
+		delete(s.index, partID)
+	}
+	return 1
+}
+
+// encodeRecord encodes the record framed by logfile.Frame.
+// The body holds the operation, the partition ID and the name of the ball.
+func encodeRecord(op byte, partID consistent.PartitionID, name string) []byte {
+	body := make([]byte, 0, 1+binary.MaxVarintLen64+len(name))
+	body = append(body, op)
+	body = binary.AppendUvarint(body, uint64(partID))
+	body = append(body, name...)
+	return logfile.Frame(body)
+}
+
+// readRecord reads a record from r.
+// It returns the number of the read bytes.
+func readRecord(r io.Reader) (byte, consistent.PartitionID, string, int, error) {
+	body, size, err := logfile.Read(r, maxRecordSize)
+	if err != nil {
+		return 0, 0, "", 0, err
+	}
+
+	if len(body) < 1 || (body[0] != opPut && body[0] != opDelete) {
+		return 0, 0, "", 0, logfile.ErrCorrupted
+	}
+	partID, n := binary.Uvarint(body[1:])
+	if n <= 0 {
+		return 0, 0, "", 0, logfile.ErrCorrupted
+	}
+
+	return body[0], consistent.PartitionID(partID), string(body[1+n:]), size, nil
+}
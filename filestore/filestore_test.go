@@ -0,0 +1,235 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/google/go-cmp/cmp"
+)
+
+type hasher struct{}
+
+func (hs hasher) Sum64(data []byte) uint64 {
+	h := fnv.New64()
+	h.Write(data)
+	return h.Sum64()
+}
+
+func open(t *testing.T, path string) *Store {
+	t.Helper()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
+
+func names(t *testing.T, s *Store) []string {
+	t.Helper()
+
+	var res []string
+	if err := s.Range(func(partID consistent.PartitionID, ball consistent.Ball) bool {
+		res = append(res, fmt.Sprintf("%d/%s", partID, ball.String()))
+		return true
+	}); err != nil {
+		t.Fatalf("failed to range: %v", err)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+func TestStore_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balls")
+
+	s := open(t, path)
+	for i := 0; i < 5; i++ {
+		if err := s.Put(consistent.PartitionID(i%2), consistent.NewBall(fmt.Sprintf("data%d", i))); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+	}
+	// putting the same ball again should not duplicate it.
+	if err := s.Put(0, consistent.NewBall("data0")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	if err := s.Delete(0, consistent.NewBall("data2")); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+	if err := s.Delete(0, consistent.NewBall("not exist")); !errors.Is(err, consistent.ErrBallNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, consistent.ErrBallNotFound)
+	}
+	want := names(t, s)
+	if err := s.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	reopened := open(t, path)
+	if diff := cmp.Diff(names(t, reopened), want); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	if cnt, _ := reopened.Count(); cnt != 4 {
+		t.Fatalf("count mismatch, got:%d, want:%d", cnt, 4)
+	}
+}
+
+func TestStore_TornWrite(t *testing.T) {
+	type testcase struct {
+		corrupt func(b []byte) []byte
+		want    []string
+	}
+
+	tcs := map[string]testcase{
+		"truncated body": {
+			corrupt: func(b []byte) []byte {
+				return b[:len(b)-2]
+			},
+			want: []string{"0/data0"},
+		},
+		"truncated header": {
+			corrupt: func(b []byte) []byte {
+				return append(b, 1, 2, 3)
+			},
+			want: []string{"0/data0", "0/data1"},
+		},
+		"checksum mismatch": {
+			corrupt: func(b []byte) []byte {
+				b[len(b)-1] ^= 0xff
+				return b
+			},
+			want: []string{"0/data0"},
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "balls")
+			s := open(t, path)
+			for i := 0; i < 2; i++ {
+				if err := s.Put(0, consistent.NewBall(fmt.Sprintf("data%d", i))); err != nil {
+					t.Fatalf("failed to put: %v", err)
+				}
+			}
+			s.Close()
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if err := os.WriteFile(path, tc.corrupt(b), 0o644); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+
+			reopened := open(t, path)
+			if diff := cmp.Diff(names(t, reopened), tc.want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+
+			// the store should be writable after the torn record is discarded.
+			if err := reopened.Put(1, consistent.NewBall("after")); err != nil {
+				t.Fatalf("failed to put: %v", err)
+			}
+			reopened.Close()
+
+			again := open(t, path)
+			if diff := cmp.Diff(names(t, again), append(tc.want, "1/after")); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestStore_Compact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balls")
+
+	s := open(t, path)
+	for i := 0; i < 100; i++ {
+		if err := s.Put(0, consistent.NewBall(fmt.Sprintf("data%d", i))); err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+	}
+	for i := 0; i < 90; i++ {
+		if err := s.Delete(0, consistent.NewBall(fmt.Sprintf("data%d", i))); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+	}
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat: %v", err)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat: %v", err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("file should shrink, before:%d, after:%d", before.Size(), after.Size())
+	}
+
+	want := names(t, s)
+	if err := s.Put(1, consistent.NewBall("after")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	s.Close()
+
+	reopened := open(t, path)
+	if diff := cmp.Diff(names(t, reopened), append(want, "1/after")); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestStore_Consistent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "balls")
+	cfg := &consistent.Config{
+		Partition:              23,
+		ReplicationFactor:      21,
+		LoadBalancingParameter: 1.1,
+		Hasher:                 hasher{},
+	}
+	bins := []consistent.Bin{consistent.NewBin("node0"), consistent.NewBin("node1")}
+
+	cfg.BallStore = open(t, path)
+	c, err := consistent.New(cfg, bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := c.Register(consistent.NewBall(fmt.Sprintf("data%d", i))); err != nil {
+			t.Fatalf("failed to register: %v", err)
+		}
+	}
+	want, err := c.GetBallsByBin(bins[0])
+	if err != nil {
+		t.Fatalf("failed to get balls: %v", err)
+	}
+	cfg.BallStore.(*Store).Close()
+
+	cfg.BallStore = open(t, path)
+	restored, err := consistent.New(cfg, bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	got, err := restored.GetBallsByBin(bins[0])
+	if err != nil {
+		t.Fatalf("failed to get balls: %v", err)
+	}
+	if len(got) != len(want) || len(restored.GetBalls()) != 10 {
+		t.Fatalf("balls should be restored, got:%d, want:%d", len(got), len(want))
+	}
+}
@@ -2,16 +2,4 @@ module github.com/KeisukeYamashita/consistent
 
 go 1.19
 
-require (
-	github.com/go-playground/validator/v10 v10.13.0
-	github.com/google/go-cmp v0.5.9
-)
-
-require (
-	github.com/go-playground/locales v0.14.1 // indirect
-	github.com/go-playground/universal-translator v0.18.1 // indirect
-	github.com/leodido/go-urn v1.2.3 // indirect
-	golang.org/x/crypto v0.7.0 // indirect
-	golang.org/x/sys v0.6.0 // indirect
-	golang.org/x/text v0.8.0 // indirect
-)
+require github.com/google/go-cmp v0.5.9
@@ -4,6 +4,8 @@ package consistent
 // Hasher should minimize collisions (generating same hash for different byte slice)
 // and while performance is also important fast functions are preferable (i.e.
 // you can use FarmHash family).
+// Hasher must be safe for concurrent use if Config.Workers is more than one, because the
+// partitions are hashed by the workers at the same time.
 type Hasher interface {
 	Sum64([]byte) uint64
 }
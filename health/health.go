@@ -0,0 +1,392 @@
+// Package health checks the bins of a consistent hash ring and ejects the unhealthy ones from the lookups.
+//
+// A Monitor periodically checks every bin with a Checker. A bin is ejected after UnhealthyThreshold
+// consecutive failures and reinstated after HealthyThreshold consecutive successes. The ejection doesn't
+// rebuild the ring, so the partitions of the bin come back to it as soon as it's reinstated.
+// At most MaxEjectionPercent of the bins are ejected at once, so an outage of the checker itself
+// never takes most of the ring away.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+)
+
+const (
+	// DefaultInterval is the default interval between the checks.
+	DefaultInterval = 5 * time.Second
+
+	// DefaultTimeout is the default time to wait for a check.
+	DefaultTimeout = time.Second
+
+	// DefaultUnhealthyThreshold is the default number of consecutive failures to eject a bin.
+	DefaultUnhealthyThreshold = 3
+
+	// DefaultHealthyThreshold is the default number of consecutive successes to reinstate a bin.
+	DefaultHealthyThreshold = 2
+
+	// DefaultMaxEjectionPercent is the default maximum percentage of the bins ejected at once.
+	DefaultMaxEjectionPercent = 50
+
+	// AddressLabel is the label of the bin holding the address to check.
+	// The name of the bin is used as the address if the bin doesn't have the label.
+	AddressLabel = "address"
+)
+
+var (
+	// ErrNoChecker represents an error which means the checker is not configured.
+	ErrNoChecker = errors.New("checker is required")
+
+	// ErrNoRing represents an error which means the ring is not configured.
+	ErrNoRing = errors.New("ring is required")
+
+	// ErrInvalidMaxEjectionPercent represents an error which means the maximum ejection percentage is out of range.
+	ErrInvalidMaxEjectionPercent = errors.New("max ejection percent must be between 0 and 100")
+)
+
+// Ring represents the consistent hash ring whose bins are checked.
+// *consistent.Consistent satisfies this interface.
+type Ring interface {
+	GetBins() []consistent.Bin
+	Eject(name string) error
+	Reinstate(name string) error
+}
+
+// Checker checks the health of a bin.
+// Check returns nil if the bin is healthy. It must return by the deadline of the context.
+type Checker interface {
+	Check(ctx context.Context, bin consistent.Bin) error
+}
+
+// CheckerFunc is an adapter to use an ordinary function as a Checker.
+type CheckerFunc func(ctx context.Context, bin consistent.Bin) error
+
+// Check calls f(ctx, bin).
+func (f CheckerFunc) Check(ctx context.Context, bin consistent.Bin) error {
+	return f(ctx, bin)
+}
+
+// Address returns the address of the bin.
+func Address(bin consistent.Bin) string {
+	if addr, ok := bin.Labels[AddressLabel]; ok {
+		return addr
+	}
+	return bin.Name
+}
+
+// TCPChecker checks that a TCP connection to the address of the bin can be established.
+type TCPChecker struct {
+	// Dialer dials the bins. The zero value is used if it's nil.
+	Dialer *net.Dialer
+}
+
+// Check dials the address of the bin and closes the connection.
+func (c TCPChecker) Check(ctx context.Context, bin consistent.Bin) error {
+	d := c.Dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", Address(bin))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPChecker checks that the health endpoint of the bin responds with a 2xx status.
+type HTTPChecker struct {
+	// Client sends the requests. http.DefaultClient is used if it's nil.
+	Client *http.Client
+
+	// URL returns the health endpoint of the bin.
+	// "http://<address>/healthz" is used if it's nil.
+	URL func(bin consistent.Bin) string
+}
+
+// Check sends a GET request to the health endpoint of the bin.
+func (c HTTPChecker) Check(ctx context.Context, bin consistent.Bin) error {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	url := "http://" + Address(bin) + "/healthz"
+	if c.URL != nil {
+		url = c.URL(bin)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unhealthy status: %s", resp.Status)
+	}
+	return nil
+}
+
+// Config represents a configuration of the monitor.
+type Config struct {
+	// Ring is the consistent hash ring whose bins are checked.
+	Ring Ring
+
+	// Checker checks the health of the bins.
+	Checker Checker
+
+	// Interval is the interval between the checks.
+	Interval time.Duration
+
+	// Timeout is the time to wait for a check. A check which doesn't return in time is a failure.
+	Timeout time.Duration
+
+	// UnhealthyThreshold is the number of consecutive failures to eject a bin.
+	UnhealthyThreshold int
+
+	// HealthyThreshold is the number of consecutive successes to reinstate an ejected bin.
+	HealthyThreshold int
+
+	// MaxEjectionPercent is the maximum percentage of the bins ejected at once.
+	// The unhealthy bins exceeding it stay in the ring until the other bins are reinstated.
+	// DefaultMaxEjectionPercent is used if it's nil, and zero disables the ejection.
+	MaxEjectionPercent *float64
+
+	// OnError is called when the ring fails to eject or reinstate a bin.
+	OnError func(err error)
+}
+
+// Status represents the health of a bin.
+type Status struct {
+	// Bin is the name of the bin.
+	Bin string
+
+	// Ejected reports whether the bin is ejected by the monitor.
+	Ejected bool
+
+	// Failures is the number of consecutive failures.
+	Failures int
+
+	// Successes is the number of consecutive successes.
+	Successes int
+
+	// LastError is the error of the last check. It's nil if the last check succeeded.
+	LastError error
+}
+
+// Monitor checks the bins of the ring and ejects the unhealthy ones.
+type Monitor struct {
+	cfg Config
+
+	mu       sync.Mutex
+	statuses map[string]*Status
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New generates a new monitor by passed config.
+// The monitor doesn't check the bins until Start is called.
+func New(cfg Config) (*Monitor, error) {
+	if cfg.Ring == nil {
+		return nil, ErrNoRing
+	}
+	if cfg.Checker == nil {
+		return nil, ErrNoChecker
+	}
+	percent := float64(DefaultMaxEjectionPercent)
+	if cfg.MaxEjectionPercent != nil {
+		percent = *cfg.MaxEjectionPercent
+	}
+	if !(percent >= 0 && percent <= 100) {
+		return nil, ErrInvalidMaxEjectionPercent
+	}
+	// the percentage is copied so the caller can't change it while the bins are checked.
+	cfg.MaxEjectionPercent = &percent
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.UnhealthyThreshold <= 0 {
+		cfg.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+	if cfg.HealthyThreshold <= 0 {
+		cfg.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if cfg.OnError == nil {
+		cfg.OnError = func(error) {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Monitor{
+		cfg:      cfg,
+		statuses: make(map[string]*Status),
+		ctx:      ctx,
+		cancel:   cancel,
+	}, nil
+}
+
+// Start starts checking the bins every interval.
+func (m *Monitor) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.cfg.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+				m.Check(m.ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops checking the bins and cancels the running checks. The ejected bins stay ejected.
+func (m *Monitor) Stop() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Check checks every bin of the ring once and ejects or reinstates the bins by the results.
+// The bins are checked concurrently. The results are discarded if the context is done.
+func (m *Monitor) Check(ctx context.Context) {
+	bins := m.cfg.Ring.GetBins()
+	errs := make([]error, len(bins))
+
+	var wg sync.WaitGroup
+	for i, bin := range bins {
+		wg.Add(1)
+		go func(i int, bin consistent.Bin) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+			defer cancel()
+			errs[i] = m.cfg.Checker.Check(ctx, bin)
+		}(i, bin)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		// the results of the canceled checks are not the health of the bins.
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// forget the bins removed from the ring.
+	present := make(map[string]bool, len(bins))
+	for _, bin := range bins {
+		present[bin.Name] = true
+	}
+	for name := range m.statuses {
+		if !present[name] {
+			delete(m.statuses, name)
+		}
+	}
+
+	for i, bin := range bins {
+		st, ok := m.statuses[bin.Name]
+		if !ok {
+			st = &Status{Bin: bin.Name}
+			m.statuses[bin.Name] = st
+		}
+		st.LastError = errs[i]
+		if errs[i] != nil {
+			st.Failures++
+			st.Successes = 0
+		} else {
+			st.Successes++
+			st.Failures = 0
+		}
+	}
+
+	m.apply(len(bins))
+}
+
+// apply reinstates the recovered bins and ejects the unhealthy bins within the limit.
+// The caller must hold mu.
+func (m *Monitor) apply(total int) {
+	statuses := m.sorted()
+
+	ejected := 0
+	for _, st := range statuses {
+		if !st.Ejected {
+			continue
+		}
+		if st.Successes < m.cfg.HealthyThreshold {
+			ejected++
+			continue
+		}
+		if err := m.cfg.Ring.Reinstate(st.Bin); err != nil {
+			m.cfg.OnError(err)
+			ejected++
+			continue
+		}
+		st.Ejected = false
+	}
+
+	// the bins failing longer are ejected first.
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Failures > statuses[j].Failures
+	})
+	limit := int(float64(total) * *m.cfg.MaxEjectionPercent / 100)
+	for _, st := range statuses {
+		if st.Ejected || st.Failures < m.cfg.UnhealthyThreshold {
+			continue
+		}
+		if ejected >= limit {
+			break
+		}
+		if err := m.cfg.Ring.Eject(st.Bin); err != nil {
+			m.cfg.OnError(err)
+			continue
+		}
+		st.Ejected = true
+		ejected++
+	}
+}
+
+// Statuses returns the health of the bins in ascending order of the name.
+func (m *Monitor) Statuses() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := m.sorted()
+	res := make([]Status, len(statuses))
+	for i, st := range statuses {
+		res[i] = *st
+	}
+	return res
+}
+
+// sorted returns the statuses in ascending order of the name. The caller must hold mu.
+func (m *Monitor) sorted() []*Status {
+	res := make([]*Status, 0, len(m.statuses))
+	for _, st := range m.statuses {
+		res = append(res, st)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Bin < res[j].Bin
+	})
+	return res
+}
@@ -0,0 +1,267 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/google/go-cmp/cmp"
+)
+
+type hasher struct{}
+
+func (hs hasher) Sum64(data []byte) uint64 {
+	h := fnv.New64()
+	h.Write(data)
+	return h.Sum64()
+}
+
+func newRing(t *testing.T, names ...string) *consistent.Consistent {
+	t.Helper()
+
+	bins := make([]consistent.Bin, len(names))
+	for i, name := range names {
+		bins[i] = consistent.NewBin(name)
+	}
+	c, err := consistent.New(&consistent.Config{
+		Partition:              23,
+		ReplicationFactor:      21,
+		LoadBalancingParameter: 1.25,
+		Hasher:                 hasher{},
+	}, bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	return c
+}
+
+// downChecker fails the checks of the bins which are down.
+type downChecker struct {
+	mu   sync.Mutex
+	down map[string]bool
+}
+
+func (c *downChecker) Check(_ context.Context, bin consistent.Bin) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.down[bin.Name] {
+		return errors.New("down")
+	}
+	return nil
+}
+
+func (c *downChecker) set(name string, down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down[name] = down
+}
+
+func percent(p float64) *float64 {
+	return &p
+}
+
+func TestNew(t *testing.T) {
+	type testcase struct {
+		cfg  Config
+		want error
+	}
+
+	ring := newRing(t, "a")
+	checker := &downChecker{}
+	tcs := map[string]testcase{
+		"valid": {
+			cfg: Config{Ring: ring, Checker: checker},
+		},
+		"no ring": {
+			cfg:  Config{Checker: checker},
+			want: ErrNoRing,
+		},
+		"no checker": {
+			cfg:  Config{Ring: ring},
+			want: ErrNoChecker,
+		},
+		"ejection disabled": {
+			cfg: Config{Ring: ring, Checker: checker, MaxEjectionPercent: percent(0)},
+		},
+		"max ejection percent out of range": {
+			cfg:  Config{Ring: ring, Checker: checker, MaxEjectionPercent: percent(101)},
+			want: ErrInvalidMaxEjectionPercent,
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			if _, err := New(tc.cfg); !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestMonitor_Check(t *testing.T) {
+	ring := newRing(t, "a", "b", "c", "d")
+	checker := &downChecker{down: map[string]bool{}}
+	m, err := New(Config{Ring: ring, Checker: checker, UnhealthyThreshold: 2, HealthyThreshold: 2})
+	if err != nil {
+		t.Fatalf("failed to create monitor: %v", err)
+	}
+
+	check := func(want []string) {
+		t.Helper()
+
+		m.Check(context.Background())
+		if diff := cmp.Diff(ring.Ejected(), want); diff != "" {
+			t.Fatalf("mismatch (-got,+want):%s", diff)
+		}
+	}
+
+	// the bins are ejected after the failures exceed the threshold.
+	checker.set("a", true)
+	checker.set("b", true)
+	checker.set("c", true)
+	check([]string{})
+	check([]string{"a", "b"})
+
+	// the limit keeps c in the ring until a is reinstated.
+	checker.set("a", false)
+	check([]string{"a", "b"})
+	check([]string{"b", "c"})
+
+	statuses := m.Statuses()
+	if len(statuses) != 4 || statuses[2].Bin != "c" || !statuses[2].Ejected || statuses[2].LastError == nil {
+		t.Fatalf("unexpected statuses: got:%+v", statuses)
+	}
+
+	// the removed bins are forgotten.
+	if err := ring.Remove(consistent.NewBin("b")); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+	check([]string{"c"})
+	if got := len(m.Statuses()); got != 3 {
+		t.Fatalf("unexpected statuses: got:%d want:%d", got, 3)
+	}
+
+	// the canceled checks are discarded.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	checker.set("d", true)
+	for i := 0; i < 3; i++ {
+		m.Check(ctx)
+	}
+	if got := m.Statuses()[2]; got.Failures != 0 {
+		t.Fatalf("canceled checks should be discarded: got:%+v", got)
+	}
+}
+
+func TestMonitor_CheckEjectionDisabled(t *testing.T) {
+	ring := newRing(t, "a", "b", "c", "d")
+	checker := &downChecker{down: map[string]bool{"a": true}}
+	m, err := New(Config{Ring: ring, Checker: checker, UnhealthyThreshold: 1, MaxEjectionPercent: percent(0)})
+	if err != nil {
+		t.Fatalf("failed to create monitor: %v", err)
+	}
+
+	// the unhealthy bins are reported but never ejected.
+	for i := 0; i < 3; i++ {
+		m.Check(context.Background())
+	}
+	if diff := cmp.Diff(ring.Ejected(), []string{}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	if got := m.Statuses()[0]; got.Bin != "a" || got.Failures != 3 || got.Ejected {
+		t.Fatalf("unexpected status: got:%+v", got)
+	}
+}
+
+func TestMonitor_Start(t *testing.T) {
+	ring := newRing(t, "a", "b", "c")
+	checker := &downChecker{down: map[string]bool{"a": true}}
+	m, err := New(Config{Ring: ring, Checker: checker, Interval: time.Millisecond, UnhealthyThreshold: 1})
+	if err != nil {
+		t.Fatalf("failed to create monitor: %v", err)
+	}
+
+	m.Start()
+	defer m.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ring.Ejected()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("bin should be ejected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if diff := cmp.Diff(ring.Ejected(), []string{"a"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestTCPChecker(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	up := l.Addr().String()
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	down := l2.Addr().String()
+	l2.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	defer l.Close()
+
+	ctx := context.Background()
+	if err := (TCPChecker{}).Check(ctx, consistent.NewBin(up)); err != nil {
+		t.Fatalf("error unexpected: got:%v want:%v", err, nil)
+	}
+	bin := consistent.NewBinWithLabels("down", map[string]string{AddressLabel: down})
+	if err := (TCPChecker{}).Check(ctx, bin); err == nil {
+		t.Fatal("closed port should be unhealthy")
+	}
+}
+
+func TestHTTPChecker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	ctx := context.Background()
+	if err := (HTTPChecker{}).Check(ctx, consistent.NewBin(addr)); err != nil {
+		t.Fatalf("error unexpected: got:%v want:%v", err, nil)
+	}
+	checker := HTTPChecker{
+		URL: func(bin consistent.Bin) string {
+			return "http://" + Address(bin) + "/ready"
+		},
+	}
+	if err := checker.Check(ctx, consistent.NewBin(addr)); err == nil {
+		t.Fatal("unhealthy status should fail")
+	}
+}
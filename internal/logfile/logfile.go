@@ -0,0 +1,97 @@
+// Package logfile frames the records of the append-only files of the ring.
+//
+// A framed record is the header followed by the body. The header holds the length and the
+// CRC-32 checksum of the body, so the records torn by a crash are detected on replay.
+package logfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// HeaderSize is the size of the record header which holds the length and the checksum of the body.
+const HeaderSize = 8
+
+// ErrCorrupted represents an error which means the record doesn't match its checksum.
+var ErrCorrupted = errors.New("corrupted record")
+
+// Frame prepends the header which holds the length and the CRC-32 checksum of the body.
+func Frame(body []byte) []byte {
+	b := make([]byte, HeaderSize, HeaderSize+len(body))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(body)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(body))
+	return append(b, body...)
+}
+
+// Unframe returns the body of the framed bytes which hold exactly one record.
+func Unframe(b []byte) ([]byte, error) {
+	if len(b) < HeaderSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	size := binary.LittleEndian.Uint32(b[0:4])
+	if uint64(len(b)-HeaderSize) != uint64(size) {
+		return nil, ErrCorrupted
+	}
+	body := b[HeaderSize:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(b[4:8]) {
+		return nil, ErrCorrupted
+	}
+	return body, nil
+}
+
+// Read reads the body of a record from r. Bodies larger than maxSize are treated as corruption.
+// It returns the number of the read bytes.
+func Read(r io.Reader, maxSize uint32) ([]byte, int, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	if size > maxSize {
+		return nil, 0, ErrCorrupted
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, 0, ErrCorrupted
+	}
+	return body, HeaderSize + len(body), nil
+}
+
+// Torn reports whether the error of Read means the rest of the file is torn, so the replay stops there.
+func Torn(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrCorrupted)
+}
+
+// File is the file which the records are appended to. *os.File implements it.
+type File interface {
+	io.Writer
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// Append appends the framed record to the file whose last valid record ends at the offset.
+// The file is truncated back to the offset if the write fails, so a torn record never hides the
+// records appended after it from the replay. It returns the offset of the end of the appended record.
+func Append(f File, offset int64, b []byte) (int64, error) {
+	if _, err := f.Write(b); err != nil {
+		Rewind(f, offset)
+		return offset, err
+	}
+	return offset + int64(len(b)), nil
+}
+
+// Rewind discards the bytes written after the offset, so the next record is appended there.
+func Rewind(f File, offset int64) error {
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := f.Seek(offset, io.SeekStart)
+	return err
+}
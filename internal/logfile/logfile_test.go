@@ -0,0 +1,162 @@
+package logfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRead(t *testing.T) {
+	type testcase struct {
+		corrupt func(b []byte) []byte
+		want    []byte
+		torn    bool
+	}
+
+	tcs := map[string]testcase{
+		"valid record": {
+			corrupt: func(b []byte) []byte {
+				return b
+			},
+			want: []byte("body"),
+		},
+		"truncated header": {
+			corrupt: func(b []byte) []byte {
+				return b[:HeaderSize/2]
+			},
+			torn: true,
+		},
+		"truncated body": {
+			corrupt: func(b []byte) []byte {
+				return b[:len(b)-1]
+			},
+			torn: true,
+		},
+		"checksum mismatch": {
+			corrupt: func(b []byte) []byte {
+				b[len(b)-1] ^= 0xff
+				return b
+			},
+			torn: true,
+		},
+		"too large": {
+			corrupt: func(b []byte) []byte {
+				b[3] = 0xff
+				return b
+			},
+			torn: true,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			b := tc.corrupt(Frame([]byte("body")))
+			body, size, err := Read(bytes.NewReader(b), 1<<10)
+			if got := Torn(err); got != tc.torn {
+				t.Fatalf("error unexpected: got:%v torn:%v", err, tc.torn)
+			}
+			if tc.torn {
+				return
+			}
+			if diff := cmp.Diff(body, tc.want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+			if size != len(b) {
+				t.Fatalf("size mismatch, got:%d want:%d", size, len(b))
+			}
+		})
+	}
+}
+
+func TestUnframe(t *testing.T) {
+	b := Frame([]byte("body"))
+	body, err := Unframe(b)
+	if err != nil {
+		t.Fatalf("failed to unframe: %v", err)
+	}
+	if diff := cmp.Diff(body, []byte("body")); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	if _, err := Unframe(append(b, 0)); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrCorrupted)
+	}
+}
+
+// shortFile is an in-memory File whose writes fail after writing a half while failing is set.
+type shortFile struct {
+	b       []byte
+	pos     int64
+	failing bool
+}
+
+func (f *shortFile) Write(p []byte) (int, error) {
+	n := len(p)
+	if f.failing {
+		n /= 2
+	}
+	f.b = append(f.b[:f.pos], p[:n]...)
+	f.pos += int64(n)
+	if f.failing {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+func (f *shortFile) Seek(offset int64, whence int) (int64, error) {
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *shortFile) Truncate(size int64) error {
+	f.b = f.b[:size]
+	return nil
+}
+
+func TestAppend(t *testing.T) {
+	f := &shortFile{}
+	var offset int64
+	for i, body := range []string{"first", "torn", "second"} {
+		f.failing = i == 1
+		next, err := Append(f, offset, Frame([]byte(body)))
+		if f.failing {
+			if !errors.Is(err, io.ErrShortWrite) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, io.ErrShortWrite)
+			}
+			if next != offset {
+				t.Fatalf("offset mismatch, got:%d want:%d", next, offset)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+		offset = next
+	}
+
+	// the torn record is discarded, so the record appended after it is replayed.
+	r := bytes.NewReader(f.b)
+	var got []string
+	for {
+		body, _, err := Read(r, 1<<10)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, io.EOF)
+			}
+			break
+		}
+		got = append(got, string(body))
+	}
+	if diff := cmp.Diff(got, []string{"first", "second"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	if int64(len(f.b)) != offset {
+		t.Fatalf("offset mismatch, got:%d want:%d", offset, len(f.b))
+	}
+}
@@ -0,0 +1,38 @@
+package consistent
+
+import "bytes"
+
+// KeyExtractor extracts the part of the key which decides the partition of the key.
+// The keys which have the same extracted part are located to the same partition.
+// It must return the same result for the same key and must not modify the key.
+type KeyExtractor func(key []byte) []byte
+
+// HashTagExtractor extracts the Redis style hash tag of the key.
+// The tag is the substring between the first '{' and the first '}' following it, so
+// "user:{42}:profile" and "user:{42}:cart" are located to the same partition. The whole key
+// is used if the key has no tag or the tag is empty.
+func HashTagExtractor(key []byte) []byte {
+	start := bytes.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+
+	end := bytes.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// DelimiterExtractor returns a KeyExtractor which extracts the part of the key before the first delimiter.
+// For example, "user:42" and "user:43" are located to the same partition with ":". The whole key is used
+// if the key doesn't have the delimiter.
+func DelimiterExtractor(delim string) KeyExtractor {
+	d := []byte(delim)
+	return func(key []byte) []byte {
+		if i := bytes.Index(key, d); i >= 0 && len(d) > 0 {
+			return key[:i]
+		}
+		return key
+	}
+}
@@ -0,0 +1,154 @@
+package consistent
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestHashTagExtractor(t *testing.T) {
+	type testcase struct {
+		key  string
+		want string
+	}
+
+	tcs := map[string]testcase{
+		"tag": {
+			key:  "user:{42}:profile",
+			want: "42",
+		},
+		"first tag": {
+			key:  "{a}{b}",
+			want: "a",
+		},
+		"no tag": {
+			key:  "user:42",
+			want: "user:42",
+		},
+		"empty tag": {
+			key:  "user:{}:{42}",
+			want: "user:{}:{42}",
+		},
+		"unclosed tag": {
+			key:  "user:{42",
+			want: "user:{42",
+		},
+		"closing brace before opening one": {
+			key:  "}user{42}",
+			want: "42",
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			if got := string(HashTagExtractor([]byte(tc.key))); got != tc.want {
+				t.Fatalf("unexpected result: got:%s want:%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDelimiterExtractor(t *testing.T) {
+	type testcase struct {
+		delim string
+		key   string
+		want  string
+	}
+
+	tcs := map[string]testcase{
+		"prefix": {
+			delim: ":",
+			key:   "user:42:profile",
+			want:  "user",
+		},
+		"multi byte delimiter": {
+			delim: "::",
+			key:   "user:42::profile",
+			want:  "user:42",
+		},
+		"no delimiter": {
+			delim: ":",
+			key:   "user/42",
+			want:  "user/42",
+		},
+		"empty delimiter": {
+			delim: "",
+			key:   "user:42",
+			want:  "user:42",
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			if got := string(DelimiterExtractor(tc.delim)([]byte(tc.key))); got != tc.want {
+				t.Fatalf("unexpected result: got:%s want:%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConsistent_KeyExtractor(t *testing.T) {
+	cfg := newConfig()
+	cfg.Partition = 271
+	cfg.KeyExtractor = HashTagExtractor
+	c, err := New(cfg, initialBins(8))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	profile, cart := NewBall("user:{42}:profile"), NewBall("user:{42}:cart")
+	if got, want := c.FindPartitionID([]byte(profile.String())), c.FindPartitionID([]byte("42")); got != want {
+		t.Fatalf("unexpected partition: got:%d want:%d", got, want)
+	}
+
+	bin, err := c.Register(profile)
+	if err != nil {
+		t.Fatalf("failed to register ball: %v", err)
+	}
+	if got := c.Locate(cart); got.String() != bin.String() {
+		t.Fatalf("balls should be co-located: got:%s want:%s", got, bin)
+	}
+	_, partID := c.Lookup([]byte(cart.String()))
+	var balls []string
+	if err := c.BallsInPartition(partID, func(b Ball) bool {
+		balls = append(balls, b.String())
+		return true
+	}); err != nil {
+		t.Fatalf("failed to list balls: %v", err)
+	}
+	if len(balls) != 2 {
+		t.Fatalf("unexpected balls: got:%v", balls)
+	}
+
+	// the balls follow its tag when the bins change.
+	for i := 0; i < 4; i++ {
+		if err := c.Add(NewBin(fmt.Sprintf("extra%d", i))); err != nil {
+			t.Fatalf("failed to add bin: %v", err)
+		}
+	}
+	bin, _ = c.Lookup([]byte("{42}"))
+	got, err := c.GetBallsByBin(*bin)
+	if err != nil {
+		t.Fatalf("failed to get balls: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("balls should be relocated with its tag: got:%v", got)
+	}
+	for _, b := range []Ball{profile, cart} {
+		if err := c.Delete(b); err != nil {
+			t.Fatalf("error unexpected: got:%v want:%v", err, nil)
+		}
+	}
+	if err := c.Delete(profile); !errors.Is(err, ErrBallNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrBallNotFound)
+	}
+	if balls := c.GetBalls(); len(balls) != 0 {
+		t.Fatalf("unexpected balls: got:%v", balls)
+	}
+}
@@ -0,0 +1,870 @@
+// Package membership keeps the bins of a consistent hash ring in sync with the live
+// instances of a service by running a SWIM-style gossip protocol between them.
+//
+// Every instance runs a Node which periodically probes a random peer, asks other peers to
+// probe it indirectly when the probe fails, and disseminates the membership changes by
+// piggybacking them on the protocol messages. Members which join are added to the ring and
+// members which fail or leave are removed from it after a debounce period.
+package membership
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+)
+
+const (
+	// DefaultProbeInterval is the default interval between failure detection probes.
+	DefaultProbeInterval = time.Second
+
+	// DefaultProbeTimeout is the default time to wait for an ack of a direct probe.
+	DefaultProbeTimeout = 500 * time.Millisecond
+
+	// DefaultIndirectChecks is the default number of peers asked to probe a member indirectly.
+	DefaultIndirectChecks = 3
+
+	// DefaultSuspicionTimeout is the default time a suspected member has to refute the suspicion.
+	DefaultSuspicionTimeout = 5 * time.Second
+
+	// DefaultDebounce is the default time a membership change has to be stable before it's applied to the ring.
+	DefaultDebounce = time.Second
+
+	// DefaultPushPullInterval is the default interval between full state synchronizations with a random peer.
+	DefaultPushPullInterval = 30 * time.Second
+
+	// DefaultRetransmitMult is the default multiplier of the number of times an update is piggybacked.
+	DefaultRetransmitMult = 3
+
+	// DefaultDeadMemberTimeout is the default time a dead or left member is kept before it's forgotten.
+	DefaultDeadMemberTimeout = 30 * time.Second
+
+	// maxPiggyback is the maximum number of updates piggybacked on a message.
+	maxPiggyback = 16
+)
+
+var (
+	// ErrNoName represents an error which means the node name is not configured.
+	ErrNoName = errors.New("node name is required")
+
+	// ErrNoTransport represents an error which means the transport is not configured.
+	ErrNoTransport = errors.New("transport is required")
+
+	// ErrNoRing represents an error which means the ring is not configured.
+	ErrNoRing = errors.New("ring is required")
+)
+
+// Ring represents the consistent hash ring updated by the node.
+// *consistent.Consistent satisfies this interface.
+type Ring interface {
+	Add(bin consistent.Bin) error
+	Remove(bin consistent.Bin) error
+}
+
+// State represents the state of a member.
+type State int
+
+const (
+	// StateAlive means the member is responding to probes.
+	StateAlive State = iota
+
+	// StateSuspect means the member failed a probe and may be dead.
+	StateSuspect
+
+	// StateDead means the member didn't refute the suspicion in time.
+	StateDead
+
+	// StateLeft means the member has left the cluster gracefully.
+	StateLeft
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	case StateDead:
+		return "dead"
+	case StateLeft:
+		return "left"
+	default:
+		return "unknown"
+	}
+}
+
+// inRing reports whether a member of the state should be a bin of the ring.
+func (s State) inRing() bool {
+	return s == StateAlive || s == StateSuspect
+}
+
+// Member represents an instance of the cluster.
+type Member struct {
+	// Name is the name of the member, which is used as the bin name.
+	Name string
+
+	// Addr is the transport address of the member.
+	Addr string
+
+	// State is the state of the member.
+	State State
+
+	// Incarnation is increased by the member to refute a suspicion.
+	Incarnation uint64
+}
+
+// Config represents a configuration of the node.
+type Config struct {
+	// Name is the name of this node. It's used as the bin name and must be unique in the cluster.
+	Name string
+
+	// Transport delivers the messages between nodes.
+	Transport Transport
+
+	// Ring is the consistent hash ring kept in sync with the members.
+	Ring Ring
+
+	// ProbeInterval is the interval between failure detection probes.
+	ProbeInterval time.Duration
+
+	// ProbeTimeout is the time to wait for an ack of a direct probe.
+	// It should be smaller than ProbeInterval to leave time for the indirect probes.
+	ProbeTimeout time.Duration
+
+	// IndirectChecks is the number of peers asked to probe a member when the direct probe fails.
+	IndirectChecks int
+
+	// SuspicionTimeout is the time a suspected member has to refute the suspicion before declared dead.
+	SuspicionTimeout time.Duration
+
+	// Debounce is the time a membership change has to be stable before it's applied to the ring.
+	// Members flapping faster than this are not added and removed repeatedly.
+	Debounce time.Duration
+
+	// PushPullInterval is the interval between full state synchronizations with a random peer.
+	// It repairs the membership which the piggybacked updates failed to reach.
+	PushPullInterval time.Duration
+
+	// RetransmitMult is multiplied by log(N+1) to calculate how many times an update is piggybacked.
+	RetransmitMult int
+
+	// DeadMemberTimeout is the time a dead or left member is kept before it's forgotten, so the members
+	// don't grow without bound under churn. It should be long enough for the death to be disseminated.
+	DeadMemberTimeout time.Duration
+
+	// OnError is called when the ring fails to apply a membership change.
+	OnError func(err error)
+}
+
+// broadcast is an update waiting to be piggybacked.
+type broadcast struct {
+	update    update
+	transmits int
+}
+
+// Node is a member of the cluster which runs the gossip protocol.
+type Node struct {
+	cfg       Config
+	debouncer *debouncer
+
+	mu          sync.Mutex
+	incarnation uint64
+	leaving     bool
+	members     map[string]*Member
+	suspects    map[string]time.Time
+	departed    map[string]time.Time
+	broadcasts  []*broadcast
+	probeOrder  []string
+	seq         uint64
+	acks        map[uint64]chan struct{}
+	rand        *rand.Rand
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// New generates a new node by passed config.
+// The node doesn't communicate with the peers until Start is called.
+func New(cfg Config) (*Node, error) {
+	if cfg.Name == "" {
+		return nil, ErrNoName
+	}
+	if cfg.Transport == nil {
+		return nil, ErrNoTransport
+	}
+	if cfg.Ring == nil {
+		return nil, ErrNoRing
+	}
+
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = DefaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = DefaultProbeTimeout
+	}
+	if cfg.IndirectChecks <= 0 {
+		cfg.IndirectChecks = DefaultIndirectChecks
+	}
+	if cfg.SuspicionTimeout <= 0 {
+		cfg.SuspicionTimeout = DefaultSuspicionTimeout
+	}
+	if cfg.Debounce < 0 {
+		cfg.Debounce = 0
+	}
+	if cfg.PushPullInterval <= 0 {
+		cfg.PushPullInterval = DefaultPushPullInterval
+	}
+	if cfg.RetransmitMult <= 0 {
+		cfg.RetransmitMult = DefaultRetransmitMult
+	}
+	if cfg.DeadMemberTimeout <= 0 {
+		cfg.DeadMemberTimeout = DefaultDeadMemberTimeout
+	}
+
+	n := &Node{
+		cfg:       cfg,
+		debouncer: newDebouncer(cfg.Ring, cfg.Debounce, cfg.OnError),
+		members:   make(map[string]*Member),
+		suspects:  make(map[string]time.Time),
+		departed:  make(map[string]time.Time),
+		acks:      make(map[uint64]chan struct{}),
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		stopCh:    make(chan struct{}),
+	}
+	n.members[cfg.Name] = &Member{
+		Name:  cfg.Name,
+		Addr:  cfg.Transport.Addr(),
+		State: StateAlive,
+	}
+	return n, nil
+}
+
+// Start adds this node to the ring, starts the protocol and joins the cluster through the passed seeds.
+func (n *Node) Start(seeds ...string) error {
+	if err := n.cfg.Ring.Add(consistent.NewBin(n.cfg.Name)); err != nil && !errors.Is(err, consistent.ErrBinAlreadyExist) {
+		return err
+	}
+	n.debouncer.mu.Lock()
+	n.debouncer.applied[n.cfg.Name] = true
+	n.debouncer.mu.Unlock()
+
+	n.wg.Add(2)
+	go n.receive()
+	go n.probeLoop()
+
+	n.Join(seeds...)
+	return nil
+}
+
+// Join exchanges the full membership with the nodes of the passed addresses.
+func (n *Node) Join(addrs ...string) {
+	for _, addr := range addrs {
+		if addr == n.cfg.Transport.Addr() {
+			continue
+		}
+		n.send(addr, message{Type: msgSync, Updates: n.state()})
+	}
+}
+
+// Members returns the known members including this node, sorted by name.
+func (n *Node) Members() []Member {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	members := make([]Member, 0, len(n.members))
+	for _, m := range n.members {
+		members = append(members, *m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members
+}
+
+// Leave announces that this node leaves the cluster and stops the node.
+func (n *Node) Leave() error {
+	n.mu.Lock()
+	n.leaving = true
+	n.incarnation++
+	self := n.members[n.cfg.Name]
+	self.State = StateLeft
+	self.Incarnation = n.incarnation
+	u := toUpdate(self)
+	peers := n.peers(StateAlive, StateSuspect)
+	n.mu.Unlock()
+
+	for _, m := range peers {
+		n.send(m.Addr, message{Type: msgGossip, Updates: []update{u}})
+	}
+
+	n.Shutdown()
+	return n.cfg.Ring.Remove(consistent.NewBin(n.cfg.Name))
+}
+
+// Shutdown stops the node without announcing it. Peers will detect it as a failure.
+func (n *Node) Shutdown() {
+	n.stopOnce.Do(func() {
+		close(n.stopCh)
+		n.cfg.Transport.Close()
+		n.wg.Wait()
+		n.debouncer.stop()
+	})
+}
+
+// receive handles the incoming packets until the transport is closed.
+func (n *Node) receive() {
+	defer n.wg.Done()
+
+	for p := range n.cfg.Transport.Packets() {
+		var msg message
+		if err := json.Unmarshal(p.Payload, &msg); err != nil {
+			continue
+		}
+		n.handle(p.From, msg)
+	}
+}
+
+// handle processes a message from the peer.
+func (n *Node) handle(from string, msg message) {
+	for _, u := range msg.Updates {
+		n.merge(u)
+	}
+
+	switch msg.Type {
+	case msgPing:
+		n.send(from, message{Type: msgAck, Seq: msg.Seq})
+	case msgPingReq:
+		n.wg.Add(1)
+		go n.indirectProbe(from, msg)
+	case msgAck:
+		n.ack(msg.Seq)
+	case msgSync:
+		n.send(from, message{Type: msgSyncReply, Updates: n.state()})
+	}
+}
+
+// probeLoop runs the failure detection until the node is stopped.
+func (n *Node) probeLoop() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.cfg.ProbeInterval)
+	defer ticker.Stop()
+
+	pushPull := time.NewTicker(n.cfg.PushPullInterval)
+	defer pushPull.Stop()
+
+	for {
+		select {
+		case <-n.stopCh:
+			return
+		case <-pushPull.C:
+			n.pushPull()
+		case <-ticker.C:
+			n.expireSuspects()
+			n.forgetDeparted()
+			n.probe()
+		}
+	}
+}
+
+// pushPull exchanges the full membership with a random alive peer.
+func (n *Node) pushPull() {
+	n.mu.Lock()
+	peers := n.peers(StateAlive)
+	if len(peers) == 0 {
+		n.mu.Unlock()
+		return
+	}
+	peer := peers[n.rand.Intn(len(peers))]
+	n.mu.Unlock()
+
+	n.Join(peer.Addr)
+}
+
+// probe checks a member directly and then indirectly through other peers.
+// The member is suspected if neither of them gets an ack within the probe interval.
+func (n *Node) probe() {
+	target, ok := n.nextTarget()
+	if !ok {
+		return
+	}
+
+	seq, ch := n.waitAck()
+	defer n.cancelAck(seq)
+
+	n.send(target.Addr, message{Type: msgPing, Seq: seq})
+	select {
+	case <-ch:
+		return
+	case <-n.stopCh:
+		return
+	case <-time.After(n.cfg.ProbeTimeout):
+	}
+
+	n.mu.Lock()
+	peers := n.peers(StateAlive)
+	n.rand.Shuffle(len(peers), func(i, j int) {
+		peers[i], peers[j] = peers[j], peers[i]
+	})
+	n.mu.Unlock()
+
+	var sent int
+	for _, peer := range peers {
+		if sent >= n.cfg.IndirectChecks {
+			break
+		}
+		if peer.Name == target.Name {
+			continue
+		}
+		n.send(peer.Addr, message{Type: msgPingReq, Seq: seq, Target: target.Addr})
+		sent++
+	}
+
+	wait := n.cfg.ProbeInterval - n.cfg.ProbeTimeout
+	if wait <= 0 {
+		wait = n.cfg.ProbeTimeout
+	}
+	select {
+	case <-ch:
+		return
+	case <-n.stopCh:
+		return
+	case <-time.After(wait):
+	}
+
+	n.merge(update{
+		Name:        target.Name,
+		Addr:        target.Addr,
+		State:       StateSuspect,
+		Incarnation: target.Incarnation,
+	})
+}
+
+// indirectProbe probes the target on behalf of the requester and relays the ack.
+func (n *Node) indirectProbe(from string, req message) {
+	defer n.wg.Done()
+
+	seq, ch := n.waitAck()
+	defer n.cancelAck(seq)
+
+	n.send(req.Target, message{Type: msgPing, Seq: seq})
+	select {
+	case <-ch:
+		n.send(from, message{Type: msgAck, Seq: req.Seq})
+	case <-n.stopCh:
+	case <-time.After(n.cfg.ProbeTimeout):
+	}
+}
+
+// nextTarget returns the next member to probe in a shuffled round-robin order.
+func (n *Node) nextTarget() (Member, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for {
+		if len(n.probeOrder) == 0 {
+			for _, m := range n.peers(StateAlive, StateSuspect) {
+				n.probeOrder = append(n.probeOrder, m.Name)
+			}
+			if len(n.probeOrder) == 0 {
+				return Member{}, false
+			}
+			n.rand.Shuffle(len(n.probeOrder), func(i, j int) {
+				n.probeOrder[i], n.probeOrder[j] = n.probeOrder[j], n.probeOrder[i]
+			})
+		}
+
+		name := n.probeOrder[0]
+		n.probeOrder = n.probeOrder[1:]
+		if m, ok := n.members[name]; ok && m.State.inRing() {
+			return *m, true
+		}
+	}
+}
+
+// expireSuspects declares the members dead whose suspicion has timed out.
+func (n *Node) expireSuspects() {
+	n.mu.Lock()
+	var expired []update
+	for name, since := range n.suspects {
+		if time.Since(since) < n.cfg.SuspicionTimeout {
+			continue
+		}
+		m := n.members[name]
+		expired = append(expired, update{
+			Name:        m.Name,
+			Addr:        m.Addr,
+			State:       StateDead,
+			Incarnation: m.Incarnation,
+		})
+	}
+	n.mu.Unlock()
+
+	for _, u := range expired {
+		n.merge(u)
+	}
+}
+
+// forgetDeparted forgets the dead or left members after the timeout.
+func (n *Node) forgetDeparted() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for name, since := range n.departed {
+		if time.Since(since) < n.cfg.DeadMemberTimeout {
+			continue
+		}
+		delete(n.departed, name)
+		delete(n.members, name)
+		n.debouncer.forget(name)
+	}
+}
+
+// merge applies the update to the local membership following the SWIM precedence rules.
+func (n *Node) merge(u update) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if u.Name == n.cfg.Name {
+		// refute the suspicion by increasing the incarnation.
+		if u.State != StateAlive && u.Incarnation >= n.incarnation && !n.leaving {
+			n.incarnation = u.Incarnation + 1
+			self := n.members[n.cfg.Name]
+			self.Incarnation = n.incarnation
+			n.queue(toUpdate(self))
+		}
+		return
+	}
+
+	m, ok := n.members[u.Name]
+	if !ok {
+		// the death of an unknown member is ignored, so the forgotten members are not learned again.
+		if !u.State.inRing() {
+			return
+		}
+		m = &Member{Name: u.Name, Addr: u.Addr, State: u.State, Incarnation: u.Incarnation}
+		n.members[u.Name] = m
+		n.changed(m, StateLeft)
+		n.queue(u)
+		return
+	}
+
+	var accept bool
+	switch u.State {
+	case StateAlive:
+		accept = u.Incarnation > m.Incarnation
+	case StateSuspect:
+		accept = (m.State == StateAlive && u.Incarnation >= m.Incarnation) ||
+			(m.State == StateSuspect && u.Incarnation > m.Incarnation)
+	case StateDead, StateLeft:
+		accept = (m.State.inRing() && u.Incarnation >= m.Incarnation) ||
+			(!m.State.inRing() && u.Incarnation > m.Incarnation)
+	}
+	if !accept {
+		return
+	}
+
+	prev := m.State
+	m.Addr = u.Addr
+	m.State = u.State
+	m.Incarnation = u.Incarnation
+	n.changed(m, prev)
+	n.queue(u)
+}
+
+// changed tracks the suspicion and schedules the ring update of the member.
+// The caller must hold the lock.
+func (n *Node) changed(m *Member, prev State) {
+	if m.State == StateSuspect {
+		if prev != StateSuspect {
+			n.suspects[m.Name] = time.Now()
+		}
+	} else {
+		delete(n.suspects, m.Name)
+	}
+
+	if m.State.inRing() {
+		delete(n.departed, m.Name)
+	} else if prev.inRing() {
+		n.departed[m.Name] = time.Now()
+	}
+
+	if prev.inRing() != m.State.inRing() {
+		n.debouncer.set(m.Name, m.State.inRing())
+	}
+}
+
+// queue enqueues the update to be piggybacked, replacing the older update of the same member.
+// The caller must hold the lock.
+func (n *Node) queue(u update) {
+	transmits := n.cfg.RetransmitMult * int(math.Ceil(math.Log10(float64(len(n.members)+1))))
+	if transmits < 1 {
+		transmits = 1
+	}
+
+	for _, b := range n.broadcasts {
+		if b.update.Name == u.Name {
+			b.update = u
+			b.transmits = transmits
+			return
+		}
+	}
+	n.broadcasts = append(n.broadcasts, &broadcast{update: u, transmits: transmits})
+}
+
+// piggyback pops the updates to be sent with a message.
+func (n *Node) piggyback() []update {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var updates []update
+	remaining := n.broadcasts[:0]
+	for _, b := range n.broadcasts {
+		if len(updates) < maxPiggyback {
+			updates = append(updates, b.update)
+			b.transmits--
+		}
+		if b.transmits > 0 {
+			remaining = append(remaining, b)
+		}
+	}
+	n.broadcasts = remaining
+	return updates
+}
+
+// state returns the full membership to be synchronized with a peer.
+func (n *Node) state() []update {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	updates := make([]update, 0, len(n.members))
+	for _, m := range n.members {
+		updates = append(updates, toUpdate(m))
+	}
+	return updates
+}
+
+// peers returns the members other than this node in the passed states.
+// The caller must hold the lock.
+func (n *Node) peers(states ...State) []Member {
+	var peers []Member
+	for _, m := range n.members {
+		if m.Name == n.cfg.Name {
+			continue
+		}
+		for _, s := range states {
+			if m.State == s {
+				peers = append(peers, *m)
+				break
+			}
+		}
+	}
+	return peers
+}
+
+// waitAck registers a new sequence number to wait for the ack.
+func (n *Node) waitAck() (uint64, <-chan struct{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.seq++
+	ch := make(chan struct{}, 1)
+	n.acks[n.seq] = ch
+	return n.seq, ch
+}
+
+// cancelAck stops waiting for the ack.
+func (n *Node) cancelAck(seq uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.acks, seq)
+}
+
+// ack notifies the waiting probe of the ack.
+func (n *Node) ack(seq uint64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if ch, ok := n.acks[seq]; ok {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// send encodes the message with the piggybacked updates and sends it to the address.
+func (n *Node) send(addr string, msg message) {
+	if msg.Type != msgSync && msg.Type != msgSyncReply {
+		msg.Updates = append(msg.Updates, n.piggyback()...)
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	// the delivery is not guaranteed, the failure is detected by the protocol.
+	_ = n.cfg.Transport.Send(addr, b)
+}
+
+// messageType represents the type of the protocol message.
+type messageType int
+
+const (
+	msgPing messageType = iota
+	msgPingReq
+	msgAck
+	msgSync
+	msgSyncReply
+	msgGossip
+)
+
+// message is the protocol message exchanged between nodes.
+type message struct {
+	Type    messageType `json:"type"`
+	Seq     uint64      `json:"seq,omitempty"`
+	Target  string      `json:"target,omitempty"`
+	Updates []update    `json:"updates,omitempty"`
+}
+
+// update is the state of a member disseminated by the gossip.
+type update struct {
+	Name        string `json:"name"`
+	Addr        string `json:"addr"`
+	State       State  `json:"state"`
+	Incarnation uint64 `json:"incarnation"`
+}
+
+// toUpdate converts the member to an update.
+func toUpdate(m *Member) update {
+	return update{
+		Name:        m.Name,
+		Addr:        m.Addr,
+		State:       m.State,
+		Incarnation: m.Incarnation,
+	}
+}
+
+// debouncer applies the membership changes to the ring once they are stable for the delay.
+type debouncer struct {
+	ring    Ring
+	delay   time.Duration
+	onError func(error)
+
+	// amu serializes the changes applied to the ring. It's held without mu while the ring is rebuilt,
+	// so a slow rebuild never blocks set, which is called while the node holds its lock.
+	amu sync.Mutex
+
+	mu      sync.Mutex
+	stopped bool
+	applied map[string]bool
+	desired map[string]bool
+	timers  map[string]*time.Timer
+}
+
+// newDebouncer generates a new debouncer.
+func newDebouncer(ring Ring, delay time.Duration, onError func(error)) *debouncer {
+	return &debouncer{
+		ring:    ring,
+		delay:   delay,
+		onError: onError,
+		applied: make(map[string]bool),
+		desired: make(map[string]bool),
+		timers:  make(map[string]*time.Timer),
+	}
+}
+
+// set records whether the bin should be in the ring and (re)starts the timer to apply it.
+func (d *debouncer) set(name string, present bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.stopped {
+		return
+	}
+
+	d.desired[name] = present
+	if t, ok := d.timers[name]; ok {
+		t.Stop()
+	}
+	d.timers[name] = time.AfterFunc(d.delay, func() {
+		d.fire(name)
+	})
+}
+
+// fire applies the desired state of the bin if it differs from the ring.
+// The desired state is taken under mu and applied after releasing it. The state set while it's applied is
+// applied by the next timer.
+func (d *debouncer) fire(name string) {
+	d.amu.Lock()
+	defer d.amu.Unlock()
+
+	d.mu.Lock()
+	if d.stopped {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.timers, name)
+	want := d.desired[name]
+	applied := d.applied[name]
+	d.mu.Unlock()
+
+	if applied == want {
+		return
+	}
+
+	var err error
+	bin := consistent.NewBin(name)
+	if want {
+		err = d.ring.Add(bin)
+		if errors.Is(err, consistent.ErrBinAlreadyExist) {
+			err = nil
+		}
+	} else {
+		err = d.ring.Remove(bin)
+	}
+	if err != nil {
+		if d.onError != nil {
+			d.onError(err)
+		}
+		return
+	}
+
+	d.mu.Lock()
+	d.applied[name] = want
+	d.mu.Unlock()
+}
+
+// forget drops the state of the bin which is not in the ring.
+// A pending timer of the bin applies nothing after it.
+func (d *debouncer) forget(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.applied[name] {
+		return
+	}
+	delete(d.applied, name)
+	delete(d.desired, name)
+}
+
+// stop cancels all pending changes and waits for the change being applied.
+func (d *debouncer) stop() {
+	d.mu.Lock()
+	d.stopped = true
+	for _, t := range d.timers {
+		t.Stop()
+	}
+	d.mu.Unlock()
+
+	d.amu.Lock()
+	d.amu.Unlock()
+}
@@ -0,0 +1,390 @@
+package membership
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/google/go-cmp/cmp"
+)
+
+type hasher struct{}
+
+func (hs hasher) Sum64(data []byte) uint64 {
+	h := fnv.New64()
+	h.Write(data)
+	return h.Sum64()
+}
+
+func newRing(t *testing.T) *consistent.Consistent {
+	t.Helper()
+
+	c, err := consistent.New(&consistent.Config{
+		Partition:              23,
+		ReplicationFactor:      21,
+		LoadBalancingParameter: 1.25,
+		Hasher:                 hasher{},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	return c
+}
+
+type cluster struct {
+	nw    *Network
+	nodes []*Node
+	rings []*consistent.Consistent
+}
+
+func newCluster(t *testing.T, cnt int) *cluster {
+	t.Helper()
+
+	cl := &cluster{nw: NewNetwork()}
+	for i := 0; i < cnt; i++ {
+		tr, err := cl.nw.NewTransport(fmt.Sprintf("addr%d", i))
+		if err != nil {
+			t.Fatalf("failed to create transport: %v", err)
+		}
+
+		ring := newRing(t)
+		n, err := New(Config{
+			Name:              fmt.Sprintf("node%d", i),
+			Transport:         tr,
+			Ring:              ring,
+			ProbeInterval:     20 * time.Millisecond,
+			ProbeTimeout:      10 * time.Millisecond,
+			SuspicionTimeout:  100 * time.Millisecond,
+			Debounce:          20 * time.Millisecond,
+			PushPullInterval:  50 * time.Millisecond,
+			DeadMemberTimeout: 300 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("failed to create node: %v", err)
+		}
+
+		var seeds []string
+		if i > 0 {
+			seeds = []string{"addr0"}
+		}
+		if err := n.Start(seeds...); err != nil {
+			t.Fatalf("failed to start node: %v", err)
+		}
+		t.Cleanup(n.Shutdown)
+
+		cl.nodes = append(cl.nodes, n)
+		cl.rings = append(cl.rings, ring)
+	}
+	return cl
+}
+
+func binNames(c *consistent.Consistent) []string {
+	var names []string
+	for _, bin := range c.GetBins() {
+		names = append(names, bin.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func eventually(t *testing.T, cond func() error) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := cond()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not satisfied: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func ringsHave(cl *cluster, want []string, skip map[int]bool) func() error {
+	return func() error {
+		for i, ring := range cl.rings {
+			if skip[i] {
+				continue
+			}
+			if diff := cmp.Diff(binNames(ring), want); diff != "" {
+				return fmt.Errorf("ring of node%d mismatch(-got,+want):%s", i, diff)
+			}
+		}
+		return nil
+	}
+}
+
+func TestNew(t *testing.T) {
+	nw := NewNetwork()
+	tr, err := nw.NewTransport("addr")
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+
+	type testcase struct {
+		cfg  Config
+		want error
+	}
+
+	tcs := map[string]testcase{
+		"ok": {
+			cfg: Config{Name: "node", Transport: tr, Ring: newRing(t)},
+		},
+		"no name": {
+			cfg:  Config{Transport: tr, Ring: newRing(t)},
+			want: ErrNoName,
+		},
+		"no transport": {
+			cfg:  Config{Name: "node", Ring: newRing(t)},
+			want: ErrNoTransport,
+		},
+		"no ring": {
+			cfg:  Config{Name: "node", Transport: tr},
+			want: ErrNoRing,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := New(tc.cfg); err != tc.want {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestNode_Join(t *testing.T) {
+	cl := newCluster(t, 5)
+
+	want := []string{"node0", "node1", "node2", "node3", "node4"}
+	eventually(t, ringsHave(cl, want, nil))
+
+	for i, n := range cl.nodes {
+		for _, m := range n.Members() {
+			if m.State != StateAlive {
+				t.Fatalf("member %s of node%d should be alive, got:%s", m.Name, i, m.State)
+			}
+		}
+	}
+}
+
+func TestNode_Failure(t *testing.T) {
+	cl := newCluster(t, 5)
+	eventually(t, ringsHave(cl, []string{"node0", "node1", "node2", "node3", "node4"}, nil))
+
+	cl.nw.Disconnect("addr3")
+	eventually(t, ringsHave(cl, []string{"node0", "node1", "node2", "node4"}, map[int]bool{3: true}))
+
+	// the failed node comes back and refutes its death.
+	cl.nw.Reconnect("addr3")
+	cl.nodes[3].Join("addr0")
+	eventually(t, ringsHave(cl, []string{"node0", "node1", "node2", "node3", "node4"}, nil))
+}
+
+func TestNode_Leave(t *testing.T) {
+	cl := newCluster(t, 4)
+	eventually(t, ringsHave(cl, []string{"node0", "node1", "node2", "node3"}, nil))
+
+	if err := cl.nodes[1].Leave(); err != nil {
+		t.Fatalf("failed to leave: %v", err)
+	}
+	eventually(t, ringsHave(cl, []string{"node0", "node2", "node3"}, map[int]bool{1: true}))
+
+	for _, m := range cl.nodes[0].Members() {
+		if m.Name == "node1" && m.State != StateLeft {
+			t.Fatalf("member should have left, got:%s", m.State)
+		}
+	}
+}
+
+func TestNode_ForgetDeparted(t *testing.T) {
+	cl := newCluster(t, 3)
+	eventually(t, ringsHave(cl, []string{"node0", "node1", "node2"}, nil))
+
+	if err := cl.nodes[1].Leave(); err != nil {
+		t.Fatalf("failed to leave: %v", err)
+	}
+	eventually(t, func() error {
+		for _, i := range []int{0, 2} {
+			var names []string
+			for _, m := range cl.nodes[i].Members() {
+				names = append(names, m.Name)
+			}
+			if diff := cmp.Diff(names, []string{"node0", "node2"}); diff != "" {
+				return fmt.Errorf("members of node%d mismatch(-got,+want):%s", i, diff)
+			}
+		}
+		return nil
+	})
+	if diff := cmp.Diff(binNames(cl.rings[0]), []string{"node0", "node2"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	d := cl.nodes[0].debouncer
+	d.mu.Lock()
+	_, ok := d.desired["node1"]
+	d.mu.Unlock()
+	if ok {
+		t.Fatal("debouncer should forget the departed member")
+	}
+}
+
+type recordRing struct {
+	mu  sync.Mutex
+	ops []string
+}
+
+func (r *recordRing) Add(bin consistent.Bin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, "add:"+bin.String())
+	return nil
+}
+
+func (r *recordRing) Remove(bin consistent.Bin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, "remove:"+bin.String())
+	return nil
+}
+
+func (r *recordRing) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.ops, ",")
+}
+
+func TestDebouncer(t *testing.T) {
+	type testcase struct {
+		changes []bool
+		want    string
+	}
+
+	tcs := map[string]testcase{
+		"join": {
+			changes: []bool{true},
+			want:    "add:node",
+		},
+		"flapping member ends alive": {
+			changes: []bool{true, false, true, false, true},
+			want:    "add:node",
+		},
+		"flapping member ends dead": {
+			changes: []bool{true, false, true, false},
+			want:    "",
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			ring := &recordRing{}
+			d := newDebouncer(ring, 50*time.Millisecond, nil)
+			for _, present := range tc.changes {
+				d.set("node", present)
+			}
+
+			time.Sleep(200 * time.Millisecond)
+			d.stop()
+
+			if got := ring.String(); got != tc.want {
+				t.Fatalf("mismatch, got:%q, want:%q", got, tc.want)
+			}
+		})
+	}
+}
+
+// blockingRing blocks the changes until release is closed.
+type blockingRing struct {
+	recordRing
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (r *blockingRing) Add(bin consistent.Bin) error {
+	r.once.Do(func() {
+		close(r.started)
+	})
+	<-r.release
+	return r.recordRing.Add(bin)
+}
+
+func TestDebouncer_SlowRing(t *testing.T) {
+	ring := &blockingRing{started: make(chan struct{}), release: make(chan struct{})}
+	d := newDebouncer(ring, 0, nil)
+	d.set("node0", true)
+	<-ring.started
+
+	// the changes are recorded while the ring is being changed.
+	done := make(chan struct{})
+	go func() {
+		d.set("node1", true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("set should not wait for the ring")
+	}
+
+	close(ring.release)
+	eventually(t, func() error {
+		if got, want := ring.String(), "add:node0,add:node1"; got != want {
+			return fmt.Errorf("mismatch, got:%q, want:%q", got, want)
+		}
+		return nil
+	})
+	d.stop()
+}
+
+func TestNetwork_NewTransport(t *testing.T) {
+	nw := NewNetwork()
+	if _, err := nw.NewTransport("addr"); err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	if _, err := nw.NewTransport("addr"); err != ErrAddressInUse {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrAddressInUse)
+	}
+}
+
+func TestUDPTransport(t *testing.T) {
+	a, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp is not available: %v", err)
+	}
+	defer a.Close()
+
+	b, err := NewUDPTransport("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to create transport: %v", err)
+	}
+	defer b.Close()
+
+	if err := a.Send(b.Addr(), []byte("hello")); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	select {
+	case p := <-b.Packets():
+		if string(p.Payload) != "hello" || p.From != a.Addr() {
+			t.Fatalf("packet mismatch, got:%+v", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("packet not received")
+	}
+}
@@ -0,0 +1,239 @@
+package membership
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// packetBufferSize is the number of packets buffered by a transport before dropping.
+const packetBufferSize = 1024
+
+var (
+	// ErrAddressInUse represents an error which means the address is already used by another transport.
+	ErrAddressInUse = errors.New("address already in use")
+
+	// ErrTransportClosed represents an error which means the transport has been closed.
+	ErrTransportClosed = errors.New("transport closed")
+)
+
+// Packet represents a message received from a peer.
+type Packet struct {
+	// From is the address of the sender.
+	From string
+
+	// Payload is the encoded message.
+	Payload []byte
+}
+
+// Transport is responsible for delivering packets between nodes.
+// Like UDP, it doesn't have to guarantee the delivery or the order of the packets.
+type Transport interface {
+	// Addr returns the address of this transport which peers use to reach it.
+	Addr() string
+
+	// Send sends the payload to the passed address.
+	Send(addr string, payload []byte) error
+
+	// Packets returns the channel of the received packets.
+	// The channel is closed when the transport is closed.
+	Packets() <-chan Packet
+
+	// Close stops the transport.
+	Close() error
+}
+
+// Network is an in-memory network which connects in-process transports.
+// It's useful to run many nodes in a single process, e.g. in tests.
+type Network struct {
+	mu           sync.RWMutex
+	transports   map[string]*memoryTransport
+	disconnected map[string]bool
+}
+
+// NewNetwork generates a new in-memory network.
+func NewNetwork() *Network {
+	return &Network{
+		transports:   make(map[string]*memoryTransport),
+		disconnected: make(map[string]bool),
+	}
+}
+
+// NewTransport generates a new transport attached to the network with the passed address.
+func (nw *Network) NewTransport(addr string) (Transport, error) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	if _, ok := nw.transports[addr]; ok {
+		return nil, ErrAddressInUse
+	}
+
+	t := &memoryTransport{
+		nw:   nw,
+		addr: addr,
+		ch:   make(chan Packet, packetBufferSize),
+	}
+	nw.transports[addr] = t
+	return t, nil
+}
+
+// Disconnect drops all packets sent from or to the address until Reconnect is called.
+// It's useful to simulate a failure of a node.
+func (nw *Network) Disconnect(addr string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	nw.disconnected[addr] = true
+}
+
+// Reconnect restores the packet delivery of the address.
+func (nw *Network) Reconnect(addr string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	delete(nw.disconnected, addr)
+}
+
+// deliver sends the packet to the transport of the address.
+// Packets are silently dropped like UDP if they can't be delivered.
+func (nw *Network) deliver(from, to string, payload []byte) {
+	nw.mu.RLock()
+	defer nw.mu.RUnlock()
+
+	if nw.disconnected[from] || nw.disconnected[to] {
+		return
+	}
+
+	t, ok := nw.transports[to]
+	if !ok {
+		return
+	}
+
+	b := make([]byte, len(payload))
+	copy(b, payload)
+	select {
+	case t.ch <- Packet{From: from, Payload: b}:
+	default:
+		// the receiver is too slow, drop the packet.
+	}
+}
+
+// memoryTransport is a transport on the in-memory network.
+type memoryTransport struct {
+	nw     *Network
+	addr   string
+	ch     chan Packet
+	closed bool
+}
+
+// Addr returns the address of the transport.
+func (t *memoryTransport) Addr() string {
+	return t.addr
+}
+
+// Send sends the payload to the passed address on the network.
+func (t *memoryTransport) Send(addr string, payload []byte) error {
+	t.nw.mu.RLock()
+	closed := t.closed
+	t.nw.mu.RUnlock()
+
+	if closed {
+		return ErrTransportClosed
+	}
+
+	t.nw.deliver(t.addr, addr, payload)
+	return nil
+}
+
+// Packets returns the channel of the received packets.
+func (t *memoryTransport) Packets() <-chan Packet {
+	return t.ch
+}
+
+// Close detaches the transport from the network.
+func (t *memoryTransport) Close() error {
+	t.nw.mu.Lock()
+	defer t.nw.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	delete(t.nw.transports, t.addr)
+	close(t.ch)
+	return nil
+}
+
+// UDPTransport is a transport over UDP.
+// Each message must fit in a single datagram.
+type UDPTransport struct {
+	conn *net.UDPConn
+	ch   chan Packet
+}
+
+// NewUDPTransport generates a new transport listening on the passed address.
+func NewUDPTransport(addr string) (*UDPTransport, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &UDPTransport{
+		conn: conn,
+		ch:   make(chan Packet, packetBufferSize),
+	}
+	go t.listen()
+	return t, nil
+}
+
+// listen reads the datagrams until the connection is closed.
+func (t *UDPTransport) listen() {
+	defer close(t.ch)
+
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		b := make([]byte, n)
+		copy(b, buf[:n])
+		select {
+		case t.ch <- Packet{From: from.String(), Payload: b}:
+		default:
+			// the receiver is too slow, drop the packet.
+		}
+	}
+}
+
+// Addr returns the local address of the transport.
+func (t *UDPTransport) Addr() string {
+	return t.conn.LocalAddr().String()
+}
+
+// Send sends the payload to the passed address.
+func (t *UDPTransport) Send(addr string, payload []byte) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.conn.WriteToUDP(payload, raddr)
+	return err
+}
+
+// Packets returns the channel of the received packets.
+func (t *UDPTransport) Packets() <-chan Packet {
+	return t.ch
+}
+
+// Close closes the underlying connection.
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,284 @@
+// Package metrics exposes the state of the consistent hash ring in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+)
+
+const (
+	// namespace is the prefix of all metric names.
+	namespace = "consistent"
+
+	// contentType is the content type of the Prometheus text exposition format.
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// DefaultLocateBuckets are the default buckets of the locate latency histogram in seconds.
+	DefaultLocateBuckets = []float64{.000001, .0000025, .000005, .00001, .000025, .00005, .0001, .00025, .0005, .001, .01}
+
+	// DefaultMovedBuckets are the default buckets of the moved partitions histogram.
+	DefaultMovedBuckets = []float64{0, 1, 10, 100, 1000, 10000, 100000}
+)
+
+// Config represents a configuration of the collector.
+type Config struct {
+	// LocateBuckets are the upper bounds of the locate latency histogram in seconds.
+	// DefaultLocateBuckets are used if it's empty.
+	LocateBuckets []float64
+
+	// MovedBuckets are the upper bounds of the moved partitions histogram.
+	// DefaultMovedBuckets are used if it's empty.
+	MovedBuckets []float64
+}
+
+// Collector collects the metrics of a consistent hash ring.
+// It implements http.Handler to be scraped by Prometheus.
+type Collector struct {
+	ring        *consistent.Consistent
+	unsubscribe func()
+
+	mu      sync.Mutex
+	adds    uint64
+	removes uint64
+	balls   uint64
+	excess  uint64
+	moved   *histogram
+	locate  *histogram
+}
+
+// New generates a new Collector which observes the passed ring.
+// The collector should be closed by Close when it's no longer used.
+func New(c *consistent.Consistent, cfg *Config) *Collector {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+
+	locateBuckets := cfg.LocateBuckets
+	if len(locateBuckets) == 0 {
+		locateBuckets = DefaultLocateBuckets
+	}
+	movedBuckets := cfg.MovedBuckets
+	if len(movedBuckets) == 0 {
+		movedBuckets = DefaultMovedBuckets
+	}
+
+	col := &Collector{
+		ring:   c,
+		moved:  newHistogram(movedBuckets),
+		locate: newHistogram(locateBuckets),
+	}
+	col.unsubscribe = c.Subscribe(col.observe)
+	return col
+}
+
+// Close stops observing the ring.
+func (col *Collector) Close() {
+	col.unsubscribe()
+}
+
+// observe records the ring event.
+func (col *Collector) observe(e consistent.Event) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+
+	switch e.Type {
+	case consistent.EventBinAdded:
+		col.adds++
+	case consistent.EventBinRemoved:
+		col.removes++
+	default:
+		return
+	}
+	col.moved.observe(float64(e.Moved))
+	col.balls += uint64(e.BallsMoved)
+	if e.Moved > e.MinimumMoved {
+		col.excess += uint64(e.Moved - e.MinimumMoved)
+	}
+}
+
+// Locate finds a home for given ball and records the latency of the lookup.
+func (col *Collector) Locate(ball consistent.Ball) *consistent.Bin {
+	start := time.Now()
+	bin := col.ring.Locate(ball)
+	col.ObserveLocate(time.Since(start))
+	return bin
+}
+
+// ObserveLocate records the latency of a lookup which was done outside of the collector.
+func (col *Collector) ObserveLocate(d time.Duration) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+
+	col.locate.observe(d.Seconds())
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (col *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if _, err := col.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format to w.
+func (col *Collector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: bufio.NewWriter(w)}
+
+	loads := col.ring.LoadDistribution()
+	bins := make([]string, 0, len(loads))
+	for bin := range loads {
+		bins = append(bins, bin)
+	}
+	sort.Strings(bins)
+
+	writeHeader(cw, "bins", "gauge", "Number of bins in the ring.")
+	writeSample(cw, "bins", "", float64(len(bins)))
+
+	writeHeader(cw, "maximum_load", "gauge", "Maximum number of partitions a bin can own.")
+	writeSample(cw, "maximum_load", "", col.ring.MaximumLoad())
+
+	writeHeader(cw, "bin_partitions", "gauge", "Number of partitions owned by the bin.")
+	for _, bin := range bins {
+		writeSample(cw, "bin_partitions", labels("bin", bin), loads[bin])
+	}
+
+	writeHeader(cw, "bin_balls", "gauge", "Number of balls located to the bin.")
+	if balls, err := col.ring.BallDistribution(); err == nil {
+		for _, bin := range bins {
+			count, ok := balls[bin]
+			if !ok {
+				// the bin has been removed after the load distribution was taken.
+				continue
+			}
+			writeSample(cw, "bin_balls", labels("bin", bin), float64(count))
+		}
+	}
+
+	col.mu.Lock()
+	writeHeader(cw, "bin_adds_total", "counter", "Number of bins added to the ring.")
+	writeSample(cw, "bin_adds_total", "", float64(col.adds))
+
+	writeHeader(cw, "bin_removes_total", "counter", "Number of bins removed from the ring.")
+	writeSample(cw, "bin_removes_total", "", float64(col.removes))
+
+	writeHeader(cw, "partitions_moved", "histogram", "Number of partitions moved to another bin per membership change.")
+	col.moved.write(cw, "partitions_moved")
+
+	writeHeader(cw, "partitions_moved_excess_total", "counter", "Number of partitions moved beyond the minimum required by the membership changes.")
+	writeSample(cw, "partitions_moved_excess_total", "", float64(col.excess))
+
+	writeHeader(cw, "balls_moved_total", "counter", "Number of balls moved to another bin by the membership changes.")
+	writeSample(cw, "balls_moved_total", "", float64(col.balls))
+
+	writeHeader(cw, "locate_duration_seconds", "histogram", "Latency of the ball lookups in seconds.")
+	col.locate.write(cw, "locate_duration_seconds")
+	col.mu.Unlock()
+
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// histogram is a cumulative histogram which is compatible with the Prometheus histogram.
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// newHistogram generates a new histogram with the passed upper bounds.
+func newHistogram(buckets []float64) *histogram {
+	bs := make([]float64, len(buckets))
+	copy(bs, buckets)
+	sort.Float64s(bs)
+
+	return &histogram{
+		buckets: bs,
+		counts:  make([]uint64, len(bs)),
+	}
+}
+
+// observe records the value.
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// write writes the samples of the histogram.
+func (h *histogram) write(w *countWriter, name string) {
+	for i, b := range h.buckets {
+		writeSample(w, name+"_bucket", labels("le", formatFloat(b)), float64(h.counts[i]))
+	}
+	writeSample(w, name+"_bucket", labels("le", "+Inf"), float64(h.count))
+	writeSample(w, name+"_sum", "", h.sum)
+	writeSample(w, name+"_count", "", float64(h.count))
+}
+
+// countWriter counts the written bytes and keeps the first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+// printf writes the formatted string unless an error has occurred.
+func (cw *countWriter) printf(format string, args ...interface{}) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric.
+func writeHeader(w *countWriter, name, typ, help string) {
+	w.printf("# HELP %s_%s %s\n", namespace, name, help)
+	w.printf("# TYPE %s_%s %s\n", namespace, name, typ)
+}
+
+// writeSample writes a sample line of the metric.
+func writeSample(w *countWriter, name, labels string, v float64) {
+	w.printf("%s_%s%s %s\n", namespace, name, labels, formatFloat(v))
+}
+
+// labelEscaper escapes the label value according to the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats the label pair.
+func labels(name, value string) string {
+	return fmt.Sprintf(`{%s="%s"}`, name, labelEscaper.Replace(value))
+}
+
+// formatFloat formats the value according to the text exposition format.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KeisukeYamashita/consistent"
+)
+
+type hasher struct{}
+
+func (hs hasher) Sum64(data []byte) uint64 {
+	h := fnv.New64()
+	h.Write(data)
+	return h.Sum64()
+}
+
+type ball string
+
+func (b ball) String() string {
+	return string(b)
+}
+
+func newRing(t *testing.T) *consistent.Consistent {
+	t.Helper()
+
+	c, err := consistent.New(&consistent.Config{
+		Partition:              23,
+		ReplicationFactor:      21,
+		LoadBalancingParameter: 1.1,
+		Hasher:                 hasher{},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	return c
+}
+
+func scrape(t *testing.T, col *Collector) string {
+	t.Helper()
+
+	srv := httptest.NewServer(col)
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("failed to scrape: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != contentType {
+		t.Fatalf("content type mismatch, got:%s, want:%s", ct, contentType)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read body: %v", err)
+	}
+
+	return string(body)
+}
+
+func TestCollector_ServeHTTP(t *testing.T) {
+	type testcase struct {
+		bins    int
+		removes int
+		balls   int
+		want    []string
+	}
+
+	tcs := map[string]testcase{
+		"empty ring": {
+			want: []string{
+				"consistent_bins 0\n",
+				"consistent_bin_adds_total 0\n",
+				"consistent_partitions_moved_count 0\n",
+			},
+		},
+		"bins added": {
+			bins: 4,
+			want: []string{
+				"consistent_bins 4\n",
+				"consistent_maximum_load 7\n",
+				"consistent_bin_adds_total 4\n",
+				"consistent_bin_removes_total 0\n",
+				"consistent_partitions_moved_count 4\n",
+				`consistent_partitions_moved_bucket{le="+Inf"} 4` + "\n",
+				"# TYPE consistent_bin_partitions gauge\n",
+			},
+		},
+		"bins removed": {
+			bins:    4,
+			removes: 2,
+			want: []string{
+				"consistent_bins 2\n",
+				"consistent_bin_adds_total 4\n",
+				"consistent_bin_removes_total 2\n",
+				"consistent_partitions_moved_count 6\n",
+				"# TYPE consistent_partitions_moved_excess_total counter\n",
+				"consistent_balls_moved_total 0\n",
+			},
+		},
+		"balls located": {
+			bins:  1,
+			balls: 10,
+			want: []string{
+				`consistent_bin_partitions{bin="node0"} 23` + "\n",
+				`consistent_bin_balls{bin="node0"} 10` + "\n",
+				"consistent_locate_duration_seconds_count 10\n",
+			},
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			c := newRing(t)
+			col := New(c, nil)
+			defer col.Close()
+
+			for i := 0; i < tc.bins; i++ {
+				if err := c.Add(consistent.NewBin(fmt.Sprintf("node%d", i))); err != nil {
+					t.Fatalf("failed to add bin: %v", err)
+				}
+			}
+			for i := 0; i < tc.removes; i++ {
+				if err := c.Remove(consistent.NewBin(fmt.Sprintf("node%d", i))); err != nil {
+					t.Fatalf("failed to remove bin: %v", err)
+				}
+			}
+			for i := 0; i < tc.balls; i++ {
+				col.Locate(ball(fmt.Sprintf("data%d", i)))
+			}
+
+			got := scrape(t, col)
+			for _, want := range tc.want {
+				if !strings.Contains(got, want) {
+					t.Fatalf("metric not found, want:%q, got:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCollector_ObserveLocate(t *testing.T) {
+	col := New(newRing(t), &Config{LocateBuckets: []float64{0.1, 1}})
+	defer col.Close()
+
+	col.ObserveLocate(50 * time.Millisecond)
+	col.ObserveLocate(500 * time.Millisecond)
+	col.ObserveLocate(5 * time.Second)
+
+	var sb strings.Builder
+	if _, err := col.WriteTo(&sb); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	for _, want := range []string{
+		`consistent_locate_duration_seconds_bucket{le="0.1"} 1`,
+		`consistent_locate_duration_seconds_bucket{le="1"} 2`,
+		`consistent_locate_duration_seconds_bucket{le="+Inf"} 3`,
+		`consistent_locate_duration_seconds_sum 5.55`,
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Fatalf("metric not found, want:%q, got:\n%s", want, sb.String())
+		}
+	}
+}
+
+func TestCollector_Close(t *testing.T) {
+	c := newRing(t)
+	col := New(c, nil)
+	col.Close()
+
+	if err := c.Add(consistent.NewBin("node0")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+
+	var sb strings.Builder
+	if _, err := col.WriteTo(&sb); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if !strings.Contains(sb.String(), "consistent_bin_adds_total 0\n") {
+		t.Fatalf("closed collector should not observe events, got:\n%s", sb.String())
+	}
+}
@@ -0,0 +1,260 @@
+package consistent
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+// Override routes the keys to a bin regardless of the partition of the keys.
+type Override struct {
+	// Key is the key or the prefix of the keys to route.
+	Key string `json:"key"`
+
+	// Prefix makes the override match all keys starting with Key.
+	Prefix bool `json:"prefix,omitempty"`
+
+	// Bin is the name of the bin which the keys are routed to.
+	Bin string `json:"bin"`
+
+	// ExpiresAt is the time the override expires at. It never expires if it's zero.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expired reports whether the override has expired at the time.
+func (o Override) expired(now time.Time) bool {
+	return !o.ExpiresAt.IsZero() && !now.Before(o.ExpiresAt)
+}
+
+// overrides holds the overrides of a table. It's never modified once it's published.
+type overrides struct {
+	// exact is a mapping key to the override of the key.
+	exact map[string]Override
+
+	// prefixes holds the prefix overrides in descending order of the length of the prefix,
+	// so the longest prefix is matched first.
+	prefixes []Override
+}
+
+// empty reports whether there's no override including the expired ones.
+func (ov *overrides) empty() bool {
+	return ov == nil || len(ov.exact)+len(ov.prefixes) == 0
+}
+
+// match returns the override of the key. An exact key takes precedence over the prefixes.
+func (ov *overrides) match(key []byte, now time.Time) (Override, bool) {
+	if ov == nil {
+		return Override{}, false
+	}
+
+	if o, ok := ov.exact[string(key)]; ok && !o.expired(now) {
+		return o, true
+	}
+	for _, o := range ov.prefixes {
+		if bytes.HasPrefix(key, []byte(o.Key)) && !o.expired(now) {
+			return o, true
+		}
+	}
+	return Override{}, false
+}
+
+// list returns the overrides which have not expired, sorted by the key.
+func (ov *overrides) list(now time.Time) []Override {
+	if ov == nil {
+		return []Override{}
+	}
+
+	res := make([]Override, 0, len(ov.exact)+len(ov.prefixes))
+	for _, o := range ov.exact {
+		if !o.expired(now) {
+			res = append(res, o)
+		}
+	}
+	for _, o := range ov.prefixes {
+		if !o.expired(now) {
+			res = append(res, o)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Key != res[j].Key {
+			return res[i].Key < res[j].Key
+		}
+		return !res[i].Prefix && res[j].Prefix
+	})
+	return res
+}
+
+// filter returns the overrides which fn keeps. The expired overrides are dropped.
+func (ov *overrides) filter(now time.Time, fn func(Override) bool) *overrides {
+	res := &overrides{exact: make(map[string]Override)}
+	for _, o := range ov.list(now) {
+		if !fn(o) {
+			continue
+		}
+		if o.Prefix {
+			res.prefixes = append(res.prefixes, o)
+		} else {
+			res.exact[o.Key] = o
+		}
+	}
+
+	sort.SliceStable(res.prefixes, func(i, j int) bool {
+		return len(res.prefixes[i].Key) > len(res.prefixes[j].Key)
+	})
+	return res
+}
+
+// find returns the override of the key which has not expired.
+func (ov *overrides) find(key string, prefix bool, now time.Time) (Override, bool) {
+	if ov == nil {
+		return Override{}, false
+	}
+
+	if !prefix {
+		o, ok := ov.exact[key]
+		return o, ok && !o.expired(now)
+	}
+	for _, o := range ov.prefixes {
+		if o.Key == key && !o.expired(now) {
+			return o, true
+		}
+	}
+	return Override{}, false
+}
+
+// with returns the overrides which have o in addition.
+func (ov *overrides) with(o Override, now time.Time) *overrides {
+	res := ov.filter(now, func(o2 Override) bool {
+		return o2.Key != o.Key || o2.Prefix != o.Prefix
+	})
+	if o.Prefix {
+		res.prefixes = append(res.prefixes, o)
+		sort.SliceStable(res.prefixes, func(i, j int) bool {
+			return len(res.prefixes[i].Key) > len(res.prefixes[j].Key)
+		})
+	} else {
+		res.exact[o.Key] = o
+	}
+	return res
+}
+
+// dropBin returns the overrides without the ones routing to the bin.
+// It returns ov itself if no override routes to the bin.
+func (ov *overrides) dropBin(name string, now time.Time) *overrides {
+	if ov == nil {
+		return nil
+	}
+
+	for _, o := range ov.list(now) {
+		if o.Bin == name {
+			return ov.filter(now, func(o Override) bool {
+				return o.Bin != name
+			})
+		}
+	}
+	return ov
+}
+
+// locate finds a home for given key taking the overrides and the ejected bins into account.
+// The overrides routing to an ejected bin are ignored.
+func (t *table) locate(key []byte) (*Bin, PartitionID) {
+	var now time.Time
+	if !t.overrides.empty() {
+		now = t.now()
+	}
+
+	bin, partID := t.route(key, now)
+	if bin == nil {
+		return nil, partID
+	}
+	bin2 := bin.clone()
+	return &bin2, partID
+}
+
+// route returns the bin serving the key at the time without copying it, so the bin must not be modified.
+// The time is used only if the table has the overrides.
+func (t *table) route(key []byte, now time.Time) (*Bin, PartitionID) {
+	partID := t.findPartitionID(key)
+	if t.overrides.empty() {
+		return t.serving(partID), partID
+	}
+
+	if o, ok := t.overrides.match(key, now); ok {
+		if bin, ok := t.bins[o.Bin]; ok && !t.ejected[o.Bin] {
+			return bin, partID
+		}
+	}
+	return t.serving(partID), partID
+}
+
+// withOverrides returns a copy of the table which has the overrides.
+// The table is immutable, so the copy shares everything else.
+func (t *table) withOverrides(ov *overrides) *table {
+	t2 := *t
+	t2.version++
+	t2.overrides = ov
+	return &t2
+}
+
+// SetOverride routes the key, or the keys starting with the key if o.Prefix is true, to the bin.
+// The override expires after ttl unless ttl is zero. It replaces the override of the same key.
+// The overrides of a bin are dropped when the bin is removed.
+func (c *Consistent) SetOverride(o Override, ttl time.Duration) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if _, ok := c.table.bins[o.Bin]; !ok {
+		return &BinError{Name: o.Bin, Err: ErrBinNotFound}
+	}
+
+	now := c.table.now()
+	o.ExpiresAt = time.Time{}
+	if ttl > 0 {
+		o.ExpiresAt = now.Add(ttl)
+	}
+	t := c.table.withOverrides(c.table.overrides.with(o, now))
+
+	c.mu.Lock()
+	c.table = t
+	c.mu.Unlock()
+
+	c.emit(Event{Type: EventOverrideSet, Bin: t.bins[o.Bin].clone(), Override: o, Version: t.version})
+	return nil
+}
+
+// DeleteOverride deletes the override of the key.
+// It does nothing if the override doesn't exist, so the version doesn't change either.
+func (c *Consistent) DeleteOverride(key string, prefix bool) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	now := c.table.now()
+	o, ok := c.table.overrides.find(key, prefix, now)
+	if !ok {
+		return
+	}
+
+	ov := c.table.overrides.filter(now, func(o Override) bool {
+		return o.Key != key || o.Prefix != prefix
+	})
+	t := c.table.withOverrides(ov)
+
+	c.mu.Lock()
+	c.table = t
+	c.mu.Unlock()
+
+	c.emit(Event{Type: EventOverrideDeleted, Bin: t.bins[o.Bin].clone(), Override: o, Version: t.version})
+}
+
+// Overrides returns the overrides which have not expired, sorted by the key.
+func (c *Consistent) Overrides() []Override {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.table.overrides.list(c.table.now())
+}
+
+// Overrides returns the overrides in the snapshot which have not expired, sorted by the key.
+func (s *Snapshot) Overrides() []Override {
+	return s.t.overrides.list(s.t.now())
+}
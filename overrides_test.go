@@ -0,0 +1,261 @@
+package consistent
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// clock is a manually advanced clock for the overrides.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newOverridden generates a ring which has the overrides of the test.
+func newOverridden(t *testing.T) (*Consistent, *clock) {
+	t.Helper()
+
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	clk := &clock{now: time.Unix(0, 0)}
+	c.table.now = clk.Now
+
+	bins := initialBins(4)
+	overrides := []struct {
+		o   Override
+		ttl time.Duration
+	}{
+		{o: Override{Key: "tenant/vip", Bin: bins[0].String()}},
+		{o: Override{Key: "tenant/", Prefix: true, Bin: bins[1].String()}},
+		{o: Override{Key: "tenant/gold/", Prefix: true, Bin: bins[2].String()}},
+		{o: Override{Key: "tenant/gold/vip", Bin: bins[3].String()}},
+		{o: Override{Key: "temporary", Bin: bins[3].String()}, ttl: time.Minute},
+	}
+	for _, ov := range overrides {
+		if err := c.SetOverride(ov.o, ov.ttl); err != nil {
+			t.Fatalf("failed to set override: %v", err)
+		}
+	}
+	return c, clk
+}
+
+func TestConsistent_Override(t *testing.T) {
+	type testcase struct {
+		key     string
+		advance time.Duration
+		want    string
+	}
+
+	bins := initialBins(4)
+	tcs := map[string]testcase{
+		"exact key": {
+			key:  "tenant/vip",
+			want: bins[0].String(),
+		},
+		"prefix": {
+			key:  "tenant/other",
+			want: bins[1].String(),
+		},
+		"longest prefix": {
+			key:  "tenant/gold/other",
+			want: bins[2].String(),
+		},
+		"exact key over prefix": {
+			key:  "tenant/gold/vip",
+			want: bins[3].String(),
+		},
+		"not expired": {
+			key:     "temporary",
+			advance: time.Second,
+			want:    bins[3].String(),
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			c, clk := newOverridden(t)
+			clk.Advance(tc.advance)
+
+			got, partID := c.Lookup([]byte(tc.key))
+			if got.String() != tc.want {
+				t.Fatalf("bin mismatch, got:%s, want:%s", got.String(), tc.want)
+			}
+			if want := c.FindPartitionID([]byte(tc.key)); partID != want {
+				t.Fatalf("partition mismatch, got:%d, want:%d", partID, want)
+			}
+			if got, _ := c.Snapshot().Lookup([]byte(tc.key)); got.String() != tc.want {
+				t.Fatalf("snapshot bin mismatch, got:%s, want:%s", got.String(), tc.want)
+			}
+			if got := c.Locate(NewBall(tc.key)); got.String() != tc.want {
+				t.Fatalf("located bin mismatch, got:%s, want:%s", got.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestConsistent_OverrideTTL(t *testing.T) {
+	c, clk := newOverridden(t)
+	key := []byte("temporary")
+	natural := c.GetPartitionOwner(c.FindPartitionID(key))
+
+	if got := len(c.Overrides()); got != 5 {
+		t.Fatalf("number of overrides mismatch, got:%d, want:%d", got, 5)
+	}
+
+	clk.Advance(time.Minute)
+	if got, _ := c.Lookup(key); got.String() != natural.String() {
+		t.Fatalf("expired override should be ignored, got:%s, want:%s", got.String(), natural.String())
+	}
+	if got := len(c.Overrides()); got != 4 {
+		t.Fatalf("number of overrides mismatch, got:%d, want:%d", got, 4)
+	}
+
+	c.DeleteOverride("tenant/", true)
+	want := []Override{
+		{Key: "tenant/gold/", Prefix: true, Bin: initialBins(4)[2].String()},
+		{Key: "tenant/gold/vip", Bin: initialBins(4)[3].String()},
+		{Key: "tenant/vip", Bin: initialBins(4)[0].String()},
+	}
+	if diff := cmp.Diff(c.Overrides(), want); diff != "" {
+		t.Fatalf("overrides mismatch (-got,+want):%s", diff)
+	}
+
+	if err := c.SetOverride(Override{Key: "key", Bin: "not exist"}, 0); !errors.Is(err, ErrBinNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrBinNotFound)
+	}
+}
+
+func TestConsistent_OverrideEvents(t *testing.T) {
+	c, clk := newOverridden(t)
+	bins := initialBins(4)
+	var events []Event
+	c.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+	version := c.Version()
+
+	// the overrides which don't exist or have expired are not deleted.
+	clk.Advance(time.Minute)
+	c.DeleteOverride("unknown", false)
+	c.DeleteOverride("temporary", false)
+	c.DeleteOverride("tenant/", false)
+	if got := c.Version(); got != version {
+		t.Fatalf("version should not change, got:%d want:%d", got, version)
+	}
+
+	c.DeleteOverride("tenant/", true)
+	if err := c.SetOverride(Override{Key: "key", Bin: bins[2].String()}, 0); err != nil {
+		t.Fatalf("failed to set override: %v", err)
+	}
+
+	type event struct {
+		Type     EventType
+		Bin      string
+		Override Override
+		Version  uint64
+	}
+	got := make([]event, len(events))
+	for i, e := range events {
+		got[i] = event{Type: e.Type, Bin: e.Bin.String(), Override: e.Override, Version: e.Version}
+	}
+	want := []event{
+		{
+			Type:     EventOverrideDeleted,
+			Bin:      bins[1].String(),
+			Override: Override{Key: "tenant/", Prefix: true, Bin: bins[1].String()},
+			Version:  version + 1,
+		},
+		{
+			Type:     EventOverrideSet,
+			Bin:      bins[2].String(),
+			Override: Override{Key: "key", Bin: bins[2].String()},
+			Version:  version + 2,
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestConsistent_OverrideBalls(t *testing.T) {
+	c, _ := newOverridden(t)
+	bins := initialBins(4)
+	balls := []Ball{NewBall("tenant/vip"), NewBall("tenant/a"), NewBall("tenant/b")}
+	balls = append(balls, initialBalls(30)...)
+	for _, b := range balls {
+		c.Locate(b)
+	}
+
+	for _, bin := range bins {
+		got, err := c.GetBallsByBin(bin)
+		if err != nil {
+			t.Fatalf("failed to get balls: %v", err)
+		}
+		for _, b := range got {
+			if home, _ := c.Lookup([]byte(b.String())); home.String() != bin.String() {
+				t.Fatalf("ball %s should not be in %s, home:%s", b.String(), bin.String(), home.String())
+			}
+		}
+	}
+
+	st := c.State()
+	if diff := cmp.Diff(st.Overrides, c.Overrides()); diff != "" {
+		t.Fatalf("state overrides mismatch (-got,+want):%s", diff)
+	}
+	restored, err := Restore(newConfig(), st)
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if got, _ := restored.Lookup([]byte("tenant/vip")); got.String() != bins[0].String() {
+		t.Fatalf("restored override mismatch, got:%s, want:%s", got.String(), bins[0].String())
+	}
+
+	var events []Event
+	c.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+	before := map[string]string{}
+	for _, b := range balls {
+		home, _ := c.Lookup([]byte(b.String()))
+		before[b.String()] = home.String()
+	}
+	if err := c.Remove(bins[1]); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+
+	var moved int
+	for _, b := range balls {
+		if home, _ := c.Lookup([]byte(b.String())); home.String() != before[b.String()] {
+			moved++
+		}
+	}
+	if events[0].BallsMoved != moved {
+		t.Fatalf("balls moved mismatch, got:%d, want:%d", events[0].BallsMoved, moved)
+	}
+	for _, o := range c.Overrides() {
+		if o.Bin == bins[1].String() {
+			t.Fatalf("overrides of the removed bin should be dropped, got:%v", o)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package consistent
+
+import (
+	"context"
+	"sort"
+)
+
+// PartitionPin represents a partition pinned to a bin.
+type PartitionPin struct {
+	// PartitionID is the ID of the pinned partition.
+	PartitionID PartitionID `json:"partition_id"`
+
+	// Bin is the name of the bin which owns the partition.
+	Bin string `json:"bin"`
+}
+
+// Pin forces the partition to be owned by the bin regardless of the ring.
+// The pinned partitions are counted against the load of the bin, so the bin may receive fewer
+// other partitions. Pinning many partitions to a bin can make the bin exceed the maximum load.
+// The pin is dropped when the bin is removed, and EventPinFailedOver is emitted.
+func (c *Consistent) Pin(partID PartitionID, name string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if partID < 0 || uint64(partID) >= c.partition {
+		return ErrInvalidPartition
+	}
+	bin, ok := c.table.bins[name]
+	if !ok {
+		return &BinError{Name: name, Err: ErrBinNotFound}
+	}
+	if c.table.pins[partID] == name {
+		return nil
+	}
+
+	prev := c.table
+	t := prev.clone()
+	t.pins[partID] = name
+	moved, err := t.rebalance(context.Background(), c.progress)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.table = t
+	c.mu.Unlock()
+
+	e := c.newEvent(EventPartitionPinned, bin.clone(), prev, t, moved)
+	e.Partitions = []PartitionID{partID}
+	c.emit(e)
+	return nil
+}
+
+// Unpin releases the partition from the bin it's pinned to.
+// It does nothing if the partition is not pinned.
+func (c *Consistent) Unpin(partID PartitionID) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	name, ok := c.table.pins[partID]
+	if !ok {
+		return nil
+	}
+
+	prev := c.table
+	t := prev.clone()
+	delete(t.pins, partID)
+	moved, err := t.rebalance(context.Background(), c.progress)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.table = t
+	c.mu.Unlock()
+
+	e := c.newEvent(EventPartitionUnpinned, prev.bins[name].clone(), prev, t, moved)
+	e.Partitions = []PartitionID{partID}
+	c.emit(e)
+	return nil
+}
+
+// Pins returns the pinned partitions in ascending order of the partition ID.
+func (c *Consistent) Pins() []PartitionPin {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.table.listPins()
+}
+
+// Pins returns the pinned partitions in the snapshot in ascending order of the partition ID.
+func (s *Snapshot) Pins() []PartitionPin {
+	return s.t.listPins()
+}
+
+// listPins returns the pinned partitions in ascending order of the partition ID.
+func (t *table) listPins() []PartitionPin {
+	pins := make([]PartitionPin, 0, len(t.pins))
+	for partID, name := range t.pins {
+		pins = append(pins, PartitionPin{PartitionID: partID, Bin: name})
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].PartitionID < pins[j].PartitionID
+	})
+	return pins
+}
+
+// unpinBin drops the pins of the bin.
+// It returns the partitions which were pinned to the bin in ascending order.
+func (t *table) unpinBin(name string) []PartitionID {
+	var res []PartitionID
+	for partID, bin := range t.pins {
+		if bin == name {
+			res = append(res, partID)
+			delete(t.pins, partID)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res
+}
@@ -0,0 +1,135 @@
+package consistent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConsistent_Pin(t *testing.T) {
+	type testcase struct {
+		partID PartitionID
+		bin    string
+		want   error
+	}
+
+	tcs := map[string]testcase{
+		"pin": {
+			partID: 3,
+			bin:    initialBins(4)[2].String(),
+		},
+		"partition out of range": {
+			partID: PartitionID(newConfig().Partition),
+			bin:    initialBins(4)[2].String(),
+			want:   ErrInvalidPartition,
+		},
+		"negative partition": {
+			partID: -1,
+			bin:    initialBins(4)[2].String(),
+			want:   ErrInvalidPartition,
+		},
+		"not existing bin": {
+			partID: 3,
+			bin:    "not exist",
+			want:   ErrBinNotFound,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := New(newConfig(), initialBins(4))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+			want := owners(c)
+
+			var events []Event
+			c.Subscribe(func(e Event) {
+				events = append(events, e)
+			})
+
+			if err := c.Pin(tc.partID, tc.bin); !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+			if tc.want != nil {
+				return
+			}
+
+			if got := c.GetPartitionOwner(tc.partID).String(); got != tc.bin {
+				t.Fatalf("owner mismatch, got:%s, want:%s", got, tc.bin)
+			}
+			if diff := cmp.Diff(c.Pins(), []PartitionPin{{PartitionID: tc.partID, Bin: tc.bin}}); diff != "" {
+				t.Fatalf("pins mismatch (-got,+want):%s", diff)
+			}
+			if diff := cmp.Diff(c.Snapshot().Pins(), c.Pins()); diff != "" {
+				t.Fatalf("snapshot pins mismatch (-got,+want):%s", diff)
+			}
+			for name, load := range c.LoadDistribution() {
+				if load > c.MaximumLoad() {
+					t.Fatalf("load of %s exceeds the maximum, got:%f", name, load)
+				}
+			}
+
+			if err := c.Unpin(tc.partID); err != nil {
+				t.Fatalf("failed to unpin: %v", err)
+			}
+			if diff := cmp.Diff(owners(c), want); diff != "" {
+				t.Fatalf("placement should be restored (-got,+want):%s", diff)
+			}
+			if len(c.Pins()) != 0 {
+				t.Fatalf("pins should be empty, got:%v", c.Pins())
+			}
+
+			var types []EventType
+			for _, e := range events {
+				types = append(types, e.Type)
+			}
+			if diff := cmp.Diff(types, []EventType{EventPartitionPinned, EventPartitionUnpinned}); diff != "" {
+				t.Fatalf("events mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestConsistent_PinFailOver(t *testing.T) {
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	bins := initialBins(4)
+	for _, partID := range []PartitionID{7, 1} {
+		if err := c.Pin(partID, bins[0].String()); err != nil {
+			t.Fatalf("failed to pin: %v", err)
+		}
+	}
+	if err := c.Pin(2, bins[1].String()); err != nil {
+		t.Fatalf("failed to pin: %v", err)
+	}
+
+	var events []Event
+	c.Subscribe(func(e Event) {
+		events = append(events, e)
+	})
+	if err := c.Remove(bins[0]); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+
+	if len(events) != 2 || events[0].Type != EventBinRemoved || events[1].Type != EventPinFailedOver {
+		t.Fatalf("events mismatch, got:%v", events)
+	}
+	if diff := cmp.Diff(events[1].Partitions, []PartitionID{1, 7}); diff != "" {
+		t.Fatalf("failed over partitions mismatch (-got,+want):%s", diff)
+	}
+	if diff := cmp.Diff(c.Pins(), []PartitionPin{{PartitionID: 2, Bin: bins[1].String()}}); diff != "" {
+		t.Fatalf("pins mismatch (-got,+want):%s", diff)
+	}
+	for _, partID := range []PartitionID{1, 7} {
+		if owner := c.GetPartitionOwner(partID); owner == nil || owner.String() == bins[0].String() {
+			t.Fatalf("partition %d should fail over, got:%v", partID, owner)
+		}
+	}
+}
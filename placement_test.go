@@ -0,0 +1,301 @@
+package consistent
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// collidingHasher maps the keys to a few hashes, so the virtual nodes of the bins collide.
+type collidingHasher struct{}
+
+func (hs collidingHasher) Sum64(data []byte) uint64 {
+	return hasher{}.Sum64(data) % 64
+}
+
+// owners returns the names of the owners indexed by the partition ID.
+func owners(c *Consistent) []string {
+	res := make([]string, c.partition)
+	for partID := range res {
+		if bin := c.GetPartitionOwner(PartitionID(partID)); bin != nil {
+			res[partID] = bin.String()
+		}
+	}
+	return res
+}
+
+func TestPlacement_Golden(t *testing.T) {
+	type testcase struct {
+		cfg  *Config
+		bins []Bin
+	}
+
+	tcs := map[string]testcase{
+		"small": {
+			cfg:  newConfig(),
+			bins: initialBins(4),
+		},
+		"medium": {
+			cfg: &Config{
+				Partition:              271,
+				ReplicationFactor:      20,
+				LoadBalancingParameter: 1.25,
+				Hasher:                 hasher{},
+				PlacementVersion:       PlacementV1,
+			},
+			bins: initialBins(10),
+		},
+		"large": {
+			cfg: &Config{
+				Partition:              1021,
+				ReplicationFactor:      50,
+				LoadBalancingParameter: 1.05,
+				Hasher:                 hasher{},
+				PlacementVersion:       PlacementV1,
+			},
+			bins: []Bin{
+				NewBin("10.0.0.1:6379"),
+				NewBin("10.0.0.2:6379"),
+				NewBin("10.0.0.3:6379"),
+				NewBin("10.0.0.4:6379"),
+				NewBin("10.0.0.5:6379"),
+				NewBin("10.0.0.6:6379"),
+				NewBin("10.0.0.7:6379"),
+			},
+		},
+	}
+
+	path := filepath.Join("testdata", "placement_v1.golden")
+	got := map[string][]string{}
+	for n, tc := range tcs {
+		c, err := New(tc.cfg, tc.bins)
+		if err != nil {
+			t.Fatalf("failed to create consistent: %v", err)
+		}
+		got[n] = owners(c)
+	}
+
+	if *update {
+		b, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+		if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	want := map[string][]string{}
+	if err := json.Unmarshal(b, &want); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	// the placement must never change within a placement version.
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Fatalf("placement changed (-got,+want):%s", diff)
+	}
+}
+
+func TestPlacement_OrderIndependent(t *testing.T) {
+	type testcase struct {
+		hasher Hasher
+	}
+
+	tcs := map[string]testcase{
+		"fnv": {
+			hasher: hasher{},
+		},
+		"colliding hashes": {
+			hasher: collidingHasher{},
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.Hasher = tc.hasher
+			cfg.Partition = 7
+			cfg.ReplicationFactor = 4
+			cfg.LoadBalancingParameter = 2
+
+			bins := initialBins(8)
+			want, err := New(cfg, bins)
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 10; i++ {
+				shuffled := make([]Bin, len(bins))
+				copy(shuffled, bins)
+				r.Shuffle(len(shuffled), func(i, j int) {
+					shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+				})
+
+				c, err := New(cfg, shuffled[:1])
+				if err != nil {
+					t.Fatalf("failed to create consistent: %v", err)
+				}
+				// add and remove the extra bin to see the ring doesn't remember it.
+				extra := NewBin(fmt.Sprintf("%s%d", binPrefix, 100+i))
+				for _, bin := range append(shuffled[1:], extra) {
+					if err := c.Add(bin); err != nil && !errors.Is(err, ErrInsufficientPartitionCapacity) {
+						t.Fatalf("failed to add bin: %v", err)
+					}
+				}
+				if err := c.Remove(extra); err != nil {
+					t.Fatalf("failed to remove bin: %v", err)
+				}
+
+				if diff := cmp.Diff(owners(c), owners(want)); diff != "" {
+					t.Fatalf("mismatch (-got,+want):%s", diff)
+				}
+				if diff := cmp.Diff(c.table.sortedSet, want.table.sortedSet); diff != "" {
+					t.Fatalf("ring mismatch (-got,+want):%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestPlacement_UnsupportedVersion(t *testing.T) {
+	cfg := newConfig()
+	cfg.PlacementVersion = 2
+	if _, err := New(cfg, initialBins(2)); !errors.Is(err, ErrUnsupportedPlacementVersion) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrUnsupportedPlacementVersion)
+	}
+}
+
+func TestPlacement_Workers(t *testing.T) {
+	type testcase struct {
+		partition uint64
+		lbp       float64
+		bins      int
+	}
+
+	tcs := map[string]testcase{
+		"single chunk": {
+			partition: 3*minPartitionsPerWorker + 17,
+			lbp:       1.25,
+			bins:      10,
+		},
+		"multiple chunks": {
+			partition: successorChunk + 3*minPartitionsPerWorker + 1,
+			lbp:       1.05,
+			bins:      7,
+		},
+		"tight load": {
+			partition: 4*minPartitionsPerWorker + 3,
+			lbp:       1,
+			bins:      3,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.Partition = tc.partition
+			cfg.LoadBalancingParameter = tc.lbp
+			cfg.Workers = 1
+			want, err := New(cfg, initialBins(tc.bins))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+
+			for _, workers := range []int{2, 3, 8} {
+				cfg.Workers = workers
+				c, err := New(cfg, initialBins(tc.bins))
+				if err != nil {
+					t.Fatalf("failed to create consistent: %v", err)
+				}
+				if diff := cmp.Diff(owners(c), owners(want)); diff != "" {
+					t.Fatalf("placement with %d workers mismatch (-got,+want):%s", workers, diff)
+				}
+			}
+		})
+	}
+}
+
+// reusingHasher reuses a hash.Hash64, so it's not safe for concurrent use.
+type reusingHasher struct {
+	h hash.Hash64
+}
+
+func (hs *reusingHasher) Sum64(data []byte) uint64 {
+	hs.h.Reset()
+	hs.h.Write(data)
+	return hs.h.Sum64()
+}
+
+func TestPlacement_DefaultWorkers(t *testing.T) {
+	cfg := newConfig()
+	cfg.Partition = 8*minPartitionsPerWorker + 1
+	want, err := New(cfg, initialBins(10))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	// the hasher which is not safe for concurrent use places the partitions in the same way by default.
+	cfg.Hasher = &reusingHasher{h: fnv.New64()}
+	c, err := New(cfg, initialBins(10))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	if diff := cmp.Diff(owners(c), owners(want)); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func benchmarkRebuild(b *testing.B, workers int) {
+	cfg := newConfig()
+	cfg.Partition = 1 << 20
+	cfg.ReplicationFactor = 20
+	cfg.LoadBalancingParameter = 1.25
+	cfg.Workers = workers
+
+	bins := initialBins(200)
+	c, err := New(cfg, bins)
+	if err != nil {
+		b.Fatalf("failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.Remove(bins[0]); err != nil {
+			b.Fatalf("failed: %v", err)
+		}
+		if err := c.Add(bins[0]); err != nil {
+			b.Fatalf("failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkPlacement_RebuildSequential(b *testing.B) {
+	benchmarkRebuild(b, 1)
+}
+
+func BenchmarkPlacement_RebuildParallel(b *testing.B) {
+	benchmarkRebuild(b, runtime.GOMAXPROCS(0))
+}
@@ -0,0 +1,202 @@
+package consistent
+
+import (
+	"math"
+	"math/big"
+	"sort"
+)
+
+const (
+	// maxPlanCandidates is the maximum number of the candidates tried for each parameter of the suggestions.
+	maxPlanCandidates = 64
+
+	// maxPlanReplicationFactor is the maximum replication factor suggested by the planner.
+	maxPlanReplicationFactor = 4096
+
+	// maxPlanPartitionGrowth is the maximum ratio of the suggested partitions to the planned ones.
+	maxPlanPartitionGrowth = 16
+)
+
+// PlanReport represents the result of the capacity planning of the ring.
+type PlanReport struct {
+	// Partitions is the number of partitions of the ring.
+	Partitions uint64
+
+	// Bins is the number of bins of the ring.
+	Bins int
+
+	// OK is true if the partitions can be distributed to the bins.
+	OK bool
+
+	// Err is the reason why the partitions can't be distributed. It's a ConfigError or a CapacityError.
+	Err error
+
+	// AverageLoad is the number of partitions per bin.
+	AverageLoad float64
+
+	// MaximumLoad is the maximum number of partitions a bin can own.
+	MaximumLoad float64
+
+	// HeaviestLoad is the number of partitions owned by the heaviest bin.
+	HeaviestLoad float64
+
+	// Imbalance is the ratio of the heaviest load to the average load.
+	Imbalance float64
+
+	// RemovableBins is the number of bins which can be removed one by one in ascending order of the name
+	// before the partitions can't be distributed. It's bisected on the assumption that the partitions which
+	// can't be distributed to some bins can't be distributed to fewer bins either.
+	RemovableBins int
+
+	cfg  Config
+	bins []Bin
+}
+
+// PlanSuggestion represents the parameters of the ring which meet the target imbalance.
+// Only one of the parameters differs from the planned config.
+type PlanSuggestion struct {
+	Partition              uint64
+	ReplicationFactor      int
+	LoadBalancingParameter float64
+
+	// Imbalance is the ratio of the heaviest load to the average load with the parameters.
+	Imbalance float64
+}
+
+// Plan reports whether the partitions can be distributed to the bins with the config before the ring is built.
+// The placement is run without the balls, so Plan costs a rebuild of the ring and O(log(bins)) more rebuilds
+// to find the removable bins.
+func Plan(cfg *Config, bins []Bin) PlanReport {
+	r := PlanReport{
+		Partitions: cfg.Partition,
+		Bins:       len(bins),
+		cfg:        *cfg,
+		bins:       append([]Bin(nil), bins...),
+	}
+	r.cfg.BallStore = NewNopBallStore()
+	r.cfg.Progress = nil
+	sort.Slice(r.bins, func(i, j int) bool {
+		return r.bins[i].Name < r.bins[j].Name
+	})
+
+	if len(bins) > 0 {
+		r.AverageLoad = float64(cfg.Partition) / float64(len(bins))
+		r.MaximumLoad = math.Ceil(r.AverageLoad * cfg.LoadBalancingParameter)
+	}
+
+	imbalance, err := dryRun(&r.cfg, r.bins)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.OK = true
+	if len(bins) == 0 {
+		return r
+	}
+
+	r.Imbalance = imbalance
+	r.HeaviestLoad = imbalance * r.AverageLoad
+
+	// the bounded-load capacity limits the removable bins without rebuilding the ring.
+	limit := 0
+	for limit < len(r.bins)-1 && hasCapacity(&r.cfg, len(r.bins)-limit-1) {
+		limit++
+	}
+	lo, hi := 0, limit
+	for lo < hi {
+		mid := lo + (hi-lo+1)/2
+		if _, err := dryRun(&r.cfg, r.bins[mid:]); err != nil {
+			hi = mid - 1
+		} else {
+			lo = mid
+		}
+	}
+	r.RemovableBins = lo
+	return r
+}
+
+// hasCapacity reports whether the maximum load of the bins is enough to own all partitions.
+func hasCapacity(cfg *Config, bins int) bool {
+	maxLoad := math.Ceil(float64(cfg.Partition) / float64(bins) * cfg.LoadBalancingParameter)
+	return maxLoad*float64(bins) >= float64(cfg.Partition)
+}
+
+// Suggest returns the parameters which keep the heaviest load within target times the average load.
+// Each suggestion changes one of Partition, ReplicationFactor and LoadBalancingParameter, and the suggested
+// partitions are prime. It returns nil if the planned config already meets the target or no parameter meets it.
+func (r PlanReport) Suggest(target float64) []PlanSuggestion {
+	if !r.OK || r.Bins == 0 || r.Imbalance <= target || target < 1 {
+		return nil
+	}
+
+	var res []PlanSuggestion
+	try := func(cfg Config) bool {
+		imbalance, err := dryRun(&cfg, r.bins)
+		if err != nil || imbalance > target {
+			return false
+		}
+		res = append(res, PlanSuggestion{
+			Partition:              cfg.Partition,
+			ReplicationFactor:      cfg.ReplicationFactor,
+			LoadBalancingParameter: cfg.LoadBalancingParameter,
+			Imbalance:              imbalance,
+		})
+		return true
+	}
+
+	// the maximum load is bounded by the load balancing parameter, so it's lowered to the target.
+	if load := math.Floor(r.AverageLoad * target); load*float64(r.Bins) >= float64(r.Partitions) {
+		cfg := r.cfg
+		cfg.LoadBalancingParameter = load / r.AverageLoad
+		try(cfg)
+	}
+
+	// more partitions reduce the rounding of the maximum load.
+	if r.cfg.LoadBalancingParameter <= target {
+		cfg := r.cfg
+		limit := MaxPartition
+		if r.Partitions < limit/maxPlanPartitionGrowth {
+			limit = r.Partitions * maxPlanPartitionGrowth
+		}
+		for i, p := 0, r.Partitions+1; i < maxPlanCandidates && p <= limit; p++ {
+			avg := float64(p) / float64(r.Bins)
+			if math.Ceil(avg*r.cfg.LoadBalancingParameter) > avg*target || !big.NewInt(0).SetUint64(p).ProbablyPrime(0) {
+				continue
+			}
+			i++
+			cfg.Partition = p
+			if try(cfg) {
+				break
+			}
+		}
+	}
+
+	// more virtual nodes spread the partitions evenly, so fewer bins reach the maximum load.
+	cfg := r.cfg
+	for rf := r.cfg.ReplicationFactor * 2; rf <= maxPlanReplicationFactor; rf *= 2 {
+		cfg.ReplicationFactor = rf
+		if try(cfg) {
+			break
+		}
+	}
+	return res
+}
+
+// dryRun distributes the partitions to the bins and returns the ratio of the heaviest load to the average load.
+func dryRun(cfg *Config, bins []Bin) (float64, error) {
+	c, err := New(cfg, bins)
+	if err != nil {
+		return 0, err
+	}
+	if len(bins) == 0 {
+		return 0, nil
+	}
+
+	var heaviest float64
+	for _, load := range c.LoadDistribution() {
+		if load > heaviest {
+			heaviest = load
+		}
+	}
+	return heaviest / (float64(cfg.Partition) / float64(len(bins))), nil
+}
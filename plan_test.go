@@ -0,0 +1,196 @@
+package consistent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestPlan(t *testing.T) {
+	type testcase struct {
+		partition         uint64
+		replicationFactor int
+		load              float64
+		bins              int
+		want              PlanReport
+		err               error
+	}
+
+	tcs := map[string]testcase{
+		"ok": {
+			partition:         23,
+			replicationFactor: 21,
+			load:              1.25,
+			bins:              4,
+			want: PlanReport{
+				Partitions:    23,
+				Bins:          4,
+				OK:            true,
+				AverageLoad:   5.75,
+				MaximumLoad:   8,
+				HeaviestLoad:  8,
+				Imbalance:     8 / 5.75,
+				RemovableBins: 3,
+			},
+		},
+		"no room to remove": {
+			partition:         23,
+			replicationFactor: 1,
+			load:              1.5,
+			bins:              3,
+			want: PlanReport{
+				Partitions:   23,
+				Bins:         3,
+				OK:           true,
+				AverageLoad:  23.0 / 3,
+				MaximumLoad:  12,
+				HeaviestLoad: 12,
+				Imbalance:    12 / (23.0 / 3),
+			},
+		},
+		"insufficient capacity": {
+			partition:         23,
+			replicationFactor: 1,
+			load:              1,
+			bins:              3,
+			want: PlanReport{
+				Partitions:  23,
+				Bins:        3,
+				AverageLoad: 23.0 / 3,
+				MaximumLoad: 8,
+			},
+			err: ErrInsufficientPartitionCapacity,
+		},
+		"invalid config": {
+			partition: 23,
+			load:      1.25,
+			bins:      3,
+			want: PlanReport{
+				Partitions:  23,
+				Bins:        3,
+				AverageLoad: 23.0 / 3,
+				MaximumLoad: 10,
+			},
+			err: ErrInvalidConfig,
+		},
+		"no bin": {
+			partition:         23,
+			replicationFactor: 21,
+			load:              1.25,
+			want: PlanReport{
+				Partitions: 23,
+				OK:         true,
+			},
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.Partition = tc.partition
+			cfg.ReplicationFactor = tc.replicationFactor
+			cfg.LoadBalancingParameter = tc.load
+
+			got := Plan(cfg, initialBins(tc.bins))
+			if !errors.Is(got.Err, tc.err) {
+				t.Fatalf("error unexpected: got:%v want:%v", got.Err, tc.err)
+			}
+			opts := []cmp.Option{
+				cmp.AllowUnexported(PlanReport{}),
+				cmpopts.IgnoreFields(PlanReport{}, "Err", "cfg", "bins"),
+				cmpopts.EquateApprox(0, 1e-9),
+			}
+			if diff := cmp.Diff(got, tc.want, opts...); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestPlan_RemovableBins(t *testing.T) {
+	type testcase struct {
+		partition         uint64
+		replicationFactor int
+		load              float64
+		bins              int
+	}
+
+	tcs := map[string]testcase{
+		"all removable": {
+			partition:         271,
+			replicationFactor: 20,
+			load:              1.25,
+			bins:              40,
+		},
+		"bounded by the replicas": {
+			partition:         101,
+			replicationFactor: 1,
+			load:              1.5,
+			bins:              12,
+		},
+		"all removable with tight load": {
+			partition:         997,
+			replicationFactor: 10,
+			load:              1.01,
+			bins:              30,
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.Partition = tc.partition
+			cfg.ReplicationFactor = tc.replicationFactor
+			cfg.LoadBalancingParameter = tc.load
+
+			got := Plan(cfg, initialBins(tc.bins))
+			want := 0
+			for want < len(got.bins)-1 {
+				if _, err := dryRun(&got.cfg, got.bins[want+1:]); err != nil {
+					break
+				}
+				want++
+			}
+			if diff := cmp.Diff(got.RemovableBins, want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestPlanReport_Suggest(t *testing.T) {
+	cfg := newConfig()
+	bins := initialBins(3)
+
+	r := Plan(cfg, bins)
+	if r.Imbalance <= 1.15 {
+		t.Fatalf("imbalance should exceed the target: got:%v", r.Imbalance)
+	}
+	if got := r.Suggest(r.Imbalance); got != nil {
+		t.Fatalf("no suggestion should be returned for the met target: got:%v", got)
+	}
+
+	suggestions := r.Suggest(1.15)
+	if len(suggestions) == 0 {
+		t.Fatal("suggestions should be returned")
+	}
+	for _, s := range suggestions {
+		cfg2 := newConfig()
+		cfg2.Partition = s.Partition
+		cfg2.ReplicationFactor = s.ReplicationFactor
+		cfg2.LoadBalancingParameter = s.LoadBalancingParameter
+
+		r2 := Plan(cfg2, bins)
+		if !r2.OK || r2.Imbalance > 1.15 || r2.Imbalance != s.Imbalance {
+			t.Fatalf("suggestion should meet the target: got:%+v report:%+v", s, r2)
+		}
+	}
+}
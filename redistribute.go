@@ -0,0 +1,456 @@
+package consistent
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+)
+
+// partitionKeys holds the hashes of the partition keys.
+// They depend only on the hasher and the number of partitions, so they are calculated once
+// and shared by the tables. It's never modified once it's calculated.
+type partitionKeys struct {
+	// hashes holds the hash of each partition indexed by the partition ID.
+	hashes []uint64
+
+	once sync.Once
+
+	// order holds the partition IDs sorted by their hashes. It's built on the first
+	// incremental redistribution.
+	order []PartitionID
+}
+
+// sorted returns the partition IDs sorted by their hashes.
+func (k *partitionKeys) sorted() []PartitionID {
+	k.once.Do(func() {
+		k.order = make([]PartitionID, len(k.hashes))
+		for i := range k.order {
+			k.order[i] = PartitionID(i)
+		}
+		sort.Slice(k.order, func(i, j int) bool {
+			hi, hj := k.hashes[k.order[i]], k.hashes[k.order[j]]
+			if hi != hj {
+				return hi < hj
+			}
+			return k.order[i] < k.order[j]
+		})
+	})
+	return k.order
+}
+
+// arc calls fn for each partition whose hash is in (from, to] clockwise.
+// The arc goes around the whole ring if from equals to.
+func (k *partitionKeys) arc(from, to uint64, fn func(PartitionID)) {
+	order := k.sorted()
+	after := func(h uint64) int {
+		return sort.Search(len(order), func(i int) bool {
+			return k.hashes[order[i]] > h
+		})
+	}
+
+	lo, hi := after(from), after(to)
+	if from < to {
+		for _, partID := range order[lo:hi] {
+			fn(partID)
+		}
+		return
+	}
+
+	// the arc wraps around the largest hash.
+	for _, partID := range order[lo:] {
+		fn(partID)
+	}
+	for _, partID := range order[:hi] {
+		fn(partID)
+	}
+}
+
+// rebalance distributes the partitions after the bins were added or removed.
+// The partitions whose owner can change are reassigned incrementally unless the partitions are pinned.
+// Otherwise all partitions are distributed again.
+// In the minimal movement mode, the previous owners are kept as long as they don't exceed the maximum load.
+func (t *table) rebalance(ctx context.Context, progress ProgressFunc) ([]PartitionID, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if t.minimizeMovement && len(t.partitions) > 0 {
+		return t.retain(ctx, progress)
+	}
+	if moved, ok := t.redistribute(); ok {
+		if progress != nil {
+			progress(t.partition, t.partition)
+		}
+		return moved, nil
+	}
+	return t.distributePartitions(ctx, progress)
+}
+
+// redistribute reassigns only the partitions whose owner can change: the partitions on the arcs whose
+// owner has changed, the partitions displaced by the load bound and the partitions displaced by them.
+// It reports false and leaves the table untouched if the partitions are pinned or the bins can't hold them.
+//
+// distributePartitions assigns the partitions in ascending order of the ID to the first bin clockwise from
+// their successor which is not full, so each bin keeps the partitions reaching it up to the maximum load and
+// the later ones move on to the next virtual node. A partition which is neither on a changed arc nor displaced
+// is owned by its successor, which hasn't changed, so only the bins reaching the maximum load are replayed.
+// Moving a partition on only makes the next bin full earlier, so the replay ends with the same owners as
+// distributePartitions.
+func (t *table) redistribute() ([]PartitionID, bool) {
+	if t.keys == nil || len(t.pins) > 0 || len(t.partitions) == 0 || len(t.sortedSet) < 2 {
+		return nil, false
+	}
+
+	// find the new successors of the partitions on the changed arcs and the displaced partitions.
+	r := &replay{
+		t:       t,
+		maxLoad: t.maximumLoad(),
+		succ:    make(map[PartitionID]int),
+		natural: make(map[string][]PartitionID),
+		loads:   make(map[string]int, len(t.bins)),
+		visits:  make(map[string][]visit),
+		full:    make(map[string]*keptVisits),
+	}
+	for _, h := range t.changed {
+		idx := sort.Search(len(t.sortedSet), func(i int) bool {
+			return t.sortedSet[i] >= h
+		})
+		prev := t.sortedSet[len(t.sortedSet)-1]
+		if idx > 0 {
+			prev = t.sortedSet[idx-1]
+		}
+
+		t.keys.arc(prev, h, func(partID PartitionID) {
+			if _, ok := r.succ[partID]; !ok {
+				r.succ[partID] = t.successor(t.keys.hashes[partID])
+			}
+		})
+	}
+	for _, partID := range t.displaced {
+		if _, ok := r.succ[partID]; !ok {
+			r.succ[partID] = t.successor(t.keys.hashes[partID])
+		}
+	}
+
+	// the other partitions of each bin are owned by their successor.
+	for name := range t.bins {
+		r.loads[name] = len(t.loads[name])
+	}
+	for partID, idx := range r.succ {
+		r.loads[t.partitions[partID].String()]--
+		name := t.ring[t.sortedSet[idx]].String()
+		r.loads[name]++
+		r.natural[name] = append(r.natural[name], partID)
+	}
+	for name := range t.bins {
+		if float64(r.loads[name]) > r.maxLoad {
+			r.fill(name)
+		}
+	}
+	for len(r.moving) > 0 {
+		v := r.moving[len(r.moving)-1]
+		r.moving = r.moving[:len(r.moving)-1]
+		if !r.reach(v) {
+			return nil, false
+		}
+	}
+
+	owners := make(map[PartitionID]*Bin, len(r.succ))
+	for partID, idx := range r.succ {
+		owners[partID] = t.ring[t.sortedSet[idx]]
+	}
+	var displaced []PartitionID
+	keep := func(name string, visits []visit) {
+		for _, v := range visits {
+			if v.idx < 0 {
+				// the partition is owned by its successor as before.
+				continue
+			}
+			owners[v.partID] = t.bins[name]
+			if v.count > 1 {
+				displaced = append(displaced, v.partID)
+			}
+		}
+	}
+	for name, visits := range r.visits {
+		keep(name, visits)
+	}
+	for name, kept := range r.full {
+		keep(name, *kept)
+	}
+	sort.Slice(displaced, func(i, j int) bool {
+		return displaced[i] < displaced[j]
+	})
+
+	loads := make(map[string]int, len(t.bins))
+	for name := range t.bins {
+		loads[name] = len(t.loads[name])
+	}
+	moved := make([]PartitionID, 0, len(owners))
+	partitions := make([]*Bin, len(t.partitions))
+	copy(partitions, t.partitions)
+	gained := make(map[string][]PartitionID)
+	lost := make(map[string]bool)
+	for partID, bin := range owners {
+		old := t.partitions[partID].String()
+		if old == bin.String() {
+			continue
+		}
+		partitions[partID] = bin
+		moved = append(moved, partID)
+		loads[old]--
+		loads[bin.String()]++
+		gained[bin.String()] = append(gained[bin.String()], partID)
+		lost[old] = true
+	}
+	sort.Slice(moved, func(i, j int) bool {
+		return moved[i] < moved[j]
+	})
+
+	res := make(map[string][]PartitionID, len(t.bins))
+	for name := range t.bins {
+		ids, ok := t.loads[name]
+		if !ok {
+			ids = []PartitionID{}
+		}
+		if !lost[name] && len(gained[name]) == 0 {
+			res[name] = ids
+			continue
+		}
+
+		// merge the kept and the gained partitions in ascending order. The slices of
+		// the previous table are shared, so the new ones are allocated.
+		add := gained[name]
+		sort.Slice(add, func(i, j int) bool {
+			return add[i] < add[j]
+		})
+		ids2 := make([]PartitionID, 0, loads[name])
+		for _, partID := range ids {
+			if partitions[partID].String() != name {
+				continue
+			}
+			for len(add) > 0 && add[0] < partID {
+				ids2 = append(ids2, add[0])
+				add = add[1:]
+			}
+			ids2 = append(ids2, partID)
+		}
+		res[name] = append(ids2, add...)
+	}
+
+	t.partitions = partitions
+	t.loads = res
+	t.changed = nil
+	t.displaced = displaced
+	t.updateOwners()
+	return moved, true
+}
+
+// visit represents a partition reaching a virtual node while the partitions are replayed.
+type visit struct {
+	partID PartitionID
+
+	// idx is the index of the virtual node. It's negative until the partition owned by its successor
+	// before the change moves on, so the successor is found only then.
+	idx int
+
+	// count is the number of the virtual nodes the partition has reached so far.
+	count int
+}
+
+// keptVisits is a max-heap of the visits kept by a full bin ordered by the partition ID.
+type keptVisits []visit
+
+func (h keptVisits) Len() int            { return len(h) }
+func (h keptVisits) Less(i, j int) bool  { return h[i].partID > h[j].partID }
+func (h keptVisits) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *keptVisits) Push(x interface{}) { *h = append(*h, x.(visit)) }
+func (h *keptVisits) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+// replay holds the state of the bins replayed by redistribute.
+type replay struct {
+	t       *table
+	maxLoad float64
+
+	// succ holds the index of the successor of the partitions on the changed arcs and the displaced partitions.
+	succ map[PartitionID]int
+
+	// natural holds the partitions in succ by the name of the bin of their successor.
+	natural map[string][]PartitionID
+
+	// loads holds the number of the partitions reaching each bin which is not full.
+	loads map[string]int
+
+	// visits holds the partitions which have moved on to each bin which is not full.
+	visits map[string][]visit
+
+	// full holds the partitions kept by each bin which has reached the maximum load.
+	full map[string]*keptVisits
+
+	// moving holds the partitions moving on to the next virtual node.
+	moving []visit
+}
+
+// fill makes the bin full. The bin keeps the partitions reaching it with the smallest IDs up to the maximum load
+// as distributePartitions does, and the rest move on.
+func (r *replay) fill(name string) {
+	extra := r.visits[name]
+	delete(r.visits, name)
+	for _, partID := range r.natural[name] {
+		extra = append(extra, visit{partID: partID, idx: r.succ[partID], count: 1})
+	}
+	sort.Slice(extra, func(i, j int) bool {
+		return extra[i].partID < extra[j].partID
+	})
+
+	// merge the partitions kept from the previous table, which are sorted already.
+	ids := r.t.loads[name]
+	visits := make([]visit, 0, len(ids)+len(extra))
+	for _, partID := range ids {
+		if _, ok := r.succ[partID]; ok {
+			continue
+		}
+		for len(extra) > 0 && extra[0].partID < partID {
+			visits = append(visits, extra[0])
+			extra = extra[1:]
+		}
+		visits = append(visits, visit{partID: partID, idx: -1, count: 1})
+	}
+	visits = append(visits, extra...)
+
+	n := int(r.maxLoad)
+	for _, v := range visits[n:] {
+		r.moveOn(v)
+	}
+	// the visits in descending order of the ID are a max-heap.
+	kept := keptVisits(visits[:n])
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	r.full[name] = &kept
+}
+
+// reach brings the partition to the bin of its virtual node.
+// It reports false if the partition has reached every virtual node, so distributePartitions fails.
+func (r *replay) reach(v visit) bool {
+	if v.count >= len(r.t.sortedSet) {
+		return false
+	}
+
+	name := r.t.ring[r.t.sortedSet[v.idx]].String()
+	if kept, ok := r.full[name]; ok {
+		// the bin keeps the partition instead of the one with the largest ID if it's larger.
+		if (*kept)[0].partID > v.partID {
+			v, (*kept)[0] = (*kept)[0], v
+			heap.Fix(kept, 0)
+		}
+		r.moveOn(v)
+		return true
+	}
+
+	r.visits[name] = append(r.visits[name], v)
+	r.loads[name]++
+	if float64(r.loads[name]) > r.maxLoad {
+		r.fill(name)
+	}
+	return true
+}
+
+// moveOn moves the partition on to the next virtual node.
+func (r *replay) moveOn(v visit) {
+	if v.idx < 0 {
+		v.idx = r.t.successor(r.t.keys.hashes[v.partID])
+	}
+	v.idx++
+	if v.idx >= len(r.t.sortedSet) {
+		v.idx = 0
+	}
+	v.count++
+	r.moving = append(r.moving, v)
+}
+
+// retain distributes the partitions keeping the previous owners as long as they don't exceed the maximum load,
+// so only the partitions of the removed bins and the partitions exceeding the maximum load move.
+// The previous owners keep the partitions owned by their successor on the ring first, and then the others in
+// ascending order of the ID. The rest are assigned to the first bin clockwise which doesn't exceed the maximum load.
+func (t *table) retain(ctx context.Context, progress ProgressFunc) ([]PartitionID, error) {
+	if t.keys == nil {
+		keys, err := t.hashPartitions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		t.keys = keys
+	}
+
+	d, index := t.newDistribution()
+	succ := make([]int, t.partition)
+	t.successors(t.keys.hashes, succ)
+
+	prev := make([]int, len(t.partitions))
+	for partID, bin := range t.partitions {
+		prev[partID] = -1
+		if i, ok := index[bin.String()]; ok {
+			prev[partID] = i
+		}
+	}
+
+	keep := func(natural bool) error {
+		for partID, owner := range prev {
+			if partID%progressInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			if owner < 0 || d.partitions[partID] != nil || (d.owners[succ[partID]] == owner) != natural {
+				continue
+			}
+			if float64(len(d.loads[owner]))+1 <= d.maxLoad {
+				d.partitions[partID] = d.bins[owner]
+				d.loads[owner] = append(d.loads[owner], PartitionID(partID))
+			}
+		}
+		return nil
+	}
+	if err := keep(true); err != nil {
+		return nil, err
+	}
+	if err := keep(false); err != nil {
+		return nil, err
+	}
+
+	for partID, idx := range succ {
+		if partID%progressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if d.partitions[partID] != nil {
+			continue
+		}
+		if err := d.distributeWithLoad(PartitionID(partID), idx); err != nil {
+			return nil, err
+		}
+	}
+	if progress != nil {
+		progress(t.partition, t.partition)
+	}
+
+	d.displaced = nil
+	for i, ids := range d.loads {
+		sort.Slice(ids, func(i, j int) bool {
+			return ids[i] < ids[j]
+		})
+		for _, partID := range ids {
+			if d.owners[succ[partID]] != i {
+				d.displaced = append(d.displaced, partID)
+			}
+		}
+	}
+	return t.apply(d), nil
+}
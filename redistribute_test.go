@@ -0,0 +1,157 @@
+package consistent
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// mixedHasher scatters the fnv hashes of the similar keys across the ring.
+type mixedHasher struct{}
+
+func (hs mixedHasher) Sum64(data []byte) uint64 {
+	h := hasher{}.Sum64(data)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// partitionTable returns the owners and the loads of the table.
+func partitionTable(t *table) ([]string, map[string][]PartitionID) {
+	owners := make([]string, len(t.partitions))
+	for partID, bin := range t.partitions {
+		owners[partID] = bin.String()
+	}
+	loads := make(map[string][]PartitionID, len(t.bins))
+	for name, bin := range t.bins {
+		loads[name] = bin.PartitionIDs
+	}
+	return owners, loads
+}
+
+func TestTable_Redistribute(t *testing.T) {
+	type testcase struct {
+		hasher    Hasher
+		lbp       float64
+		displaced bool
+	}
+
+	tcs := map[string]testcase{
+		"loose load": {
+			hasher:    hasher{},
+			lbp:       3,
+			displaced: true,
+		},
+		"tight load": {
+			hasher:    hasher{},
+			lbp:       1.05,
+			displaced: true,
+		},
+		"mixed hashes": {
+			hasher:    mixedHasher{},
+			lbp:       1.25,
+			displaced: true,
+		},
+		"colliding hashes": {
+			hasher: collidingHasher{},
+			lbp:    100,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := newConfig()
+			cfg.Hasher = tc.hasher
+			cfg.Partition = 1009
+			cfg.ReplicationFactor = 10
+			cfg.LoadBalancingParameter = tc.lbp
+
+			c, err := New(cfg, initialBins(5))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+
+			r := rand.New(rand.NewSource(1))
+			var displaced int
+			for i := 0; i < 30; i++ {
+				next := c.table.clone()
+				bins := c.GetBins()
+				sort.Slice(bins, func(i, j int) bool {
+					return bins[i].Name < bins[j].Name
+				})
+				if len(bins) > 2 && r.Intn(2) == 0 {
+					next.remove(bins[r.Intn(len(bins))])
+				} else {
+					next.add(NewBin(fmt.Sprintf("%s%d", binPrefix, 100+i)))
+				}
+
+				full := next.clone()
+				wantMoved, err := full.distributePartitions(context.Background(), nil)
+				if err != nil {
+					t.Fatalf("failed to distribute: %v", err)
+				}
+
+				displaced += len(next.displaced)
+				moved, ok := next.redistribute()
+				if !ok {
+					t.Fatalf("failed to redistribute incrementally")
+				}
+
+				gotOwners, gotLoads := partitionTable(next)
+				wantOwners, wantLoads := partitionTable(full)
+				if diff := cmp.Diff(gotOwners, wantOwners); diff != "" {
+					t.Fatalf("owners mismatch (-got,+want):%s", diff)
+				}
+				if diff := cmp.Diff(gotLoads, wantLoads); diff != "" {
+					t.Fatalf("loads mismatch (-got,+want):%s", diff)
+				}
+				if diff := cmp.Diff(moved, wantMoved); diff != "" {
+					t.Fatalf("moved mismatch (-got,+want):%s", diff)
+				}
+				if diff := cmp.Diff(next.displaced, full.displaced); diff != "" {
+					t.Fatalf("displaced mismatch (-got,+want):%s", diff)
+				}
+
+				c.table = next
+			}
+
+			if got := displaced > 0; got != tc.displaced {
+				t.Fatalf("displaced partitions mismatch, got:%d", displaced)
+			}
+		})
+	}
+}
+
+func BenchmarkTable_Rebalance(b *testing.B) {
+	cfg := newConfig()
+	cfg.Partition = 1 << 20
+	cfg.ReplicationFactor = 100
+	cfg.LoadBalancingParameter = 1.5
+	cfg.Hasher = mixedHasher{}
+
+	bins := initialBins(200)
+	c, err := New(cfg, bins)
+	if err != nil {
+		b.Fatalf("failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := c.Remove(bins[0]); err != nil {
+			b.Fatalf("failed: %v", err)
+		}
+		if err := c.Add(bins[0]); err != nil {
+			b.Fatalf("failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package consistent
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// RingSet manages the named rings sharing the same bins.
+// Each ring has its own config, so the tenants can have their own partition count and load balancing
+// parameter on the same bins. The membership changes are applied to all rings atomically, so the readers
+// never observe a bin which exists in a ring but not in another.
+// The membership of the rings in the set can't be changed by the rings themselves.
+type RingSet struct {
+	mu sync.RWMutex
+
+	// wmu serializes the membership changes and the changes of the rings.
+	wmu sync.Mutex
+
+	// bins is the shared registry of the bins.
+	bins map[string]Bin
+
+	// rings is a mapping the name to the ring.
+	rings map[string]*Consistent
+}
+
+// NewRingSet generates a new RingSet which has the bins and no ring.
+func NewRingSet(bins []Bin) *RingSet {
+	s := &RingSet{
+		bins:  make(map[string]Bin, len(bins)),
+		rings: make(map[string]*Consistent),
+	}
+	for _, bin := range bins {
+		s.bins[bin.String()] = bin.clone()
+	}
+	return s
+}
+
+// AddRing generates a new ring which has the bins of the set by passed config.
+func (s *RingSet) AddRing(name string, cfg *Config) (*Consistent, error) {
+	return s.AddRingContext(context.Background(), name, cfg)
+}
+
+// AddRingContext generates a new ring which has the bins of the set by passed config.
+// It returns the error of the context if the context is done before the partitions are distributed.
+func (s *RingSet) AddRingContext(ctx context.Context, name string, cfg *Config) (*Consistent, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if _, ok := s.rings[name]; ok {
+		return nil, ErrRingAlreadyExist
+	}
+
+	c, err := NewContext(ctx, cfg, s.listBins())
+	if err != nil {
+		return nil, err
+	}
+	c.managed = true
+
+	s.mu.Lock()
+	s.rings[name] = c
+	s.mu.Unlock()
+	return c, nil
+}
+
+// RemoveRing removes the ring from the set.
+// The removed ring keeps the bins and its membership can be changed by itself again.
+func (s *RingSet) RemoveRing(name string) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	c, ok := s.rings[name]
+	if !ok {
+		return ErrRingNotFound
+	}
+
+	s.mu.Lock()
+	delete(s.rings, name)
+	s.mu.Unlock()
+
+	c.wmu.Lock()
+	c.managed = false
+	c.wmu.Unlock()
+	return nil
+}
+
+// Ring returns the ring of the name.
+func (s *RingSet) Ring(name string) (*Consistent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.rings[name]
+	if !ok {
+		return nil, ErrRingNotFound
+	}
+	return c, nil
+}
+
+// Rings returns the names of the rings in ascending order.
+func (s *RingSet) Rings() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.names()
+}
+
+// GetBins returns the bins of the set.
+func (s *RingSet) GetBins() []Bin {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.listBins()
+}
+
+// Add adds a new bin to all rings.
+func (s *RingSet) Add(bin Bin) error {
+	return s.AddContext(context.Background(), bin)
+}
+
+// AddContext adds a new bin to all rings.
+// The rings are rebuilt without blocking the readers and replaced at once. If any ring fails to be rebuilt,
+// no ring is changed and the error is returned.
+func (s *RingSet) AddContext(ctx context.Context, bin Bin) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if _, ok := s.bins[bin.String()]; ok {
+		return &BinError{Name: bin.String(), Err: ErrBinAlreadyExist}
+	}
+	return s.change(func(c *Consistent) (*change, error) {
+		return c.prepareAdd(ctx, bin)
+	}, func() {
+		s.bins[bin.String()] = bin.clone()
+	})
+}
+
+// Remove removes a bin from all rings.
+func (s *RingSet) Remove(bin Bin) error {
+	return s.RemoveContext(context.Background(), bin)
+}
+
+// RemoveContext removes a bin from all rings.
+// The rings are rebuilt without blocking the readers and replaced at once. If any ring fails to be rebuilt,
+// no ring is changed and the error is returned.
+func (s *RingSet) RemoveContext(ctx context.Context, bin Bin) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	if _, ok := s.bins[bin.String()]; !ok {
+		// skip if the bin does not exist
+		return nil
+	}
+	return s.change(func(c *Consistent) (*change, error) {
+		return c.prepareRemove(ctx, bin)
+	}, func() {
+		delete(s.bins, bin.String())
+	})
+}
+
+// change prepares the change of every ring by prepare and replaces the tables of all rings at once.
+// update updates the registry while the rings are replaced. The caller must hold wmu.
+func (s *RingSet) change(prepare func(c *Consistent) (*change, error), update func()) error {
+	names := s.names()
+	rings := make([]*Consistent, len(names))
+	for i, name := range names {
+		rings[i] = s.rings[name]
+	}
+
+	// the rings are locked in ascending order of the name, so the changes of the set never dead lock.
+	for _, c := range rings {
+		c.wmu.Lock()
+	}
+	defer func() {
+		for _, c := range rings {
+			c.wmu.Unlock()
+		}
+	}()
+
+	changes := make([]*change, len(rings))
+	for i, c := range rings {
+		ch, err := prepare(c)
+		if err != nil {
+			return err
+		}
+		changes[i] = ch
+	}
+
+	s.mu.Lock()
+	for _, c := range rings {
+		c.mu.Lock()
+	}
+	for i, c := range rings {
+		if changes[i] == nil {
+			continue
+		}
+		c.swap(changes[i])
+	}
+	update()
+	for _, c := range rings {
+		c.mu.Unlock()
+	}
+	s.mu.Unlock()
+
+	for i, c := range rings {
+		if changes[i] != nil {
+			c.emitChange(changes[i])
+		}
+	}
+	return nil
+}
+
+// LoadDistribution returns the number of the partitions of each bin by the name of the ring.
+func (s *RingSet) LoadDistribution() map[string]map[string]float64 {
+	res := make(map[string]map[string]float64)
+	s.loads(func(name string, t *table) {
+		loads := make(map[string]float64, len(t.loads))
+		for bin, partitions := range t.loads {
+			loads[bin] = float64(len(partitions))
+		}
+		res[name] = loads
+	})
+	return res
+}
+
+// AggregateLoadDistribution returns the total number of the partitions of each bin across the rings.
+func (s *RingSet) AggregateLoadDistribution() map[string]float64 {
+	res := make(map[string]float64)
+	s.loads(func(_ string, t *table) {
+		for bin, partitions := range t.loads {
+			res[bin] += float64(len(partitions))
+		}
+	})
+	return res
+}
+
+// loads calls fn with the table of each ring. The tables are taken at once, so they have the same bins.
+func (s *RingSet) loads(fn func(name string, t *table)) {
+	s.mu.RLock()
+	tables := make(map[string]*table, len(s.rings))
+	for name, c := range s.rings {
+		c.mu.RLock()
+		tables[name] = c.table
+		c.mu.RUnlock()
+	}
+	s.mu.RUnlock()
+
+	// the tables are immutable, so they are read without the locks.
+	for name, t := range tables {
+		fn(name, t)
+	}
+}
+
+// names returns the names of the rings in ascending order. The caller must hold mu or wmu.
+func (s *RingSet) names() []string {
+	names := make([]string, 0, len(s.rings))
+	for name := range s.rings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listBins returns the bins in ascending order of the name. The caller must hold mu or wmu.
+func (s *RingSet) listBins() []Bin {
+	bins := make([]Bin, 0, len(s.bins))
+	for _, bin := range s.bins {
+		bins = append(bins, bin.clone())
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].String() < bins[j].String()
+	})
+	return bins
+}
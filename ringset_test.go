@@ -0,0 +1,142 @@
+package consistent
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// binNames returns the names of the bins in ascending order.
+func binNames(bins []Bin) []string {
+	names := make([]string, len(bins))
+	for i, bin := range bins {
+		names[i] = bin.String()
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newRingSet generates a ring set which has the rings of the config by the name.
+func newRingSet(t *testing.T, bins []Bin, cfgs map[string]*Config) *RingSet {
+	t.Helper()
+
+	s := NewRingSet(bins)
+	for name, cfg := range cfgs {
+		if _, err := s.AddRing(name, cfg); err != nil {
+			t.Fatalf("failed to add ring: %v", err)
+		}
+	}
+	return s
+}
+
+func TestRingSet(t *testing.T) {
+	small := newConfig()
+	large := newConfig()
+	large.Partition = 271
+	large.LoadBalancingParameter = 1.25
+
+	s := newRingSet(t, initialBins(3), map[string]*Config{"small": small, "large": large})
+	if diff := cmp.Diff(s.Rings(), []string{"large", "small"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	if err := s.Add(NewBin("extra")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if err := s.Remove(initialBins(1)[0]); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+
+	want := []string{"extra", "node1", "node2"}
+	if diff := cmp.Diff(binNames(s.GetBins()), want); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	aggregate := make(map[string]float64)
+	for name, loads := range s.LoadDistribution() {
+		c, err := s.Ring(name)
+		if err != nil {
+			t.Fatalf("failed to get ring: %v", err)
+		}
+		if diff := cmp.Diff(binNames(c.GetBins()), want); diff != "" {
+			t.Fatalf("mismatch (-got,+want):%s", diff)
+		}
+		if diff := cmp.Diff(loads, c.LoadDistribution()); diff != "" {
+			t.Fatalf("mismatch (-got,+want):%s", diff)
+		}
+
+		var total float64
+		for bin, load := range loads {
+			total += load
+			aggregate[bin] += load
+		}
+		if total != float64(c.partition) {
+			t.Fatalf("unexpected total load: got:%v want:%v", total, c.partition)
+		}
+	}
+	if diff := cmp.Diff(s.AggregateLoadDistribution(), aggregate); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestRingSet_Atomic(t *testing.T) {
+	// the fragile ring can't distribute the partitions to two bins.
+	fragile := newConfig()
+	fragile.ReplicationFactor = 1
+	fragile.LoadBalancingParameter = 1.5
+
+	bins := initialBins(3)
+	s := newRingSet(t, bins, map[string]*Config{"a": newConfig(), "fragile": fragile, "z": newConfig()})
+	prev := s.LoadDistribution()
+
+	if err := s.Remove(bins[0]); !errors.Is(err, ErrInsufficientPartitionCapacity) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrInsufficientPartitionCapacity)
+	}
+	if diff := cmp.Diff(binNames(s.GetBins()), binNames(bins)); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	if diff := cmp.Diff(s.LoadDistribution(), prev); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestRingSet_Managed(t *testing.T) {
+	s := newRingSet(t, initialBins(3), map[string]*Config{"tenant": newConfig()})
+	c, err := s.Ring("tenant")
+	if err != nil {
+		t.Fatalf("failed to get ring: %v", err)
+	}
+
+	if err := c.Add(NewBin("extra")); !errors.Is(err, ErrManagedRing) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrManagedRing)
+	}
+	if err := c.Remove(initialBins(1)[0]); !errors.Is(err, ErrManagedRing) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrManagedRing)
+	}
+	if _, err := s.AddRing("tenant", newConfig()); !errors.Is(err, ErrRingAlreadyExist) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrRingAlreadyExist)
+	}
+
+	if err := s.RemoveRing("tenant"); err != nil {
+		t.Fatalf("failed to remove ring: %v", err)
+	}
+	if _, err := s.Ring("tenant"); !errors.Is(err, ErrRingNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrRingNotFound)
+	}
+	if err := s.RemoveRing("tenant"); !errors.Is(err, ErrRingNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrRingNotFound)
+	}
+
+	// the removed ring is not changed by the set anymore.
+	if err := s.Add(NewBin("extra")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if err := c.Add(NewBin("other")); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if diff := cmp.Diff(binNames(c.GetBins()), []string{"node0", "node1", "node2", "other"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
@@ -0,0 +1,256 @@
+package consistent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// operator represents the operator of a selector requirement.
+type operator int
+
+const (
+	opEquals operator = iota
+	opNotEquals
+	opIn
+	opNotIn
+	opExists
+	opNotExists
+)
+
+// requirement represents a condition of a label.
+type requirement struct {
+	key    string
+	op     operator
+	values []string
+}
+
+// matches reports whether the labels satisfy the requirement.
+func (r requirement) matches(labels map[string]string) bool {
+	v, ok := labels[r.key]
+	switch r.op {
+	case opEquals:
+		return ok && v == r.values[0]
+	case opNotEquals:
+		return !ok || v != r.values[0]
+	case opIn:
+		return ok && contains(r.values, v)
+	case opNotIn:
+		return !ok || !contains(r.values, v)
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	default:
+		return false
+	}
+}
+
+// String returns the requirement in the selector syntax.
+func (r requirement) String() string {
+	switch r.op {
+	case opEquals:
+		return r.key + "=" + r.values[0]
+	case opNotEquals:
+		return r.key + "!=" + r.values[0]
+	case opIn:
+		return r.key + " in (" + strings.Join(r.values, ",") + ")"
+	case opNotIn:
+		return r.key + " notin (" + strings.Join(r.values, ",") + ")"
+	case opNotExists:
+		return "!" + r.key
+	default:
+		return r.key
+	}
+}
+
+// Selector matches the bins by their labels.
+// The zero value matches every bin.
+type Selector struct {
+	requirements []requirement
+}
+
+// ParseSelector parses the comma separated requirements of the labels.
+// Supported requirements are "key=value", "key==value", "key!=value", "key in (v1,v2)",
+// "key notin (v1,v2)", "key" (the label exists) and "!key" (the label doesn't exist).
+// All requirements must be satisfied to match, e.g. "zone=us-east-1a,version!=2".
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		r, err := parseRequirement(term)
+		if err != nil {
+			return Selector{}, err
+		}
+		sel.requirements = append(sel.requirements, r)
+	}
+	return sel, nil
+}
+
+// MustParseSelector is like ParseSelector but panics if the selector can't be parsed.
+func MustParseSelector(s string) Selector {
+	sel, err := ParseSelector(s)
+	if err != nil {
+		panic(err)
+	}
+	return sel
+}
+
+// SelectorFromLabels generates a selector which matches the bins having all passed labels.
+func SelectorFromLabels(labels map[string]string) Selector {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sel Selector
+	for _, k := range keys {
+		sel.requirements = append(sel.requirements, requirement{key: k, op: opEquals, values: []string{labels[k]}})
+	}
+	return sel
+}
+
+// Matches reports whether the labels satisfy all requirements of the selector.
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s.requirements {
+		if !r.matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the selector in the syntax accepted by ParseSelector.
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s.requirements))
+	for _, r := range s.requirements {
+		terms = append(terms, r.String())
+	}
+	return strings.Join(terms, ",")
+}
+
+// SelectBins returns a thread-safe copy of the bins matching the selector, sorted by name.
+func (c *Consistent) SelectBins(sel Selector) []Bin {
+	return c.Snapshot().SelectBins(sel)
+}
+
+// SelectBins returns a thread-safe copy of the bins matching the selector in the snapshot, sorted by name.
+func (s *Snapshot) SelectBins(sel Selector) []Bin {
+	bins := []Bin{}
+	for _, bin := range s.t.bins {
+		if sel.Matches(bin.Labels) {
+			bins = append(bins, bin.clone())
+		}
+	}
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].Name < bins[j].Name
+	})
+	return bins
+}
+
+// splitTerms splits the selector by the commas outside of the parentheses.
+func splitTerms(s string) []string {
+	var terms []string
+	var depth, start int
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+// parseRequirement parses a requirement of the selector.
+func parseRequirement(term string) (requirement, error) {
+	if strings.HasPrefix(term, "!") && !strings.Contains(term, "=") {
+		key := strings.TrimSpace(term[1:])
+		if err := validateKey(key, term); err != nil {
+			return requirement{}, err
+		}
+		return requirement{key: key, op: opNotExists}, nil
+	}
+
+	for _, set := range []struct {
+		keyword string
+		op      operator
+	}{
+		{keyword: " notin ", op: opNotIn},
+		{keyword: " in ", op: opIn},
+	} {
+		i := strings.Index(term, set.keyword)
+		if i < 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(term[:i])
+		if err := validateKey(key, term); err != nil {
+			return requirement{}, err
+		}
+		list := strings.TrimSpace(term[i+len(set.keyword):])
+		if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+			return requirement{}, fmt.Errorf("%w: values must be enclosed in parentheses: %q", ErrInvalidSelector, term)
+		}
+		var values []string
+		for _, v := range strings.Split(list[1:len(list)-1], ",") {
+			values = append(values, strings.TrimSpace(v))
+		}
+		return requirement{key: key, op: set.op, values: values}, nil
+	}
+
+	for _, eq := range []struct {
+		token string
+		op    operator
+	}{
+		{token: "!=", op: opNotEquals},
+		{token: "==", op: opEquals},
+		{token: "=", op: opEquals},
+	} {
+		i := strings.Index(term, eq.token)
+		if i < 0 {
+			continue
+		}
+
+		key := strings.TrimSpace(term[:i])
+		if err := validateKey(key, term); err != nil {
+			return requirement{}, err
+		}
+		value := strings.TrimSpace(term[i+len(eq.token):])
+		return requirement{key: key, op: eq.op, values: []string{value}}, nil
+	}
+
+	if err := validateKey(term, term); err != nil {
+		return requirement{}, err
+	}
+	return requirement{key: term, op: opExists}, nil
+}
+
+// validateKey validates the label key of the requirement.
+func validateKey(key, term string) error {
+	if key == "" || strings.ContainsAny(key, " \t!=(),") {
+		return fmt.Errorf("%w: invalid label key: %q", ErrInvalidSelector, term)
+	}
+	return nil
+}
+
+// contains reports whether the values contain v.
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package consistent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestParseSelector(t *testing.T) {
+	type testcase struct {
+		selector string
+		labels   map[string]string
+		matches  bool
+		want     error
+	}
+
+	labels := map[string]string{
+		"zone":    "us-east-1a",
+		"version": "2",
+	}
+
+	tcs := map[string]testcase{
+		"empty selector matches everything": {
+			selector: "",
+			labels:   labels,
+			matches:  true,
+		},
+		"equals": {
+			selector: "zone=us-east-1a",
+			labels:   labels,
+			matches:  true,
+		},
+		"double equals": {
+			selector: "zone==us-east-1b",
+			labels:   labels,
+			matches:  false,
+		},
+		"not equals": {
+			selector: "zone=us-east-1a,version!=2",
+			labels:   labels,
+			matches:  false,
+		},
+		"not equals on missing label": {
+			selector: "tier!=gold",
+			labels:   labels,
+			matches:  true,
+		},
+		"in": {
+			selector: "zone in (us-east-1a, us-east-1b),version",
+			labels:   labels,
+			matches:  true,
+		},
+		"notin": {
+			selector: "version notin (1,2)",
+			labels:   labels,
+			matches:  false,
+		},
+		"not exists": {
+			selector: "!tier",
+			labels:   labels,
+			matches:  true,
+		},
+		"nil labels": {
+			selector: "zone",
+			matches:  false,
+		},
+		"invalid key": {
+			selector: "=value",
+			want:     ErrInvalidSelector,
+		},
+		"invalid values": {
+			selector: "zone in us-east-1a",
+			want:     ErrInvalidSelector,
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			sel, err := ParseSelector(tc.selector)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := sel.Matches(tc.labels); got != tc.matches {
+				t.Fatalf("mismatch, got:%t, want:%t", got, tc.matches)
+			}
+
+			// the string representation should be parsed to the same selector.
+			reparsed, err := ParseSelector(sel.String())
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", sel.String(), err)
+			}
+			if got := reparsed.Matches(tc.labels); got != tc.matches {
+				t.Fatalf("reparsed mismatch, got:%t, want:%t", got, tc.matches)
+			}
+		})
+	}
+}
+
+func TestConsistent_SelectBins(t *testing.T) {
+	bins := []Bin{
+		NewBinWithLabels("node0", map[string]string{"zone": "us-east-1a", "addr": "10.0.0.1:80"}),
+		NewBinWithLabels("node1", map[string]string{"zone": "us-east-1b", "addr": "10.0.0.2:80"}),
+		NewBinWithLabels("node2", map[string]string{"zone": "us-east-1a", "addr": "10.0.0.3:80"}),
+		NewBin("node3"),
+	}
+
+	c, err := New(newConfig(), bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	opt := cmpopts.IgnoreFields(Bin{}, "PartitionIDs")
+	got := c.SelectBins(MustParseSelector("zone=us-east-1a"))
+	if diff := cmp.Diff(got, []Bin{bins[0], bins[2]}, opt); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	got = c.SelectBins(SelectorFromLabels(map[string]string{"zone": "us-east-1b"}))
+	if diff := cmp.Diff(got, []Bin{bins[1]}, opt); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	if got := c.SelectBins(MustParseSelector("!zone")); len(got) != 1 || got[0].Name != "node3" {
+		t.Fatalf("mismatch, got:%v", got)
+	}
+}
@@ -0,0 +1,345 @@
+package consistent
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Snapshot is an immutable view of the ring at a point in time.
+// It never blocks the mutations of the ring and keeps returning the same result after the ring has changed.
+type Snapshot struct {
+	t *table
+}
+
+// Snapshot returns the view of the current state of the ring.
+func (c *Consistent) Snapshot() *Snapshot {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return &Snapshot{t: c.table}
+}
+
+// GetBins returns a thread-safe copy of bins in the snapshot.
+func (s *Snapshot) GetBins() []Bin {
+	bins := make([]Bin, 0, len(s.t.bins))
+	for _, bin := range s.t.bins {
+		bins = append(bins, bin.clone())
+	}
+	return bins
+}
+
+// GetPartitionOwner returns the owner of the given partition in the snapshot.
+// The bin serving the partition instead is returned if the owner is ejected.
+func (s *Snapshot) GetPartitionOwner(partID PartitionID) *Bin {
+	return s.t.owner(partID)
+}
+
+// Lookup finds a home for given key in the snapshot.
+func (s *Snapshot) Lookup(key []byte) (*Bin, PartitionID) {
+	return s.t.locate(key)
+}
+
+// Version returns the version of the ring in the snapshot.
+func (s *Snapshot) Version() uint64 {
+	return s.t.version
+}
+
+// PartitionsOf calls fn for each partition owned by the bin in ascending order until fn returns false.
+func (s *Snapshot) PartitionsOf(name string, fn func(partID PartitionID) bool) error {
+	partitionIDs, ok := s.t.loads[name]
+	if !ok {
+		return &BinError{Name: name, Err: ErrBinNotFound}
+	}
+
+	for _, partID := range partitionIDs {
+		if !fn(partID) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// RingPoints calls fn for each virtual node on the ring in ascending order of the hash until fn returns false.
+func (s *Snapshot) RingPoints(fn func(hash uint64, bin Bin) bool) {
+	for _, h := range s.t.sortedSet {
+		if !fn(h, s.t.ring[h].clone()) {
+			return
+		}
+	}
+}
+
+// PartitionPoints calls fn for each partition on the ring in ascending order of the hash until fn returns false.
+// The partitions whose hashes are equal are called in ascending order of the ID.
+func (s *Snapshot) PartitionPoints(fn func(hash uint64, partID PartitionID) bool) {
+	keys := s.t.keys
+	if keys == nil {
+		// the partitions of an empty ring are never hashed. The keys are not kept because the snapshot is immutable.
+		keys = &partitionKeys{hashes: make([]uint64, s.t.partition)}
+		bs := make([]byte, 8)
+		for i := range keys.hashes {
+			keys.hashes[i] = s.t.hasher.Sum64(s.t.partitionKey(bs, uint64(i)))
+		}
+	}
+
+	for _, partID := range keys.sorted() {
+		if !fn(keys.hashes[partID], partID) {
+			return
+		}
+	}
+}
+
+// LoadDistribution returns the number of the partitions of each bin in the snapshot.
+func (s *Snapshot) LoadDistribution() map[string]float64 {
+	res := make(map[string]float64, len(s.t.loads))
+	for bin, partitions := range s.t.loads {
+		res[bin] = float64(len(partitions))
+	}
+	return res
+}
+
+// MaximumLoad returns the maximum number of the partitions of a bin in the snapshot.
+func (s *Snapshot) MaximumLoad() float64 {
+	return s.t.maximumLoad()
+}
+
+// PartitionsOf calls fn for each partition owned by the bin in ascending order until fn returns false.
+// The partitions are walked on the snapshot taken when it's called, so fn may modify the ring.
+func (c *Consistent) PartitionsOf(name string, fn func(partID PartitionID) bool) error {
+	return c.Snapshot().PartitionsOf(name, fn)
+}
+
+// RingPoints calls fn for each virtual node on the ring in ascending order of the hash until fn returns false.
+// The ring is walked on the snapshot taken when it's called, so fn may modify the ring.
+func (c *Consistent) RingPoints(fn func(hash uint64, bin Bin) bool) {
+	c.Snapshot().RingPoints(fn)
+}
+
+// AllBalls calls fn for each registered ball until fn returns false.
+// Unlike GetBalls, the balls are not copied into a slice at once. The walk is weakly consistent rather than
+// a snapshot because the ball store is read as it's walked: every ball registered before the call and not
+// deleted during the walk is observed exactly once and each partition is observed atomically, but the balls
+// registered or deleted in other partitions during the walk may or may not be observed. fn may modify the ring.
+func (c *Consistent) AllBalls(fn func(ball Ball) bool) error {
+	return c.balls.Range(func(_ PartitionID, ball Ball) bool {
+		return fn(ball)
+	})
+}
+
+// BallsInPartition calls fn for each ball registered in the partition until fn returns false.
+// The partition is observed atomically when it's called, so fn may modify the ring.
+func (c *Consistent) BallsInPartition(partID PartitionID, fn func(ball Ball) bool) error {
+	balls, err := c.balls.List(partID)
+	if err != nil {
+		return err
+	}
+
+	for _, ball := range balls {
+		if !fn(ball) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// PartitionRange represents the consecutive partitions from First to Last inclusive.
+type PartitionRange struct {
+	First PartitionID
+	Last  PartitionID
+}
+
+// Len returns the number of partitions in the range.
+func (r PartitionRange) Len() int {
+	return int(r.Last-r.First) + 1
+}
+
+// OwnedPartitions returns the partitions owned by the bin in the snapshot, compacted into ascending ranges.
+func (s *Snapshot) OwnedPartitions(name string) ([]PartitionRange, error) {
+	partitionIDs, ok := s.t.loads[name]
+	if !ok {
+		return nil, &BinError{Name: name, Err: ErrBinNotFound}
+	}
+
+	return compactPartitions(partitionIDs), nil
+}
+
+// OwnedPartitions returns the partitions owned by the bin, compacted into ascending ranges.
+// It's more compact than Bin.PartitionIDs when the bin owns a large number of partitions.
+func (c *Consistent) OwnedPartitions(name string) ([]PartitionRange, error) {
+	return c.Snapshot().OwnedPartitions(name)
+}
+
+// compactPartitions compacts the ascending partitions into the ranges.
+func compactPartitions(partitionIDs []PartitionID) []PartitionRange {
+	ranges := []PartitionRange{}
+	for _, partID := range partitionIDs {
+		if n := len(ranges); n > 0 && ranges[n-1].Last+1 == partID {
+			ranges[n-1].Last = partID
+			continue
+		}
+		ranges = append(ranges, PartitionRange{First: partID, Last: partID})
+	}
+	return ranges
+}
+
+// State represents the serializable state of the ring.
+// Restore restores the same partition table from it, including the partitions which are pinned or placed
+// by the minimal movement mode and the bins which are ejected.
+type State struct {
+	// Version is the version of the ring. The restored ring starts from it.
+	Version uint64 `json:"version,omitempty"`
+
+	// PlacementVersion is the placement version of the ring.
+	PlacementVersion PlacementVersion `json:"placement_version"`
+
+	// Partition is the number of partitions of the ring.
+	Partition uint64 `json:"partition"`
+
+	// ReplicationFactor is the replication factor of the ring. The restored ring uses it instead of the config
+	// if it's set, so the ring tuned by AutoTune is restored with the same virtual nodes.
+	ReplicationFactor int `json:"replication_factor,omitempty"`
+
+	// Bins are the bins in ascending order of the name.
+	Bins []BinState `json:"bins"`
+
+	// Owners holds the index of the bin in Bins which owns each partition, indexed by the partition ID.
+	// It's empty if the ring has no bin.
+	Owners []int `json:"owners"`
+
+	// Pins are the pinned partitions in ascending order of the partition ID.
+	Pins []PartitionPin `json:"pins,omitempty"`
+
+	// Overrides are the overrides which have not expired, sorted by the key.
+	Overrides []Override `json:"overrides,omitempty"`
+
+	// Ejected are the names of the ejected bins in ascending order. Their partitions are served by the same
+	// bins after the ring is restored.
+	Ejected []string `json:"ejected,omitempty"`
+}
+
+// BinState represents the serializable state of a bin.
+type BinState struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// State returns the serializable state of the snapshot.
+func (s *Snapshot) State() *State {
+	st := &State{
+		Version:           s.t.version,
+		PlacementVersion:  s.t.placementVersion,
+		Partition:         s.t.partition,
+		ReplicationFactor: s.t.replicationFactor,
+		Bins:              make([]BinState, 0, len(s.t.bins)),
+		Owners:            make([]int, len(s.t.partitions)),
+		Pins:              s.t.listPins(),
+		Overrides:         s.t.overrides.list(s.t.now()),
+	}
+
+	for name := range s.t.ejected {
+		st.Ejected = append(st.Ejected, name)
+	}
+	sort.Strings(st.Ejected)
+
+	for _, bin := range s.t.bins {
+		st.Bins = append(st.Bins, BinState{Name: bin.Name, Labels: copyLabels(bin.Labels)})
+	}
+	sort.Slice(st.Bins, func(i, j int) bool {
+		return st.Bins[i].Name < st.Bins[j].Name
+	})
+
+	index := make(map[string]int, len(st.Bins))
+	for i, bin := range st.Bins {
+		index[bin.Name] = i
+	}
+	for partID, bin := range s.t.partitions {
+		st.Owners[partID] = index[bin.String()]
+	}
+	return st
+}
+
+// State returns the serializable state of the current ring.
+func (c *Consistent) State() *State {
+	return c.Snapshot().State()
+}
+
+// Restore generates a new Consistent which starts from the state.
+// The number of partitions and the placement version of the config must be the same as the state.
+func Restore(cfg *Config, st *State) (*Consistent, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	if st.Partition != cfg.Partition {
+		return nil, fmt.Errorf("%w: partition %d doesn't match %d", ErrInvalidState, st.Partition, cfg.Partition)
+	}
+	if v := cfg.placementVersion(); st.PlacementVersion != v {
+		return nil, fmt.Errorf("%w: placement version %d doesn't match %d", ErrInvalidState, st.PlacementVersion, v)
+	}
+
+	t := newTable(cfg)
+	if st.ReplicationFactor > 0 {
+		t.replicationFactor = st.ReplicationFactor
+	}
+	t.tunedBins = len(st.Bins)
+	for _, bin := range st.Bins {
+		if _, ok := t.bins[bin.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicated bin %s", ErrInvalidState, bin.Name)
+		}
+		t.add(NewBinWithLabels(bin.Name, bin.Labels))
+	}
+
+	if len(st.Bins) > 0 {
+		if uint64(len(st.Owners)) != st.Partition {
+			return nil, fmt.Errorf("%w: %d owners for %d partitions", ErrInvalidState, len(st.Owners), st.Partition)
+		}
+		t.partitions = make([]*Bin, len(st.Owners))
+		for _, bin := range st.Bins {
+			t.loads[bin.Name] = []PartitionID{}
+		}
+		for partID, i := range st.Owners {
+			if i < 0 || i >= len(st.Bins) {
+				return nil, fmt.Errorf("%w: owner of partition %d is out of range", ErrInvalidState, partID)
+			}
+			name := st.Bins[i].Name
+			t.partitions[partID] = t.bins[name]
+			t.loads[name] = append(t.loads[name], PartitionID(partID))
+		}
+	}
+
+	for _, pin := range st.Pins {
+		if pin.PartitionID < 0 || int(pin.PartitionID) >= len(t.partitions) {
+			return nil, fmt.Errorf("%w: pinned partition %d is out of range", ErrInvalidState, pin.PartitionID)
+		}
+		if owner := t.partitions[pin.PartitionID]; owner.String() != pin.Bin {
+			return nil, fmt.Errorf("%w: partition %d is not owned by the pinned bin %s", ErrInvalidState, pin.PartitionID, pin.Bin)
+		}
+		t.pins[pin.PartitionID] = pin.Bin
+	}
+
+	now := t.now()
+	ov := &overrides{}
+	for _, o := range st.Overrides {
+		if _, ok := t.bins[o.Bin]; !ok {
+			return nil, fmt.Errorf("%w: key %s is routed to the unknown bin %s", ErrInvalidState, o.Key, o.Bin)
+		}
+		ov = ov.with(o, now)
+	}
+	t.overrides = ov
+
+	for _, name := range st.Ejected {
+		if _, ok := t.bins[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown bin %s is ejected", ErrInvalidState, name)
+		}
+		t.ejected[name] = true
+	}
+	if len(t.ejected) > 0 && len(t.ejected) >= len(t.bins) {
+		return nil, fmt.Errorf("%w: all bins are ejected", ErrInvalidState)
+	}
+	if st.Version > 0 {
+		t.version = st.Version
+	}
+
+	// the failover of the ejected bins is found with the owners.
+	t.changed = nil
+	t.updateOwners()
+	return newConsistent(cfg, t), nil
+}
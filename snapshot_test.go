@@ -0,0 +1,478 @@
+package consistent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSnapshot_Isolation(t *testing.T) {
+	c, err := New(newConfig(), initialBins(2))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	s := c.Snapshot()
+	want := map[PartitionID]string{}
+	for partID := PartitionID(0); partID < PartitionID(newConfig().Partition); partID++ {
+		want[partID] = s.GetPartitionOwner(partID).String()
+	}
+
+	for _, bin := range initialBins(6)[2:] {
+		if err := c.Add(bin); err != nil {
+			t.Fatalf("failed to add bin: %v", err)
+		}
+	}
+	if err := c.Remove(initialBins(1)[0]); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+
+	if got := len(s.GetBins()); got != 2 {
+		t.Fatalf("snapshot should not see new bins, got:%d", got)
+	}
+	for partID, owner := range want {
+		if got := s.GetPartitionOwner(partID).String(); got != owner {
+			t.Fatalf("owner of partition %d changed in snapshot, got:%s, want:%s", partID, got, owner)
+		}
+	}
+	if got := len(c.Snapshot().GetBins()); got != 5 {
+		t.Fatalf("new snapshot should see the current bins, got:%d", got)
+	}
+}
+
+func TestConsistent_PartitionsOf(t *testing.T) {
+	type testcase struct {
+		name string
+		want error
+	}
+
+	tcs := map[string]testcase{
+		"existing bin": {
+			name: fmt.Sprintf("%s0", binPrefix),
+		},
+		"not existing bin": {
+			name: "not exist",
+			want: ErrBinNotFound,
+		},
+	}
+
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			var got []PartitionID
+			err := c.PartitionsOf(tc.name, func(partID PartitionID) bool {
+				got = append(got, partID)
+				return true
+			})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+			if err != nil {
+				return
+			}
+
+			if want := c.LoadDistribution()[tc.name]; float64(len(got)) != want {
+				t.Fatalf("number of partitions mismatch, got:%d, want:%f", len(got), want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i-1] >= got[i] {
+					t.Fatalf("partitions should be ascending, got:%v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestConsistent_RingPoints(t *testing.T) {
+	cfg := newConfig()
+	c, err := New(cfg, initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	var prev uint64
+	var cnt int
+	c.RingPoints(func(hash uint64, bin Bin) bool {
+		if cnt > 0 && hash <= prev {
+			t.Fatalf("ring points should be ascending, got:%d after %d", hash, prev)
+		}
+		prev = hash
+		cnt++
+		return true
+	})
+	if want := 4 * cfg.ReplicationFactor; cnt != want {
+		t.Fatalf("number of ring points mismatch, got:%d, want:%d", cnt, want)
+	}
+
+	cnt = 0
+	c.RingPoints(func(uint64, Bin) bool {
+		cnt++
+		return cnt < 3
+	})
+	if cnt != 3 {
+		t.Fatalf("walk should stop, got:%d", cnt)
+	}
+}
+
+func TestSnapshot_PartitionPoints(t *testing.T) {
+	cfg := newConfig()
+	for _, bins := range [][]Bin{nil, initialBins(4)} {
+		c, err := New(cfg, bins)
+		if err != nil {
+			t.Fatalf("failed to create consistent: %v", err)
+		}
+
+		var prev uint64
+		seen := make(map[PartitionID]bool)
+		c.Snapshot().PartitionPoints(func(hash uint64, partID PartitionID) bool {
+			if len(seen) > 0 && hash < prev {
+				t.Fatalf("partition points should be ascending, got:%d after %d", hash, prev)
+			}
+			if want := cfg.Hasher.Sum64(binary.LittleEndian.AppendUint64(nil, uint64(partID))); hash != want {
+				t.Fatalf("unexpected hash of partition %d: got:%d want:%d", partID, hash, want)
+			}
+			prev = hash
+			seen[partID] = true
+			return true
+		})
+		if uint64(len(seen)) != cfg.Partition {
+			t.Fatalf("number of partition points mismatch, got:%d, want:%d", len(seen), cfg.Partition)
+		}
+	}
+}
+
+func TestConsistent_AllBalls(t *testing.T) {
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	for _, b := range initialBalls(50) {
+		c.Locate(b)
+	}
+
+	var cnt int
+	if err := c.AllBalls(func(b Ball) bool {
+		cnt++
+		// the ring can be modified during the walk.
+		if err := c.Delete(b); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+		return true
+	}); err != nil {
+		t.Fatalf("failed to walk: %v", err)
+	}
+
+	if cnt != 50 {
+		t.Fatalf("number of balls mismatch, got:%d, want:%d", cnt, 50)
+	}
+	if got := len(c.GetBalls()); got != 0 {
+		t.Fatalf("balls should be deleted during the walk, got:%d", got)
+	}
+}
+
+func TestConsistent_AllBallsWeaklyConsistent(t *testing.T) {
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	registered := map[string]bool{}
+	for _, b := range initialBalls(100) {
+		c.Locate(b)
+		registered[b.String()] = true
+	}
+
+	// the balls are registered while the walk is in progress.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.Locate(ball([]byte(fmt.Sprintf("new%d", i))))
+		}
+	}()
+
+	seen := map[string]int{}
+	if err := c.AllBalls(func(b Ball) bool {
+		seen[b.String()]++
+		// fn may register the balls too.
+		c.Locate(ball([]byte("new" + b.String())))
+		return true
+	}); err != nil {
+		t.Fatalf("failed to walk: %v", err)
+	}
+	<-done
+
+	for name := range registered {
+		if seen[name] != 1 {
+			t.Fatalf("ball %s registered before the walk should be observed once, got:%d", name, seen[name])
+		}
+	}
+	for name, cnt := range seen {
+		if !registered[name] && !strings.HasPrefix(name, "new") {
+			t.Fatalf("unknown ball %s is observed", name)
+		}
+		if cnt != 1 {
+			t.Fatalf("ball %s should be observed at most once, got:%d", name, cnt)
+		}
+	}
+}
+
+func TestConsistent_BallsInPartition(t *testing.T) {
+	c, err := New(newConfig(), initialBins(4))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	balls := initialBalls(50)
+	for _, b := range balls {
+		c.Locate(b)
+	}
+
+	partID := c.FindPartitionID([]byte(balls[0].String()))
+	want := map[string]bool{}
+	for _, b := range balls {
+		if c.FindPartitionID([]byte(b.String())) == partID {
+			want[b.String()] = true
+		}
+	}
+
+	var cnt int
+	if err := c.BallsInPartition(partID, func(b Ball) bool {
+		if !want[b.String()] {
+			t.Fatalf("ball %s should not be in partition %d", b.String(), partID)
+		}
+		cnt++
+		return true
+	}); err != nil {
+		t.Fatalf("failed to walk: %v", err)
+	}
+	if cnt != len(want) {
+		t.Fatalf("number of balls mismatch, got:%d, want:%d", cnt, len(want))
+	}
+}
+
+func TestConsistent_OwnedPartitions(t *testing.T) {
+	type testcase struct {
+		partitionIDs []PartitionID
+		want         []PartitionRange
+	}
+
+	tcs := map[string]testcase{
+		"no partition": {
+			want: []PartitionRange{},
+		},
+		"single partition": {
+			partitionIDs: []PartitionID{3},
+			want:         []PartitionRange{{First: 3, Last: 3}},
+		},
+		"consecutive partitions": {
+			partitionIDs: []PartitionID{0, 1, 2, 5, 7, 8},
+			want:         []PartitionRange{{First: 0, Last: 2}, {First: 5, Last: 5}, {First: 7, Last: 8}},
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(compactPartitions(tc.partitionIDs), tc.want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+
+	cfg := newConfig()
+	c, err := New(cfg, initialBins(3))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	var total int
+	for _, bin := range c.GetBins() {
+		ranges, err := c.OwnedPartitions(bin.String())
+		if err != nil {
+			t.Fatalf("failed to get owned partitions: %v", err)
+		}
+		for _, r := range ranges {
+			total += r.Len()
+		}
+	}
+	if total != int(cfg.Partition) {
+		t.Fatalf("ranges should cover all partitions, got:%d want:%d", total, cfg.Partition)
+	}
+
+	if _, err := c.OwnedPartitions("not exist"); !errors.Is(err, ErrBinNotFound) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrBinNotFound)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	cfg := newConfig()
+	cfg.MinimizeMovement = true
+	c, err := New(cfg, initialBins(3))
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	// the placement of the minimal movement mode depends on the history.
+	if err := c.Add(NewBinWithLabels("labeled", map[string]string{"zone": "a"})); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	if err := c.Pin(5, "labeled"); err != nil {
+		t.Fatalf("failed to pin: %v", err)
+	}
+	// the partitions of the ejected bin are served by the same bins.
+	if err := c.Eject(initialBins(2)[1].String()); err != nil {
+		t.Fatalf("failed to eject: %v", err)
+	}
+
+	b, err := json.Marshal(c.State())
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var st State
+	if err := json.Unmarshal(b, &st); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	restored, err := Restore(cfg, &st)
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if diff := cmp.Diff(owners(restored), owners(c)); diff != "" {
+		t.Fatalf("owners mismatch (-got,+want):%s", diff)
+	}
+	if diff := cmp.Diff(restored.Pins(), c.Pins()); diff != "" {
+		t.Fatalf("pins mismatch (-got,+want):%s", diff)
+	}
+	if diff := cmp.Diff(restored.Ejected(), c.Ejected()); diff != "" {
+		t.Fatalf("ejected mismatch (-got,+want):%s", diff)
+	}
+	if restored.Version() != c.Version() {
+		t.Fatalf("version mismatch, got:%d want:%d", restored.Version(), c.Version())
+	}
+	if diff := cmp.Diff(restored.LoadDistribution(), c.LoadDistribution()); diff != "" {
+		t.Fatalf("loads mismatch (-got,+want):%s", diff)
+	}
+	bin, err := restored.GetBin("labeled")
+	if err != nil {
+		t.Fatalf("failed to get bin: %v", err)
+	}
+	if diff := cmp.Diff(bin, c.GetPartitionOwner(5)); diff != "" {
+		t.Fatalf("bin mismatch (-got,+want):%s", diff)
+	}
+
+	// the restored ring keeps changing from the restored placement.
+	for _, r := range []*Consistent{c, restored} {
+		if err := r.Remove(initialBins(1)[0]); err != nil {
+			t.Fatalf("failed to remove bin: %v", err)
+		}
+	}
+	if diff := cmp.Diff(owners(restored), owners(c)); diff != "" {
+		t.Fatalf("owners mismatch after the change (-got,+want):%s", diff)
+	}
+}
+
+func TestRestore_Invalid(t *testing.T) {
+	type testcase struct {
+		modify func(st *State)
+	}
+
+	tcs := map[string]testcase{
+		"partition mismatch": {
+			modify: func(st *State) {
+				st.Partition++
+			},
+		},
+		"placement version mismatch": {
+			modify: func(st *State) {
+				st.PlacementVersion = 2
+			},
+		},
+		"duplicated bin": {
+			modify: func(st *State) {
+				st.Bins = append(st.Bins, st.Bins[0])
+			},
+		},
+		"missing owners": {
+			modify: func(st *State) {
+				st.Owners = st.Owners[1:]
+			},
+		},
+		"owner out of range": {
+			modify: func(st *State) {
+				st.Owners[0] = len(st.Bins)
+			},
+		},
+		"pin not owned": {
+			modify: func(st *State) {
+				st.Pins = []PartitionPin{{PartitionID: 0, Bin: st.Bins[(st.Owners[0]+1)%len(st.Bins)].Name}}
+			},
+		},
+		"pin out of range": {
+			modify: func(st *State) {
+				st.Pins = []PartitionPin{{PartitionID: PartitionID(st.Partition), Bin: st.Bins[0].Name}}
+			},
+		},
+		"unknown ejected bin": {
+			modify: func(st *State) {
+				st.Ejected = []string{"unknown"}
+			},
+		},
+		"all bins ejected": {
+			modify: func(st *State) {
+				st.Ejected = nil
+				for _, bin := range st.Bins {
+					st.Ejected = append(st.Ejected, bin.Name)
+				}
+			},
+		},
+	}
+
+	for n, tc := range tcs {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := New(newConfig(), initialBins(3))
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+			st := c.State()
+			tc.modify(st)
+
+			if _, err := Restore(newConfig(), st); !errors.Is(err, ErrInvalidState) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, ErrInvalidState)
+			}
+		})
+	}
+}
+
+func BenchmarkConsistent_AllBalls(b *testing.B) {
+	cfg := newConfig()
+	c, err := New(cfg, initialBins(100))
+	if err != nil {
+		b.Errorf("failed: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		c.Locate(ball([]byte(fmt.Sprintf("%s%d", ballPrefix, i))))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = c.AllBalls(func(Ball) bool {
+			return true
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package consistent
+
+import "sync"
+
+// BallStore is responsible for storing the located balls by their partition.
+// Implementations must be safe for concurrent use.
+type BallStore interface {
+	// Put stores the ball in the partition.
+	// Balls are identified by their names, so putting a ball of the same name replaces it.
+	Put(partID PartitionID, ball Ball) error
+
+	// Delete removes the ball from the partition.
+	// It returns ErrBallNotFound if the ball is not stored in the partition.
+	Delete(partID PartitionID, ball Ball) error
+
+	// List returns the balls stored in the partition.
+	List(partID PartitionID) ([]Ball, error)
+
+	// Count returns the number of the stored balls.
+	Count() (int, error)
+
+	// Range calls fn for each stored ball until fn returns false.
+	// Each partition must be observed atomically, but the balls put or deleted in other partitions
+	// during the walk may or may not be observed. fn may modify the store.
+	Range(fn func(partID PartitionID, ball Ball) bool) error
+}
+
+// memoryStore is a BallStore which keeps the balls in memory.
+type memoryStore struct {
+	mu    sync.RWMutex
+	parts map[PartitionID]*memoryPartition
+	count int
+}
+
+// memoryPartition holds the balls of a partition indexed by their names.
+type memoryPartition struct {
+	balls []Ball
+	index map[string]int
+}
+
+// NewMemoryBallStore generates a BallStore which keeps the balls in memory.
+// It's used by default if no BallStore is configured.
+func NewMemoryBallStore() BallStore {
+	return &memoryStore{
+		parts: make(map[PartitionID]*memoryPartition),
+	}
+}
+
+// Put stores the ball in the partition.
+func (s *memoryStore) Put(partID PartitionID, ball Ball) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.parts[partID]
+	if !ok {
+		p = &memoryPartition{index: make(map[string]int)}
+		s.parts[partID] = p
+	}
+
+	if i, ok := p.index[ball.String()]; ok {
+		p.balls[i] = ball
+		return nil
+	}
+	p.index[ball.String()] = len(p.balls)
+	p.balls = append(p.balls, ball)
+	s.count++
+	return nil
+}
+
+// Delete removes the ball from the partition.
+func (s *memoryStore) Delete(partID PartitionID, ball Ball) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.parts[partID]
+	if !ok {
+		return ErrBallNotFound
+	}
+	i, ok := p.index[ball.String()]
+	if !ok {
+		return ErrBallNotFound
+	}
+
+	// move the last ball to the hole to delete in constant time.
+	last := len(p.balls) - 1
+	if i != last {
+		p.balls[i] = p.balls[last]
+		p.index[p.balls[i].String()] = i
+	}
+	p.balls[last] = nil
+	p.balls = p.balls[:last]
+	delete(p.index, ball.String())
+	s.count--
+
+	if len(p.balls) == 0 {
+		delete(s.parts, partID)
+	}
+	return nil
+}
+
+// List returns a copy of the balls in the partition.
+func (s *memoryStore) List(partID PartitionID) ([]Ball, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	p, ok := s.parts[partID]
+	if !ok {
+		return []Ball{}, nil
+	}
+	balls := make([]Ball, len(p.balls))
+	copy(balls, p.balls)
+	return balls, nil
+}
+
+// Count returns the number of the stored balls.
+func (s *memoryStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.count, nil
+}
+
+// Range calls fn for each stored ball until fn returns false.
+// The lock is held only while a partition is copied, so fn may modify the store.
+func (s *memoryStore) Range(fn func(partID PartitionID, ball Ball) bool) error {
+	s.mu.RLock()
+	partIDs := make([]PartitionID, 0, len(s.parts))
+	for partID := range s.parts {
+		partIDs = append(partIDs, partID)
+	}
+	s.mu.RUnlock()
+
+	for _, partID := range partIDs {
+		balls, err := s.List(partID)
+		if err != nil {
+			return err
+		}
+
+		for _, ball := range balls {
+			if !fn(partID, ball) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// nopStore is a BallStore which doesn't keep any ball.
+type nopStore struct{}
+
+// NewNopBallStore generates a BallStore which doesn't keep any ball.
+// It's useful when the ring is only used for routing and the balls don't have to be tracked.
+func NewNopBallStore() BallStore {
+	return nopStore{}
+}
+
+// Put discards the ball.
+func (nopStore) Put(PartitionID, Ball) error {
+	return nil
+}
+
+// Delete always fails because no ball is stored.
+func (nopStore) Delete(PartitionID, Ball) error {
+	return ErrBallNotFound
+}
+
+// List always returns no ball.
+func (nopStore) List(PartitionID) ([]Ball, error) {
+	return []Ball{}, nil
+}
+
+// Count always returns zero.
+func (nopStore) Count() (int, error) {
+	return 0, nil
+}
+
+// Range never calls fn.
+func (nopStore) Range(func(PartitionID, Ball) bool) error {
+	return nil
+}
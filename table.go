@@ -0,0 +1,618 @@
+package consistent
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// table represents a state of the consistent hash ring.
+// A table is never modified once it's published to the Consistent. Mutations clone the
+// current table, modify the clone and swap it, so the readers holding the old table keep
+// seeing a consistent state without the lock.
+type table struct {
+	hasher                 Hasher
+	partition              uint64
+	replicationFactor      int
+	loadBalancingParameter float64
+	placementVersion       PlacementVersion
+	workers                int
+	minimizeMovement       bool
+	now                    func() time.Time
+	extractor              KeyExtractor
+
+	// autoTune is the auto tune with the defaults. It's nil if the replication factor is not tuned.
+	autoTune *AutoTune
+
+	// minReplicationFactor is the smallest replication factor tried by the auto tune.
+	minReplicationFactor int
+
+	// tunedBins is the number of bins when the replication factor was tuned last time.
+	tunedBins int
+
+	// version is increased by every change of the table. The first table of a ring is the version 1.
+	version uint64
+
+	// load is a mapping of a bin and it's load (partitions).
+	loads map[string][]PartitionID
+
+	// bins is a mapping of raw bin string and a bin.
+	bins map[string]*Bin
+
+	// partitions holds the owner of each partition indexed by the partition ID.
+	// It's empty until the partitions are distributed.
+	partitions []*Bin
+
+	// ring is a mapping hash to a bin.
+	ring map[uint64]*Bin
+
+	// sortedSet holds the sorted bins in the ring
+	sortedSet []uint64
+
+	// shadowed holds the names of the bins whose virtual nodes collided with the owner of the hash.
+	// They are sorted by name and one of them takes over the hash when the owner is removed.
+	shadowed map[uint64][]string
+
+	// overrides holds the keys routed to the bins regardless of their partitions.
+	overrides *overrides
+
+	// pins is a mapping partition ID to the name of the bin the partition is pinned to.
+	pins map[PartitionID]string
+
+	// ejected holds the names of the bins skipped by the lookups.
+	ejected map[string]bool
+
+	// failover holds the bin serving each partition owned by an ejected bin indexed by the partition ID.
+	// It's nil if no bin is ejected.
+	failover []*Bin
+
+	// keys holds the hashes of the partitions. It's shared by the tables once it's calculated.
+	keys *partitionKeys
+
+	// changed holds the hashes whose owner has changed since the partitions were distributed.
+	changed []uint64
+
+	// displaced holds the partitions which are not owned by their successor on the ring because of
+	// the load bound or the pins, in ascending order. It's never modified in place, so it's shared by the tables.
+	displaced []PartitionID
+}
+
+// newTable generates an empty table by passed config.
+func newTable(cfg *Config) *table {
+	t := &table{
+		hasher:                 cfg.Hasher,
+		partition:              cfg.Partition,
+		replicationFactor:      cfg.ReplicationFactor,
+		loadBalancingParameter: cfg.LoadBalancingParameter,
+		placementVersion:       cfg.placementVersion(),
+		workers:                cfg.workers(),
+		minimizeMovement:       cfg.MinimizeMovement,
+		now:                    time.Now,
+		extractor:              cfg.KeyExtractor,
+		version:                1,
+		loads:                  make(map[string][]PartitionID),
+		bins:                   make(map[string]*Bin),
+		ring:                   make(map[uint64]*Bin),
+		shadowed:               make(map[uint64][]string),
+		pins:                   make(map[PartitionID]string),
+		ejected:                make(map[string]bool),
+	}
+	if cfg.AutoTune != nil {
+		t.autoTune = cfg.AutoTune.withDefaults()
+		t.minReplicationFactor = cfg.ReplicationFactor
+		if t.autoTune.MaxReplicationFactor < t.minReplicationFactor {
+			t.autoTune.MaxReplicationFactor = t.minReplicationFactor
+		}
+	}
+	return t
+}
+
+// clone copies the ring of the table to be modified.
+// The partitions and the loads are shared until they are recalculated by distributePartitions.
+func (t *table) clone() *table {
+	t2 := *t
+	t2.version++
+
+	t2.bins = make(map[string]*Bin, len(t.bins))
+	for name, bin := range t.bins {
+		t2.bins[name] = bin
+	}
+
+	t2.ring = make(map[uint64]*Bin, len(t.ring))
+	for h, bin := range t.ring {
+		t2.ring[h] = bin
+	}
+
+	t2.sortedSet = make([]uint64, len(t.sortedSet))
+	copy(t2.sortedSet, t.sortedSet)
+
+	t2.changed = nil
+
+	t2.ejected = make(map[string]bool, len(t.ejected))
+	for name := range t.ejected {
+		t2.ejected[name] = true
+	}
+
+	t2.pins = make(map[PartitionID]string, len(t.pins))
+	for partID, name := range t.pins {
+		t2.pins[partID] = name
+	}
+
+	// the slices are never modified in place, so they can be shared.
+	t2.shadowed = make(map[uint64][]string, len(t.shadowed))
+	for h, names := range t.shadowed {
+		t2.shadowed[h] = names
+	}
+	return &t2
+}
+
+// vnodeKey returns the key hashed to place the i-th replica of the bin on the ring.
+// The key is the decimal replica index followed by the bin name. It's a part of the
+// placement and must not be changed within a placement version.
+func (t *table) vnodeKey(i int, name string) []byte {
+	key := make([]byte, 0, 20+len(name))
+	key = strconv.AppendInt(key, int64(i), 10)
+	return append(key, name...)
+}
+
+// partitionKey returns the key hashed to place the partition on the ring.
+// The key is the partition ID encoded in 8 bytes little endian. It's a part of the
+// placement and must not be changed within a placement version.
+func (t *table) partitionKey(bs []byte, partID uint64) []byte {
+	binary.LittleEndian.PutUint64(bs, partID)
+	return bs
+}
+
+// add replicates the bin by replication factor and stores to the ring.
+func (t *table) add(bin Bin) {
+	bin = bin.clone()
+	for i := 0; i < t.replicationFactor; i++ {
+		h := t.hasher.Sum64(t.vnodeKey(i, bin.String()))
+		t.place(h, &bin)
+	}
+	// sort hashes ascending
+	sort.Slice(t.sortedSet, func(i int, j int) bool {
+		return t.sortedSet[i] < t.sortedSet[j]
+	})
+	// storing bin at this map is useful to find backup bins of a partition.
+	t.bins[bin.String()] = &bin
+}
+
+// place puts a virtual node of the bin on the ring.
+// When the hash collides with another bin, the bin with the smallest name owns the hash,
+// so the ring doesn't depend on the order the bins were added.
+func (t *table) place(h uint64, bin *Bin) {
+	owner, ok := t.ring[h]
+	if !ok {
+		t.ring[h] = bin
+		t.sortedSet = append(t.sortedSet, h)
+		t.changed = append(t.changed, h)
+		return
+	}
+
+	switch {
+	case owner.Name == bin.Name:
+		// replicas of the same bin collided.
+	case bin.Name < owner.Name:
+		t.ring[h] = bin
+		t.shadow(h, owner.Name)
+		t.changed = append(t.changed, h)
+	default:
+		t.shadow(h, bin.Name)
+	}
+}
+
+// remove deletes the replicas of the bin from the ring.
+func (t *table) remove(bin Bin) {
+	for i := 0; i < t.replicationFactor; i++ {
+		h := t.hasher.Sum64(t.vnodeKey(i, bin.String()))
+		owner, ok := t.ring[h]
+		if !ok {
+			continue
+		}
+		if owner.Name != bin.Name {
+			t.unshadow(h, bin.Name)
+			continue
+		}
+		t.changed = append(t.changed, h)
+
+		// hand the hash over to the next bin collided with it.
+		if names := t.shadowed[h]; len(names) > 0 {
+			t.ring[h] = t.bins[names[0]]
+			t.unshadow(h, names[0])
+			continue
+		}
+		delete(t.ring, h)
+		t.delSlice(h)
+	}
+	delete(t.bins, bin.String())
+}
+
+// shadow records the bin whose virtual node collided with the owner of the hash.
+func (t *table) shadow(h uint64, name string) {
+	names := t.shadowed[h]
+	i := sort.SearchStrings(names, name)
+	if i < len(names) && names[i] == name {
+		return
+	}
+
+	res := make([]string, 0, len(names)+1)
+	res = append(res, names[:i]...)
+	res = append(res, name)
+	t.shadowed[h] = append(res, names[i:]...)
+}
+
+// unshadow forgets the bin collided with the owner of the hash.
+func (t *table) unshadow(h uint64, name string) {
+	names := t.shadowed[h]
+	res := make([]string, 0, len(names))
+	for _, n := range names {
+		if n != name {
+			res = append(res, n)
+		}
+	}
+
+	if len(res) == 0 {
+		delete(t.shadowed, h)
+		return
+	}
+	t.shadowed[h] = res
+}
+
+func (t *table) delSlice(val uint64) {
+	for i := 0; i < len(t.sortedSet); i++ {
+		if t.sortedSet[i] == val {
+			t.sortedSet = append(t.sortedSet[:i], t.sortedSet[i+1:]...)
+			break
+		}
+	}
+}
+
+// reset clears the partition table of the empty ring.
+// It returns the partitions which have lost their owner.
+func (t *table) reset() []PartitionID {
+	moved := make([]PartitionID, len(t.partitions))
+	for i := range moved {
+		moved[i] = PartitionID(i)
+	}
+	t.partitions = nil
+	t.loads = make(map[string][]PartitionID)
+	t.changed = nil
+	t.displaced = nil
+	t.updateOwners()
+	return moved
+}
+
+const (
+	// progressInterval is the number of partitions distributed between the checks of the cancellation
+	// and the reports of the progress.
+	progressInterval = 1 << 12
+
+	// successorChunk is the number of partitions whose successors are found at once.
+	successorChunk = 1 << 16
+
+	// minPartitionsPerWorker is the minimum number of partitions worth a worker goroutine.
+	minPartitionsPerWorker = 1 << 12
+)
+
+// distributePartitions calculates the partitions and each loads of the bin.
+// It returns the partitions whose owner has changed.
+// The table is left untouched if the context is done before all partitions are distributed.
+func (t *table) distributePartitions(ctx context.Context, progress ProgressFunc) ([]PartitionID, error) {
+	keys := t.keys
+	if keys == nil {
+		var err error
+		if keys, err = t.hashPartitions(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	// the partitions are assigned in ascending order of the ID, walking the ring which is ordered by the hashes.
+	d, _ := t.newDistribution()
+
+	// the successors are found in parallel, and then the partitions are assigned one by one
+	// because the bounded loads depend on the assignments of the preceding partitions.
+	succ := make([]int, successorChunk)
+	if t.partition < successorChunk {
+		succ = succ[:t.partition]
+	}
+	for first := uint64(0); first < t.partition; first += uint64(len(succ)) {
+		if rest := t.partition - first; rest < uint64(len(succ)) {
+			succ = succ[:rest]
+		}
+		t.successors(keys.hashes[first:first+uint64(len(succ))], succ)
+
+		for i, idx := range succ {
+			partID := first + uint64(i)
+			if partID%progressInterval == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				if progress != nil && partID > 0 {
+					progress(partID, t.partition)
+				}
+			}
+
+			if d.partitions[partID] != nil {
+				// the partition is pinned.
+				continue
+			}
+			if err := d.distributeWithLoad(PartitionID(partID), idx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if progress != nil {
+		progress(t.partition, t.partition)
+	}
+
+	t.keys = keys
+	return t.apply(d), nil
+}
+
+// newDistribution generates a distribution of the table which has only the pinned partitions.
+// The pinned partitions are counted against the load of the bins. The bins are indexed to walk
+// the ring without looking up the maps. The order of the bins doesn't matter here.
+// It returns the index of the bins by their names.
+func (t *table) newDistribution() (*distribution, map[string]int) {
+	d := &distribution{
+		maxLoad:                t.maximumLoad(),
+		loadBalancingParameter: t.loadBalancingParameter,
+		bins:                   make([]*Bin, 0, len(t.bins)),
+		owners:                 make([]int, len(t.sortedSet)),
+		loads:                  make([][]PartitionID, 0, len(t.bins)),
+		partitions:             make([]*Bin, t.partition),
+	}
+	index := make(map[string]int, len(t.bins))
+	for name, bin := range t.bins {
+		index[name] = len(d.bins)
+		d.bins = append(d.bins, bin)
+		d.loads = append(d.loads, []PartitionID{})
+	}
+	for i, h := range t.sortedSet {
+		d.owners[i] = index[t.ring[h].String()]
+	}
+	for partID, name := range t.pins {
+		owner := index[name]
+		d.partitions[partID] = d.bins[owner]
+		d.loads[owner] = append(d.loads[owner], partID)
+		d.displaced = append(d.displaced, partID)
+	}
+	return d, index
+}
+
+// apply replaces the partitions of the table with the distribution.
+// It returns the partitions whose owner has changed.
+func (t *table) apply(d *distribution) []PartitionID {
+	moved := []PartitionID{}
+	for partID, bin := range d.partitions {
+		if partID >= len(t.partitions) || t.partitions[partID].String() != bin.String() {
+			moved = append(moved, PartitionID(partID))
+		}
+	}
+
+	loads := make(map[string][]PartitionID, len(d.bins))
+	for i, bin := range d.bins {
+		ids := d.loads[i]
+		if len(t.pins) > 0 {
+			// the pinned partitions are assigned ahead of the others.
+			sort.Slice(ids, func(i, j int) bool {
+				return ids[i] < ids[j]
+			})
+		}
+		loads[bin.String()] = ids
+	}
+	t.partitions = d.partitions
+	t.loads = loads
+	sort.Slice(d.displaced, func(i, j int) bool {
+		return d.displaced[i] < d.displaced[j]
+	})
+	t.changed = nil
+	t.displaced = d.displaced
+	t.updateOwners()
+	return moved
+}
+
+// parallel calls fn with the ranges which split [0, n) among the workers and waits for them.
+func (t *table) parallel(n int, fn func(lo, hi int)) {
+	workers := t.workers
+	if w := n / minPartitionsPerWorker; w < workers {
+		workers = w
+	}
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	size := (n + workers - 1) / workers
+	for lo := 0; lo < n; lo += size {
+		hi := lo + size
+		if hi > n {
+			hi = n
+		}
+
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+}
+
+// hashPartitions calculates the hashes of the partition keys in parallel.
+func (t *table) hashPartitions(ctx context.Context) (*partitionKeys, error) {
+	hashes := make([]uint64, t.partition)
+	for first := 0; first < len(hashes); first += successorChunk {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		chunk := hashes[first:]
+		if len(chunk) > successorChunk {
+			chunk = chunk[:successorChunk]
+		}
+		t.parallel(len(chunk), func(lo, hi int) {
+			bs := make([]byte, 8)
+			for i := lo; i < hi; i++ {
+				chunk[i] = t.hasher.Sum64(t.partitionKey(bs, uint64(first+i)))
+			}
+		})
+	}
+	return &partitionKeys{hashes: hashes}, nil
+}
+
+// successors finds the index of the first virtual node clockwise from each hash of the partitions.
+// The partitions are split among the workers, and the result doesn't depend on the number of the workers.
+func (t *table) successors(hashes []uint64, succ []int) {
+	t.parallel(len(succ), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			succ[i] = t.successor(hashes[i])
+		}
+	})
+}
+
+// successor returns the index of the first virtual node clockwise from the hash.
+func (t *table) successor(key uint64) int {
+	idx := sort.Search(len(t.sortedSet), func(i int) bool {
+		return t.sortedSet[i] >= key
+	})
+	if idx >= len(t.sortedSet) {
+		idx = 0
+	}
+	return idx
+}
+
+// updateOwners replaces the bins with the copies holding their current partitions.
+// The bins of the previous table are left untouched, so they keep their partitions.
+func (t *table) updateOwners() {
+	owners := make(map[string]*Bin, len(t.bins))
+	for name, bin := range t.bins {
+		bin2 := *bin
+		ids := t.loads[name]
+		// clip the capacity so appending to the returned copies never writes to the shared array.
+		bin2.PartitionIDs = ids[:len(ids):len(ids)]
+		owners[name] = &bin2
+		t.bins[name] = &bin2
+	}
+	for h, bin := range t.ring {
+		t.ring[h] = owners[bin.String()]
+	}
+	for partID, bin := range t.partitions {
+		t.partitions[partID] = owners[bin.String()]
+	}
+	t.updateFailover()
+}
+
+// distribution holds the state of the partitions being distributed.
+type distribution struct {
+	maxLoad float64
+
+	// loadBalancingParameter is kept to report the capacity error.
+	loadBalancingParameter float64
+
+	// bins holds the bins indexed by the order of the iteration.
+	bins []*Bin
+
+	// owners holds the index of the bin of each virtual node in the order of the ring.
+	owners []int
+
+	// loads holds the partitions of each bin.
+	loads [][]PartitionID
+
+	// partitions holds the owner of each partition indexed by the partition ID.
+	partitions []*Bin
+
+	// displaced holds the partitions which are not owned by their successor.
+	displaced []PartitionID
+}
+
+// distributeWithLoad assigns the partition to the first bin from the idx-th virtual node
+// which doesn't exceed the maximum load.
+func (d *distribution) distributeWithLoad(partID PartitionID, idx int) error {
+	var count int
+	for {
+		count++
+		if count >= len(d.owners) {
+			return &CapacityError{
+				Partitions: uint64(len(d.partitions)),
+				Bins:       len(d.bins),
+				MaxLoad:    d.maxLoad,
+				LoadParam:  d.loadBalancingParameter,
+			}
+		}
+		owner := d.owners[idx]
+		load := float64(len(d.loads[owner]))
+		if load+1 <= d.maxLoad {
+			if count > 1 {
+				d.displaced = append(d.displaced, partID)
+			}
+			d.partitions[partID] = d.bins[owner]
+			d.loads[owner] = append(d.loads[owner], partID)
+			return nil
+		}
+		idx++
+		if idx >= len(d.owners) {
+			idx = 0
+		}
+	}
+}
+
+// findPartitionID returns partition id for given key.
+func (t *table) findPartitionID(key []byte) PartitionID {
+	if t.extractor != nil {
+		key = t.extractor(key)
+	}
+	hkey := t.hasher.Sum64(key)
+	return PartitionID(hkey % t.partition)
+}
+
+// owner returns a thread-safe copy of the owner of the partition.
+func (t *table) owner(partID PartitionID) *Bin {
+	bin := t.serving(partID)
+	if bin == nil {
+		return nil
+	}
+	bin2 := bin.clone()
+	return &bin2
+}
+
+// serving returns the bin serving the partition without copying it, so the bin must not be modified.
+// It's the failover of the owner if the owner is ejected.
+func (t *table) serving(partID PartitionID) *Bin {
+	if partID < 0 || int(partID) >= len(t.partitions) {
+		return nil
+	}
+	if t.failover != nil && t.failover[partID] != nil {
+		return t.failover[partID]
+	}
+	return t.partitions[partID]
+}
+
+// minimumMoved returns the number of partitions which have to move from the previous table.
+// The partitions of the removed bins and the partitions exceeding the maximum load have to move.
+func (t *table) minimumMoved(prev *table) int {
+	maxLoad := t.maximumLoad()
+	var res int
+	for name, ids := range prev.loads {
+		if _, ok := t.bins[name]; !ok {
+			res += len(ids)
+			continue
+		}
+		if excess := float64(len(ids)) - maxLoad; excess > 0 {
+			res += int(excess)
+		}
+	}
+	return res
+}
+
+// maximumLoad calculates the maximum load of a bin.
+func (t *table) maximumLoad() float64 {
+	load := float64(float64(t.partition)/float64(len(t.bins))) * t.loadBalancingParameter
+	return math.Ceil(load)
+}
@@ -0,0 +1,69 @@
+package consistent
+
+import (
+	"context"
+	"fmt"
+)
+
+// VersionConflictError represents an error which means the ring has changed since the expected version.
+// It matches ErrVersionConflict with errors.Is.
+type VersionConflictError struct {
+	// Expected is the version the caller expected.
+	Expected uint64
+
+	// Actual is the current version of the ring.
+	Actual uint64
+}
+
+// Error returns the message of the error.
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%s: expected %d, actual %d", ErrVersionConflict, e.Expected, e.Actual)
+}
+
+// Unwrap returns ErrVersionConflict.
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// Version returns the current version of the ring.
+// The version is increased by every change of the ring, including the pins, the overrides and the ejections.
+// A new ring starts from the version 1 and a restored ring starts from the version of the state.
+func (c *Consistent) Version() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.table.version
+}
+
+// LookupWithVersion finds a home for given key without registering it, and returns the version of the
+// ring used to find it.
+func (c *Consistent) LookupWithVersion(key []byte) (*Bin, PartitionID, uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	bin, partID := c.table.locate(key)
+	return bin, partID, c.table.version
+}
+
+// AddIfVersion adds a new bin to the consistent hash ring if the ring is at the version.
+// It returns a *VersionConflictError if the ring has changed since the version, so the callers
+// can change the ring with optimistic concurrency control.
+func (c *Consistent) AddIfVersion(bin Bin, version uint64) error {
+	return c.add(context.Background(), bin, &version)
+}
+
+// RemoveIfVersion removes a bin from the consistent hash ring if the ring is at the version.
+// It returns a *VersionConflictError if the ring has changed since the version.
+// It does nothing and doesn't change the version if the bin does not exist.
+func (c *Consistent) RemoveIfVersion(bin Bin, version uint64) error {
+	return c.remove(context.Background(), bin, &version)
+}
+
+// checkVersion returns a *VersionConflictError if the ring is not at the version.
+// The caller must hold wmu.
+func (c *Consistent) checkVersion(version *uint64) error {
+	if version != nil && *version != c.table.version {
+		return &VersionConflictError{Expected: *version, Actual: c.table.version}
+	}
+	return nil
+}
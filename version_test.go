@@ -0,0 +1,135 @@
+package consistent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConsistent_Version(t *testing.T) {
+	bins := initialBins(3)
+	c, err := New(newConfig(), bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+
+	var versions []uint64
+	c.Subscribe(func(e Event) {
+		versions = append(versions, e.Version)
+	})
+
+	steps := []struct {
+		name string
+		fn   func() error
+		want uint64
+	}{
+		{name: "add", fn: func() error { return c.Add(NewBin("extra")) }, want: 2},
+		{name: "remove unknown", fn: func() error { return c.Remove(NewBin("unknown")) }, want: 2},
+		{name: "remove", fn: func() error { return c.Remove(bins[0]) }, want: 3},
+		{name: "pin", fn: func() error { return c.Pin(0, bins[1].String()) }, want: 4},
+		{name: "override", fn: func() error { return c.SetOverride(Override{Key: "key", Bin: bins[2].String()}, 0) }, want: 5},
+		{name: "delete unknown override", fn: func() error { c.DeleteOverride("unknown", false); return nil }, want: 5},
+		{name: "eject", fn: func() error { return c.Eject(bins[1].String()) }, want: 6},
+	}
+	for _, step := range steps {
+		if err := step.fn(); err != nil {
+			t.Fatalf("failed to %s: %v", step.name, err)
+		}
+		if got := c.Version(); got != step.want {
+			t.Fatalf("unexpected version after %s: got:%d want:%d", step.name, got, step.want)
+		}
+	}
+	if diff := cmp.Diff(versions, []uint64{2, 3, 4, 5, 6}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+
+	bin, _, version := c.LookupWithVersion([]byte("key"))
+	if bin.String() != bins[2].String() || version != 6 {
+		t.Fatalf("unexpected lookup: got:%s,%d want:%s,%d", bin, version, bins[2], 6)
+	}
+	if got := c.Snapshot().Version(); got != 6 {
+		t.Fatalf("unexpected version: got:%d want:%d", got, 6)
+	}
+
+	// the restored ring starts from the version of the state.
+	c2, err := Restore(newConfig(), c.State())
+	if err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if got := c2.Version(); got != 6 {
+		t.Fatalf("unexpected version: got:%d want:%d", got, 6)
+	}
+}
+
+func TestConsistent_IfVersion(t *testing.T) {
+	type testcase struct {
+		fn      func(c *Consistent, version uint64) error
+		version uint64
+		bins    int
+		want    error
+	}
+
+	bins := initialBins(3)
+	tcs := map[string]testcase{
+		"add": {
+			fn: func(c *Consistent, version uint64) error {
+				return c.AddIfVersion(NewBin("extra"), version)
+			},
+			version: 1,
+			bins:    4,
+		},
+		"add on stale version": {
+			fn: func(c *Consistent, version uint64) error {
+				return c.AddIfVersion(NewBin("extra"), version)
+			},
+			version: 2,
+			bins:    3,
+			want:    &VersionConflictError{Expected: 2, Actual: 1},
+		},
+		"remove": {
+			fn: func(c *Consistent, version uint64) error {
+				return c.RemoveIfVersion(bins[0], version)
+			},
+			version: 1,
+			bins:    2,
+		},
+		"remove on stale version": {
+			fn: func(c *Consistent, version uint64) error {
+				return c.RemoveIfVersion(bins[0], version)
+			},
+			version: 0,
+			bins:    3,
+			want:    &VersionConflictError{Expected: 0, Actual: 1},
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			c, err := New(newConfig(), bins)
+			if err != nil {
+				t.Fatalf("failed to create consistent: %v", err)
+			}
+
+			err = tc.fn(c, tc.version)
+			if tc.want != nil {
+				var conflict *VersionConflictError
+				if !errors.Is(err, ErrVersionConflict) || !errors.As(err, &conflict) {
+					t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+				}
+				if diff := cmp.Diff(conflict, tc.want); diff != "" {
+					t.Fatalf("mismatch (-got,+want):%s", diff)
+				}
+			} else if err != nil {
+				t.Fatalf("error unexpected: got:%v want:%v", err, nil)
+			}
+
+			if got := len(c.GetBins()); got != tc.bins {
+				t.Fatalf("unexpected bins: got:%d want:%d", got, tc.bins)
+			}
+		})
+	}
+}
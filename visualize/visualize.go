@@ -0,0 +1,442 @@
+// Package visualize renders a consistent hash ring for debugging the placement.
+//
+// A Diagram is built from a snapshot of the ring and holds the virtual nodes of each bin, the arcs
+// of the partitions coloured by their owner and the load of each bin. It's written as a Graphviz DOT
+// graph, a self-contained SVG image or a static HTML page embedding the SVG.
+package visualize
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/KeisukeYamashita/consistent"
+)
+
+// Format represents the output format of the diagram.
+type Format string
+
+const (
+	// FormatDOT is a Graphviz DOT graph.
+	FormatDOT Format = "dot"
+
+	// FormatSVG is a self-contained SVG image.
+	FormatSVG Format = "svg"
+
+	// FormatHTML is a static HTML page embedding the SVG image.
+	FormatHTML Format = "html"
+)
+
+// ErrUnsupportedFormat represents an error which means the output format is not supported.
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// unownedColor is the color of the partitions which have no owner.
+const unownedColor = "#cccccc"
+
+// Bin represents a bin in the diagram.
+type Bin struct {
+	// Name is the name of the bin.
+	Name string
+
+	// Color is the color of the bin in the hex notation.
+	Color string
+
+	// Points is the number of the virtual nodes of the bin.
+	Points int
+
+	// Load is the number of the partitions owned by the bin.
+	Load float64
+}
+
+// Point represents a virtual node on the ring.
+type Point struct {
+	// Hash is the position of the virtual node.
+	Hash uint64
+
+	// Bin is the name of the bin of the virtual node.
+	Bin string
+}
+
+// Arc represents the consecutive partitions on the ring owned by the same bin.
+type Arc struct {
+	// From is the hash of the partition preceding the arc. The arc covers the whole ring if it equals To.
+	From uint64
+
+	// To is the hash of the last partition of the arc.
+	To uint64
+
+	// Bin is the name of the bin owning the partitions. It's empty if the partitions have no owner.
+	Bin string
+
+	// Partitions is the number of the partitions on the arc.
+	Partitions int
+}
+
+// Diagram represents the ring to be rendered.
+type Diagram struct {
+	// Bins holds the bins in ascending order of the name.
+	Bins []Bin
+
+	// Points holds the virtual nodes in ascending order of the hash.
+	Points []Point
+
+	// Arcs holds the partition arcs clockwise from the smallest hash.
+	Arcs []Arc
+
+	// MaximumLoad is the maximum number of the partitions of a bin.
+	MaximumLoad float64
+}
+
+// New builds the diagram of the snapshot.
+func New(s *consistent.Snapshot) *Diagram {
+	d := &Diagram{MaximumLoad: s.MaximumLoad()}
+
+	loads := s.LoadDistribution()
+	bins := s.GetBins()
+	sort.Slice(bins, func(i, j int) bool {
+		return bins[i].Name < bins[j].Name
+	})
+	index := make(map[string]int, len(bins))
+	for i, bin := range bins {
+		index[bin.Name] = i
+		d.Bins = append(d.Bins, Bin{Name: bin.Name, Color: color(i), Load: loads[bin.Name]})
+	}
+
+	s.RingPoints(func(hash uint64, bin consistent.Bin) bool {
+		d.Points = append(d.Points, Point{Hash: hash, Bin: bin.Name})
+		d.Bins[index[bin.Name]].Points++
+		return true
+	})
+
+	s.PartitionPoints(func(hash uint64, partID consistent.PartitionID) bool {
+		var name string
+		if owner := s.GetPartitionOwner(partID); owner != nil {
+			name = owner.Name
+		}
+
+		if n := len(d.Arcs); n > 0 && d.Arcs[n-1].Bin == name {
+			d.Arcs[n-1].To = hash
+			d.Arcs[n-1].Partitions++
+			return true
+		}
+		arc := Arc{To: hash, Bin: name, Partitions: 1}
+		if n := len(d.Arcs); n > 0 {
+			arc.From = d.Arcs[n-1].To
+		}
+		d.Arcs = append(d.Arcs, arc)
+		return true
+	})
+
+	// the first arc starts from the last partition, and it's merged with the last arc if they have the same owner.
+	if n := len(d.Arcs); n > 1 && d.Arcs[0].Bin == d.Arcs[n-1].Bin {
+		d.Arcs[0].Partitions += d.Arcs[n-1].Partitions
+		d.Arcs = d.Arcs[:n-1]
+	}
+	if n := len(d.Arcs); n > 0 {
+		d.Arcs[0].From = d.Arcs[n-1].To
+	}
+	return d
+}
+
+// Write writes the diagram in the format.
+func (d *Diagram) Write(w io.Writer, f Format) error {
+	switch f {
+	case FormatDOT:
+		return d.WriteDOT(w)
+	case FormatSVG:
+		return d.WriteSVG(w)
+	case FormatHTML:
+		return d.WriteHTML(w)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnsupportedFormat, f)
+	}
+}
+
+// WriteDOT writes the diagram as a Graphviz DOT graph.
+// The virtual nodes and the partition arcs are chained clockwise in a cycle, which the circo layout draws
+// as a circle. The loads are written as a table in a separate cluster.
+func (d *Diagram) WriteDOT(w io.Writer) error {
+	ew := newErrWriter(w)
+	ew.printf("digraph ring {\n")
+	ew.printf("\tlayout=circo;\n")
+	ew.printf("\tnode [style=filled, fontname=\"Helvetica\", fontsize=10];\n")
+	ew.printf("\tedge [arrowsize=0.5];\n")
+
+	type element struct {
+		hash  uint64
+		point bool
+		label string
+		color string
+	}
+	colors := d.colors()
+	elements := make([]element, 0, len(d.Points)+len(d.Arcs))
+	for _, p := range d.Points {
+		elements = append(elements, element{hash: p.Hash, point: true, label: p.Bin, color: colors[p.Bin]})
+	}
+	for _, a := range d.Arcs {
+		elements = append(elements, element{hash: a.To, label: fmt.Sprintf("%d partitions", a.Partitions), color: colorOf(colors, a.Bin)})
+	}
+	// a partition on a virtual node belongs to the virtual node, so the arc ends before it.
+	sort.SliceStable(elements, func(i, j int) bool {
+		if elements[i].hash != elements[j].hash {
+			return elements[i].hash < elements[j].hash
+		}
+		return !elements[i].point && elements[j].point
+	})
+
+	for i, e := range elements {
+		if e.point {
+			ew.printf("\te%d [shape=ellipse, label=%s, fillcolor=%s, tooltip=%s];\n",
+				i, dotQuote(e.label), dotQuote(e.color), dotQuote(fmt.Sprintf("%#016x", e.hash)))
+			continue
+		}
+		ew.printf("\te%d [shape=box, label=%s, fillcolor=%s, tooltip=%s];\n",
+			i, dotQuote(e.label), dotQuote(e.color), dotQuote(fmt.Sprintf("..%#016x", e.hash)))
+	}
+	for i := range elements {
+		ew.printf("\te%d -> e%d;\n", i, (i+1)%len(elements))
+	}
+
+	ew.printf("\tsubgraph cluster_loads {\n")
+	ew.printf("\t\tlabel=%s;\n", dotQuote(fmt.Sprintf("loads (maximum %s)", formatLoad(d.MaximumLoad))))
+	ew.printf("\t\tloads [shape=plaintext, style=\"\", label=<<TABLE BORDER=\"0\" CELLSPACING=\"2\">\n")
+	scale := d.scale()
+	for _, b := range d.Bins {
+		width := 1
+		if scale > 0 {
+			width = int(math.Max(1, 100*b.Load/scale))
+		}
+		ew.printf("\t\t\t<TR><TD ALIGN=\"LEFT\">%s</TD><TD ALIGN=\"RIGHT\">%s</TD><TD BGCOLOR=\"%s\" WIDTH=\"%d\" FIXEDSIZE=\"TRUE\" HEIGHT=\"12\"></TD></TR>\n",
+			html.EscapeString(b.Name), formatLoad(b.Load), b.Color, width)
+	}
+	ew.printf("\t\t</TABLE>>];\n")
+	ew.printf("\t}\n")
+	ew.printf("}\n")
+	return ew.flush()
+}
+
+const (
+	// svgRingX and svgRingY are the center of the ring in the SVG image.
+	svgRingX = 300
+	svgRingY = 300
+
+	// svgRingRadius is the radius of the partition arcs.
+	svgRingRadius = 220
+
+	// svgLegendX is the left edge of the legend.
+	svgLegendX = 600
+
+	// svgBarWidth is the width of the load bar of the most loaded bin.
+	svgBarWidth = 200
+)
+
+// WriteSVG writes the diagram as a self-contained SVG image.
+// The partition arcs are drawn clockwise from the top, the virtual nodes are marked outside the arcs,
+// and the load bars are drawn next to the ring with a dashed line at the maximum load.
+func (d *Diagram) WriteSVG(w io.Writer) error {
+	ew := newErrWriter(w)
+	d.writeSVG(ew)
+	return ew.flush()
+}
+
+// writeSVG writes the SVG image.
+func (d *Diagram) writeSVG(ew *errWriter) {
+	height := 600
+	if h := 100 + 24*len(d.Bins); h > height {
+		height = h
+	}
+	ew.printf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"960\" height=\"%d\" viewBox=\"0 0 960 %d\" font-family=\"Helvetica, Arial, sans-serif\" font-size=\"12\">\n", height, height)
+	ew.printf("<rect width=\"100%%\" height=\"100%%\" fill=\"#ffffff\"/>\n")
+	ew.printf("<g id=\"arcs\" fill=\"none\" stroke-width=\"24\">\n")
+
+	colors := d.colors()
+	for _, a := range d.Arcs {
+		title := fmt.Sprintf("%s: %d partitions (%#016x..%#016x]", binLabel(a.Bin), a.Partitions, a.From, a.To)
+		color := colorOf(colors, a.Bin)
+		if a.From == a.To {
+			ew.printf("<circle cx=\"%d\" cy=\"%d\" r=\"%d\" stroke=\"%s\"><title>%s</title></circle>\n",
+				svgRingX, svgRingY, svgRingRadius, color, html.EscapeString(title))
+			continue
+		}
+
+		x1, y1 := position(a.From, svgRingRadius)
+		x2, y2 := position(a.To, svgRingRadius)
+		large := 0
+		if a.To-a.From > math.MaxInt64 {
+			large = 1
+		}
+		ew.printf("<path d=\"M %.2f %.2f A %d %d 0 %d 1 %.2f %.2f\" stroke=\"%s\"><title>%s</title></path>\n",
+			x1, y1, svgRingRadius, svgRingRadius, large, x2, y2, color, html.EscapeString(title))
+	}
+	ew.printf("</g>\n")
+
+	ew.printf("<g id=\"points\" stroke=\"#333333\" stroke-width=\"0.5\">\n")
+	for _, p := range d.Points {
+		x, y := position(p.Hash, svgRingRadius+20)
+		ew.printf("<circle cx=\"%.2f\" cy=\"%.2f\" r=\"3\" fill=\"%s\"><title>%s %#016x</title></circle>\n",
+			x, y, colors[p.Bin], html.EscapeString(p.Bin), p.Hash)
+	}
+	ew.printf("</g>\n")
+
+	ew.printf("<g id=\"loads\">\n")
+	ew.printf("<text x=\"%d\" y=\"40\" font-size=\"14\" font-weight=\"bold\">Loads (maximum %s)</text>\n", svgLegendX, formatLoad(d.MaximumLoad))
+	scale := d.scale()
+	for i, b := range d.Bins {
+		y := 60 + 24*i
+		width := 0.0
+		if scale > 0 {
+			width = svgBarWidth * b.Load / scale
+		}
+		ew.printf("<rect x=\"%d\" y=\"%d\" width=\"12\" height=\"12\" fill=\"%s\"/>\n", svgLegendX, y, b.Color)
+		ew.printf("<text x=\"%d\" y=\"%d\">%s</text>\n", svgLegendX+18, y+10, html.EscapeString(b.Name))
+		ew.printf("<rect x=\"%d\" y=\"%d\" width=\"%.2f\" height=\"12\" fill=\"%s\"><title>%s partitions, %d virtual nodes</title></rect>\n",
+			svgLegendX+120, y, width, b.Color, formatLoad(b.Load), b.Points)
+		ew.printf("<text x=\"%.2f\" y=\"%d\">%s</text>\n", float64(svgLegendX+124)+width, y+10, formatLoad(b.Load))
+	}
+	if scale > 0 && len(d.Bins) > 0 {
+		x := float64(svgLegendX+120) + svgBarWidth*d.MaximumLoad/scale
+		ew.printf("<line x1=\"%.2f\" y1=\"54\" x2=\"%.2f\" y2=\"%d\" stroke=\"#d62728\" stroke-dasharray=\"4 2\"/>\n", x, x, 60+24*len(d.Bins))
+	}
+	ew.printf("</g>\n")
+	ew.printf("</svg>\n")
+}
+
+// WriteHTML writes the diagram as a static HTML page which embeds the SVG image and lists the bins.
+func (d *Diagram) WriteHTML(w io.Writer) error {
+	ew := newErrWriter(w)
+	ew.printf("<!DOCTYPE html>\n")
+	ew.printf("<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Consistent hash ring</title>\n")
+	ew.printf("<style>body{font-family:Helvetica,Arial,sans-serif;margin:24px}table{border-collapse:collapse}" +
+		"th,td{padding:4px 12px;border-bottom:1px solid #ddd;text-align:left}td.num{text-align:right}" +
+		".swatch{display:inline-block;width:12px;height:12px;margin-right:6px;vertical-align:middle}</style>\n")
+	ew.printf("</head>\n<body>\n<h1>Consistent hash ring</h1>\n")
+	ew.printf("<p>%d bins, %d virtual nodes, %d partition arcs, maximum load %s.</p>\n",
+		len(d.Bins), len(d.Points), len(d.Arcs), formatLoad(d.MaximumLoad))
+	d.writeSVG(ew)
+
+	ew.printf("<table>\n<thead><tr><th>Bin</th><th>Virtual nodes</th><th>Partitions</th><th>Load</th></tr></thead>\n<tbody>\n")
+	for _, b := range d.Bins {
+		ratio := 0.0
+		if d.MaximumLoad > 0 {
+			ratio = 100 * b.Load / d.MaximumLoad
+		}
+		ew.printf("<tr><td><span class=\"swatch\" style=\"background:%s\"></span>%s</td><td class=\"num\">%d</td><td class=\"num\">%s</td><td class=\"num\">%.1f%%</td></tr>\n",
+			b.Color, html.EscapeString(b.Name), b.Points, formatLoad(b.Load), ratio)
+	}
+	ew.printf("</tbody>\n</table>\n</body>\n</html>\n")
+	return ew.flush()
+}
+
+// colors returns a mapping the name of the bin to its color.
+func (d *Diagram) colors() map[string]string {
+	colors := make(map[string]string, len(d.Bins))
+	for _, b := range d.Bins {
+		colors[b.Name] = b.Color
+	}
+	return colors
+}
+
+// scale returns the load drawn as the longest bar, which is the maximum load or the largest load.
+func (d *Diagram) scale() float64 {
+	scale := d.MaximumLoad
+	for _, b := range d.Bins {
+		if b.Load > scale {
+			scale = b.Load
+		}
+	}
+	return scale
+}
+
+// colorOf returns the color of the bin or the color of the unowned partitions.
+func colorOf(colors map[string]string, name string) string {
+	if c, ok := colors[name]; ok {
+		return c
+	}
+	return unownedColor
+}
+
+// binLabel returns the label of the owner of the partitions.
+func binLabel(name string) string {
+	if name == "" {
+		return "unowned"
+	}
+	return name
+}
+
+// position returns the coordinates of the hash on the circle of the radius.
+// The smallest hash is at the top and the hashes increase clockwise.
+func position(hash uint64, radius float64) (float64, float64) {
+	theta := float64(hash)/math.Pow(2, 64)*2*math.Pi - math.Pi/2
+	return svgRingX + radius*math.Cos(theta), svgRingY + radius*math.Sin(theta)
+}
+
+// color returns the i-th color. The hues are spread by the golden angle, so the neighboring bins are
+// distinguishable with any number of bins.
+func color(i int) string {
+	h := math.Mod(float64(i)*137.508, 360) / 60
+	const s, l = 0.6, 0.5
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := l - c/2
+	return fmt.Sprintf("#%02x%02x%02x", int(math.Round((r+m)*255)), int(math.Round((g+m)*255)), int(math.Round((b+m)*255)))
+}
+
+// formatLoad formats the load without the trailing zeros.
+func formatLoad(v float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+}
+
+// dotEscaper escapes the string in a quoted DOT ID.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote quotes the string as a DOT ID.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// errWriter buffers the output and keeps the first error.
+type errWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// newErrWriter generates a writer buffering the output to w.
+func newErrWriter(w io.Writer) *errWriter {
+	return &errWriter{w: bufio.NewWriter(w)}
+}
+
+// printf writes the formatted string unless an error has occurred.
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
+
+// flush flushes the buffer and returns the first error.
+func (ew *errWriter) flush() error {
+	if ew.err != nil {
+		return ew.err
+	}
+	return ew.w.Flush()
+}
@@ -0,0 +1,155 @@
+package visualize
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"hash/fnv"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/google/go-cmp/cmp"
+)
+
+type hasher struct{}
+
+func (hs hasher) Sum64(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+func newConfig() *consistent.Config {
+	return &consistent.Config{
+		Partition:              271,
+		ReplicationFactor:      7,
+		LoadBalancingParameter: 1.25,
+		Hasher:                 hasher{},
+	}
+}
+
+func newDiagram(t *testing.T, names ...string) *Diagram {
+	t.Helper()
+
+	bins := make([]consistent.Bin, len(names))
+	for i, name := range names {
+		bins[i] = consistent.NewBin(name)
+	}
+	c, err := consistent.New(newConfig(), bins)
+	if err != nil {
+		t.Fatalf("failed to create consistent: %v", err)
+	}
+	return New(c.Snapshot())
+}
+
+func TestNew(t *testing.T) {
+	d := newDiagram(t, "c", "a", "b")
+
+	names := make([]string, len(d.Bins))
+	var load float64
+	var points int
+	for i, b := range d.Bins {
+		names[i] = b.Name
+		load += b.Load
+		points += b.Points
+	}
+	if diff := cmp.Diff(names, []string{"a", "b", "c"}); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	if load != 271 {
+		t.Fatalf("unexpected total load: got:%v want:%v", load, 271)
+	}
+	if points != 3*7 || len(d.Points) != points {
+		t.Fatalf("unexpected points: got:%d want:%d", len(d.Points), 3*7)
+	}
+
+	var partitions int
+	for i, a := range d.Arcs {
+		partitions += a.Partitions
+		prev := d.Arcs[(i+len(d.Arcs)-1)%len(d.Arcs)]
+		if a.From != prev.To {
+			t.Fatalf("arc %d should start at the end of the previous arc: got:%d want:%d", i, a.From, prev.To)
+		}
+		if a.Bin == prev.Bin {
+			t.Fatalf("adjacent arcs should have different owners: %s", a.Bin)
+		}
+	}
+	if partitions != 271 {
+		t.Fatalf("unexpected partitions: got:%d want:%d", partitions, 271)
+	}
+}
+
+func TestNew_Empty(t *testing.T) {
+	d := newDiagram(t)
+
+	want := []Arc{{From: d.Arcs[0].To, To: d.Arcs[0].To, Partitions: 271}}
+	if diff := cmp.Diff(d.Arcs, want); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+	for _, f := range []Format{FormatDOT, FormatSVG, FormatHTML} {
+		if err := d.Write(io.Discard, f); err != nil {
+			t.Fatalf("failed to write %s: %v", f, err)
+		}
+	}
+}
+
+func TestDiagram_Write(t *testing.T) {
+	type testcase struct {
+		format   Format
+		contains []string
+		xml      bool
+		want     error
+	}
+
+	tcs := map[string]testcase{
+		"dot": {
+			format:   FormatDOT,
+			contains: []string{"digraph ring {", "layout=circo;", `label="<a & \"b\">"`, "subgraph cluster_loads"},
+		},
+		"svg": {
+			format:   FormatSVG,
+			contains: []string{"<svg xmlns=", "<path d=", "&lt;a &amp; &#34;b&#34;&gt;"},
+			xml:      true,
+		},
+		"html": {
+			format:   FormatHTML,
+			contains: []string{"<!DOCTYPE html>", "<svg xmlns=", "<table>"},
+		},
+		"unsupported": {
+			format: Format("png"),
+			want:   ErrUnsupportedFormat,
+		},
+	}
+
+	d := newDiagram(t, `<a & "b">`, "node1", "node2")
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			var buf bytes.Buffer
+			if err := d.Write(&buf, tc.format); !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+			for _, s := range tc.contains {
+				if !strings.Contains(buf.String(), s) {
+					t.Fatalf("output should contain %q", s)
+				}
+			}
+
+			if tc.xml {
+				dec := xml.NewDecoder(&buf)
+				for {
+					if _, err := dec.Token(); err != nil {
+						if errors.Is(err, io.EOF) {
+							break
+						}
+						t.Fatalf("output should be well-formed: %v", err)
+					}
+				}
+			}
+		})
+	}
+}
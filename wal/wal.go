@@ -0,0 +1,564 @@
+// Package wal persists the mutations of a consistent hash ring to a write-ahead log.
+//
+// Every Add, Remove, Locate, Delete, Pin and Unpin is appended to the log as a checksummed record
+// before it's applied to the ring. The log is compacted into a snapshot of the ring and its balls
+// when it grows, and the ring is rebuilt on Open by restoring the snapshot and replaying the records
+// written after it. Records which were torn by a crash are discarded.
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/KeisukeYamashita/consistent/internal/logfile"
+)
+
+const (
+	opAdd byte = iota + 1
+	opRemove
+	opLocate
+	opDelete
+	opPin
+	opUnpin
+)
+
+const (
+	// maxRecordSize is the maximum size of a record body. Larger lengths are treated as corruption.
+	maxRecordSize = 1 << 30
+
+	// DefaultCompactThreshold is the default number of the records to compact the log into a snapshot.
+	DefaultCompactThreshold = 4096
+
+	logFile      = "wal"
+	snapshotFile = "snapshot"
+)
+
+var (
+	// ErrClosed represents an error which means the ring has already been closed.
+	ErrClosed = errors.New("ring closed")
+
+	// ErrNoDir represents an error which means the directory of the log is not configured.
+	ErrNoDir = errors.New("directory is required")
+
+	// ErrNoConfig represents an error which means the config of the ring is not configured.
+	ErrNoConfig = errors.New("config is required")
+
+	// ErrCorruptedSnapshot represents an error which means the snapshot doesn't match its checksum.
+	// The snapshot is replaced atomically, so it's never torn by a crash.
+	ErrCorruptedSnapshot = errors.New("corrupted snapshot")
+)
+
+// Config represents a configuration of the persistent ring.
+type Config struct {
+	// Dir is the directory of the log and the snapshot. It's created if it doesn't exist.
+	Dir string
+
+	// Config is the config of the ring. It must be the same every time the ring is opened.
+	Config *consistent.Config
+
+	// Bins are the bins of the ring which is created for the first time.
+	// They are ignored if the directory has the ring already.
+	Bins []consistent.Bin
+
+	// SyncWrites commits every record to the stable storage before the mutation returns.
+	// Otherwise the records written just before a crash of the machine may be lost.
+	SyncWrites bool
+
+	// CompactThreshold is the number of the records to compact the log into a snapshot.
+	// DefaultCompactThreshold is used if it's zero.
+	CompactThreshold int
+}
+
+// Ring is a consistent hash ring whose mutations are persisted to the log.
+// The mutations must be done through it, so the ring itself is not exposed.
+type Ring struct {
+	ring       *consistent.Consistent
+	dir        string
+	syncWrites bool
+	threshold  int
+
+	// mu serializes the mutations, so the records are in the order they are applied.
+	mu       sync.Mutex
+	f        *os.File
+	offset   int64
+	sequence uint64
+	records  int
+}
+
+// snapshot represents the content of the snapshot file.
+type snapshot struct {
+	// Sequence is the sequence number of the last record included in the snapshot.
+	Sequence uint64 `json:"sequence"`
+
+	State *consistent.State `json:"state"`
+	Balls []string          `json:"balls,omitempty"`
+}
+
+// Open opens the ring persisted in the directory, creating it from the bins if it doesn't exist.
+// The ring is rebuilt from the snapshot and the records written after it.
+func Open(cfg Config) (*Ring, error) {
+	if cfg.Dir == "" {
+		return nil, ErrNoDir
+	}
+	if cfg.Config == nil {
+		return nil, ErrNoConfig
+	}
+	if cfg.CompactThreshold <= 0 {
+		cfg.CompactThreshold = DefaultCompactThreshold
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	r := &Ring{
+		dir:        cfg.Dir,
+		syncWrites: cfg.SyncWrites,
+		threshold:  cfg.CompactThreshold,
+	}
+
+	snap, err := readSnapshot(filepath.Join(cfg.Dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		ring, err := consistent.New(cfg.Config, cfg.Bins)
+		if err != nil {
+			return nil, err
+		}
+		r.ring = ring
+		// the initial bins are persisted, so the ring doesn't depend on the bins of the next Open.
+		if err := r.writeSnapshot(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if r.ring, err = restore(cfg.Config, snap); err != nil {
+			return nil, err
+		}
+		r.sequence = snap.Sequence
+	}
+
+	f, err := os.OpenFile(filepath.Join(cfg.Dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	offset, err := r.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// discard the torn records at the tail.
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r.f = f
+	r.offset = offset
+	return r, nil
+}
+
+// restore generates the ring from the snapshot.
+func restore(cfg *consistent.Config, snap *snapshot) (*consistent.Consistent, error) {
+	if snap.State == nil {
+		return nil, fmt.Errorf("%w: no state", ErrCorruptedSnapshot)
+	}
+
+	ring, err := consistent.Restore(cfg, snap.State)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range snap.Balls {
+		if _, err := ring.Register(consistent.NewBall(name)); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// replay applies the records of the log written after the snapshot to the ring.
+// It returns the offset of the end of the last valid record.
+func (r *Ring) replay(f *os.File) (int64, error) {
+	br := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(br)
+		if err != nil {
+			if logfile.Torn(err) {
+				return offset, nil
+			}
+			return 0, err
+		}
+		offset += int64(n)
+
+		// the records before the snapshot remain if the ring crashed while compacting.
+		if rec.sequence <= r.sequence {
+			continue
+		}
+
+		// the mutation which failed when it was written fails again in the same way, so the error is ignored.
+		_, _ = r.apply(rec)
+		r.sequence = rec.sequence
+		r.records++
+	}
+}
+
+// Add adds a new bin to the ring.
+func (r *Ring) Add(bin consistent.Bin) error {
+	_, err := r.mutate(&record{op: opAdd, name: bin.Name, labels: bin.Labels})
+	return err
+}
+
+// Remove removes a bin from the ring.
+func (r *Ring) Remove(bin consistent.Bin) error {
+	_, err := r.mutate(&record{op: opRemove, name: bin.String()})
+	return err
+}
+
+// Locate finds a home for given ball and registers it to the ring.
+// Every call is written to the log, so use Lookup if the ball doesn't have to be registered.
+func (r *Ring) Locate(ball consistent.Ball) (*consistent.Bin, error) {
+	return r.mutate(&record{op: opLocate, name: ball.String()})
+}
+
+// Delete removes a ball from the ring.
+func (r *Ring) Delete(ball consistent.Ball) error {
+	_, err := r.mutate(&record{op: opDelete, name: ball.String()})
+	return err
+}
+
+// Pin forces the partition to be owned by the bin regardless of the ring.
+func (r *Ring) Pin(partID consistent.PartitionID, name string) error {
+	_, err := r.mutate(&record{op: opPin, partID: partID, name: name})
+	return err
+}
+
+// Unpin releases the partition from the bin it's pinned to.
+func (r *Ring) Unpin(partID consistent.PartitionID) error {
+	_, err := r.mutate(&record{op: opUnpin, partID: partID})
+	return err
+}
+
+// mutate writes the record to the log and applies it to the ring.
+// It returns the bin of the ball if the record locates a ball.
+func (r *Ring) mutate(rec *record) (*consistent.Bin, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil, ErrClosed
+	}
+
+	rec.sequence = r.sequence + 1
+	if err := r.write(rec); err != nil {
+		return nil, err
+	}
+	r.sequence = rec.sequence
+	r.records++
+
+	bin, err := r.apply(rec)
+	if r.records >= r.threshold {
+		if cerr := r.compact(); err == nil {
+			err = cerr
+		}
+	}
+	return bin, err
+}
+
+// apply applies the record to the ring.
+// It returns the bin of the ball if the record locates a ball.
+func (r *Ring) apply(rec *record) (*consistent.Bin, error) {
+	switch rec.op {
+	case opAdd:
+		return nil, r.ring.Add(consistent.NewBinWithLabels(rec.name, rec.labels))
+	case opRemove:
+		return nil, r.ring.Remove(consistent.NewBin(rec.name))
+	case opLocate:
+		return r.ring.Register(consistent.NewBall(rec.name))
+	case opDelete:
+		return nil, r.ring.Delete(consistent.NewBall(rec.name))
+	case opPin:
+		return nil, r.ring.Pin(rec.partID, rec.name)
+	case opUnpin:
+		return nil, r.ring.Unpin(rec.partID)
+	}
+	return nil, logfile.ErrCorrupted
+}
+
+// write appends the record to the log.
+// The log is truncated to the last record if it's torn, so the following records are not lost on replay.
+// The caller must hold the lock.
+func (r *Ring) write(rec *record) error {
+	offset, err := logfile.Append(r.f, r.offset, encodeRecord(rec))
+	if err != nil {
+		return err
+	}
+	if r.syncWrites {
+		if err := r.f.Sync(); err != nil {
+			logfile.Rewind(r.f, r.offset)
+			return err
+		}
+	}
+	r.offset = offset
+	return nil
+}
+
+// Lookup finds a home for given key without registering it.
+func (r *Ring) Lookup(key []byte) (*consistent.Bin, consistent.PartitionID) {
+	return r.ring.Lookup(key)
+}
+
+// GetBins returns the bins of the ring.
+func (r *Ring) GetBins() []consistent.Bin {
+	return r.ring.GetBins()
+}
+
+// Snapshot returns the current snapshot of the ring for the other read operations.
+func (r *Ring) Snapshot() *consistent.Snapshot {
+	return r.ring.Snapshot()
+}
+
+// AllBalls calls fn for each registered ball until fn returns false.
+func (r *Ring) AllBalls(fn func(ball consistent.Ball) bool) error {
+	return r.ring.AllBalls(fn)
+}
+
+// Compact writes the snapshot of the ring and truncates the log.
+func (r *Ring) Compact() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return ErrClosed
+	}
+	return r.compact()
+}
+
+// compact writes the snapshot of the ring and truncates the log.
+// The records are skipped by their sequence numbers if the ring crashes before the log is truncated.
+// The caller must hold the lock.
+func (r *Ring) compact() error {
+	if err := r.writeSnapshot(); err != nil {
+		return err
+	}
+	if err := r.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := r.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r.offset = 0
+	r.records = 0
+	return nil
+}
+
+// writeSnapshot replaces the snapshot with the current ring.
+// The caller must hold the lock.
+func (r *Ring) writeSnapshot() error {
+	snap := &snapshot{Sequence: r.sequence, State: r.ring.State()}
+	if err := r.ring.AllBalls(func(ball consistent.Ball) bool {
+		snap.Balls = append(snap.Balls, ball.String())
+		return true
+	}); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(r.dir, snapshotFile)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(logfile.Frame(body)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readSnapshot reads the snapshot file.
+func readSnapshot(path string) (*snapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := logfile.Unframe(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptedSnapshot, err)
+	}
+	var snap snapshot
+	if err := json.Unmarshal(body, &snap); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptedSnapshot, err)
+	}
+	return &snap, nil
+}
+
+// Sync commits the written records to the stable storage.
+func (r *Ring) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return ErrClosed
+	}
+	return r.f.Sync()
+}
+
+// Close syncs and closes the log.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+
+	err := r.f.Sync()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	r.f = nil
+	return err
+}
+
+// record represents a mutation of the ring.
+type record struct {
+	sequence uint64
+	op       byte
+	partID   consistent.PartitionID
+	name     string
+	labels   map[string]string
+}
+
+// encodeRecord encodes the record framed by logfile.Frame.
+// The body holds the sequence number, the operation, the partition ID, the name and the labels.
+func encodeRecord(rec *record) []byte {
+	body := make([]byte, 0, 1+3*binary.MaxVarintLen64+len(rec.name))
+	body = binary.AppendUvarint(body, rec.sequence)
+	body = append(body, rec.op)
+	body = binary.AppendUvarint(body, uint64(rec.partID))
+	body = appendString(body, rec.name)
+	body = binary.AppendUvarint(body, uint64(len(rec.labels)))
+	for k, v := range rec.labels {
+		body = appendString(body, k)
+		body = appendString(body, v)
+	}
+	return logfile.Frame(body)
+}
+
+// readRecord reads a record from r.
+// It returns the number of the read bytes.
+func readRecord(r io.Reader) (*record, int, error) {
+	body, size, err := logfile.Read(r, maxRecordSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rec, err := decodeRecord(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec, size, nil
+}
+
+// decodeRecord decodes the body of the record.
+func decodeRecord(body []byte) (*record, error) {
+	d := decoder{b: body}
+	rec := &record{sequence: d.uvarint()}
+	rec.op = d.byte()
+	rec.partID = consistent.PartitionID(d.uvarint())
+	rec.name = d.string()
+	if n := d.uvarint(); n > 0 && n <= uint64(len(body)) {
+		rec.labels = make(map[string]string, n)
+		for i := uint64(0); i < n; i++ {
+			k := d.string()
+			rec.labels[k] = d.string()
+		}
+	} else if n > 0 {
+		d.err = logfile.ErrCorrupted
+	}
+
+	if d.err != nil || len(d.b) > 0 || rec.op < opAdd || rec.op > opUnpin {
+		return nil, logfile.ErrCorrupted
+	}
+	return rec, nil
+}
+
+// appendString appends the length-prefixed string.
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decoder reads the fields of a record body. It keeps the first error, so the fields can be read
+// without checking the error of each field.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = logfile.ErrCorrupted
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) == 0 {
+		d.err = logfile.ErrCorrupted
+		return 0
+	}
+	v := d.b[0]
+	d.b = d.b[1:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.b)) {
+		d.err = logfile.ErrCorrupted
+		return ""
+	}
+	s := string(d.b[:n])
+	d.b = d.b[n:]
+	return s
+}
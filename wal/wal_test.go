@@ -0,0 +1,276 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/KeisukeYamashita/consistent"
+	"github.com/KeisukeYamashita/consistent/internal/logfile"
+	"github.com/google/go-cmp/cmp"
+)
+
+type hasher struct{}
+
+func (hs hasher) Sum64(data []byte) uint64 {
+	h := fnv.New64()
+	h.Write(data)
+	return h.Sum64()
+}
+
+func newConfig() *consistent.Config {
+	return &consistent.Config{
+		Partition:              23,
+		ReplicationFactor:      21,
+		LoadBalancingParameter: 1.25,
+		Hasher:                 hasher{},
+	}
+}
+
+func open(t *testing.T, dir string, threshold int) *Ring {
+	t.Helper()
+
+	bins := make([]consistent.Bin, 3)
+	for i := range bins {
+		bins[i] = consistent.NewBin(fmt.Sprintf("node%d", i))
+	}
+	r, err := Open(Config{Dir: dir, Config: newConfig(), Bins: bins, CompactThreshold: threshold})
+	if err != nil {
+		t.Fatalf("failed to open ring: %v", err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+	})
+
+	return r
+}
+
+// ringState represents the whole state of the ring to compare the rings.
+type ringState struct {
+	State *consistent.State
+	Balls []string
+}
+
+func stateOf(t *testing.T, r *Ring) ringState {
+	t.Helper()
+
+	st := ringState{State: r.Snapshot().State()}
+	if err := r.AllBalls(func(ball consistent.Ball) bool {
+		st.Balls = append(st.Balls, ball.String())
+		return true
+	}); err != nil {
+		t.Fatalf("failed to range balls: %v", err)
+	}
+	sort.Strings(st.Balls)
+
+	return st
+}
+
+// mutate applies various mutations to the ring.
+func mutate(t *testing.T, r *Ring) {
+	t.Helper()
+
+	if err := r.Add(consistent.NewBinWithLabels("extra", map[string]string{"zone": "a"})); err != nil {
+		t.Fatalf("failed to add bin: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := r.Locate(consistent.NewBall(fmt.Sprintf("data%d", i))); err != nil {
+			t.Fatalf("failed to locate ball: %v", err)
+		}
+	}
+	if err := r.Delete(consistent.NewBall("data0")); err != nil {
+		t.Fatalf("failed to delete ball: %v", err)
+	}
+	if err := r.Pin(1, "extra"); err != nil {
+		t.Fatalf("failed to pin partition: %v", err)
+	}
+	if err := r.Pin(2, "node1"); err != nil {
+		t.Fatalf("failed to pin partition: %v", err)
+	}
+	if err := r.Unpin(2); err != nil {
+		t.Fatalf("failed to unpin partition: %v", err)
+	}
+	if err := r.Remove(consistent.NewBin("node0")); err != nil {
+		t.Fatalf("failed to remove bin: %v", err)
+	}
+
+	// the failed mutation is logged but it fails again on replay.
+	if err := r.Add(consistent.NewBin("extra")); !errors.Is(err, consistent.ErrBinAlreadyExist) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, consistent.ErrBinAlreadyExist)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	type testcase struct {
+		cfg  Config
+		want error
+	}
+
+	tcs := map[string]testcase{
+		"no dir": {
+			cfg:  Config{Config: newConfig()},
+			want: ErrNoDir,
+		},
+		"no config": {
+			cfg:  Config{Dir: t.TempDir()},
+			want: ErrNoConfig,
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			if _, err := Open(tc.cfg); !errors.Is(err, tc.want) {
+				t.Fatalf("error unexpected: got:%v want:%v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestRing_Reopen(t *testing.T) {
+	dir := t.TempDir()
+
+	r := open(t, dir, 0)
+	mutate(t, r)
+	want := stateOf(t, r)
+	if err := r.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	if err := r.Add(consistent.NewBin("closed")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrClosed)
+	}
+
+	// the bins of the config are ignored once the ring is persisted.
+	r2, err := Open(Config{Dir: dir, Config: newConfig(), Bins: []consistent.Bin{consistent.NewBin("other")}})
+	if err != nil {
+		t.Fatalf("failed to open ring: %v", err)
+	}
+	defer r2.Close()
+
+	if diff := cmp.Diff(stateOf(t, r2), want); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestRing_Compact(t *testing.T) {
+	dir := t.TempDir()
+
+	r := open(t, dir, 4)
+	mutate(t, r)
+	want := stateOf(t, r)
+	if r.records >= 4 {
+		t.Fatalf("log should be compacted: got:%d records", r.records)
+	}
+
+	// the records which remain after a crash while compacting are not applied twice.
+	b, err := os.ReadFile(filepath.Join(dir, logFile))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if err := r.Compact(); err != nil {
+		t.Fatalf("failed to compact: %v", err)
+	}
+	r.Close()
+	if err := os.WriteFile(filepath.Join(dir, logFile), b, 0o644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	r2 := open(t, dir, 4)
+	if diff := cmp.Diff(stateOf(t, r2), want); diff != "" {
+		t.Fatalf("mismatch (-got,+want):%s", diff)
+	}
+}
+
+func TestRing_TornWrite(t *testing.T) {
+	type testcase struct {
+		// tear tears the last record which starts at the offset.
+		tear func(b []byte, offset int64) []byte
+	}
+
+	tcs := map[string]testcase{
+		"truncated header": {
+			tear: func(b []byte, offset int64) []byte {
+				return b[:offset+logfile.HeaderSize/2]
+			},
+		},
+		"truncated body": {
+			tear: func(b []byte, _ int64) []byte {
+				return b[:len(b)-1]
+			},
+		},
+		"corrupted body": {
+			tear: func(b []byte, _ int64) []byte {
+				b[len(b)-1] ^= 0xff
+				return b
+			},
+		},
+	}
+
+	for n, tc := range tcs {
+		t.Run(n, func(t *testing.T) {
+			tc := tc
+			t.Parallel()
+
+			dir := t.TempDir()
+			r := open(t, dir, 0)
+			mutate(t, r)
+			want := stateOf(t, r)
+			offset := r.offset
+			if _, err := r.Locate(consistent.NewBall("torn")); err != nil {
+				t.Fatalf("failed to locate ball: %v", err)
+			}
+			r.Close()
+
+			path := filepath.Join(dir, logFile)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read log: %v", err)
+			}
+			if err := os.WriteFile(path, tc.tear(b, offset), 0o644); err != nil {
+				t.Fatalf("failed to write log: %v", err)
+			}
+
+			// the torn record is discarded and the new records are written after the last valid one.
+			r2 := open(t, dir, 0)
+			if diff := cmp.Diff(stateOf(t, r2), want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+			if _, err := r2.Locate(consistent.NewBall("after")); err != nil {
+				t.Fatalf("failed to locate ball: %v", err)
+			}
+			want = stateOf(t, r2)
+			r2.Close()
+
+			r3 := open(t, dir, 0)
+			if diff := cmp.Diff(stateOf(t, r3), want); diff != "" {
+				t.Fatalf("mismatch (-got,+want):%s", diff)
+			}
+		})
+	}
+}
+
+func TestRing_CorruptedSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	r := open(t, dir, 0)
+	r.Close()
+
+	path := filepath.Join(dir, snapshotFile)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read snapshot: %v", err)
+	}
+	b[len(b)-2] ^= 0xff
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	if _, err := Open(Config{Dir: dir, Config: newConfig()}); !errors.Is(err, ErrCorruptedSnapshot) {
+		t.Fatalf("error unexpected: got:%v want:%v", err, ErrCorruptedSnapshot)
+	}
+}